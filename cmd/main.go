@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+
 	"github.com/xenking/kitsu-media-server/pkg/config"
 	"github.com/xenking/kitsu-media-server/pkg/db"
 	"github.com/xenking/kitsu-media-server/pkg/handler"
+	"github.com/xenking/kitsu-media-server/pkg/library"
 	"github.com/xenking/kitsu-media-server/pkg/router"
 	"github.com/xenking/kitsu-media-server/pkg/store"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/verify"
+	"github.com/xenking/kitsu-media-server/pkg/watcher"
 
 	//echoSwagger "github.com/swaggo/echo-swagger"   // echo-swagger middleware
 	//_ "github.com/xenking/kitsu-media-server/docs" // docs is generated by Swag CLI, you have to import it.
@@ -43,7 +49,44 @@ func main() {
 	us := store.NewUserStore(d)
 	as := store.NewArticleStore(d)
 	ms := store.NewMediaStore(d)
-	h := handler.NewHandler(us, as, ms)
+	ls := store.NewLibraryStore(d)
+	cs := store.NewCommentStore(d)
+
+	for _, username := range cfg.Server.Admins {
+		u, err := us.GetByUsername(username)
+		if err != nil {
+			r.Logger.Fatal(err)
+		}
+		if u == nil {
+			r.Logger.Warnf("admin %s is not registered", username)
+			continue
+		}
+		if err := us.AddRole(u.ID, user.RoleAdmin); err != nil {
+			r.Logger.Fatal(err)
+		}
+	}
+
+	h := handler.NewHandler(us, as, ms, ls, cs)
+	if config.Global.RateStore == "sql" {
+		h.SetRateLimitStore(store.NewRateLimitStore(d))
+	}
 	h.Register(v1)
+	r.GET("/.well-known/jwks.json", h.JWKS)
+	go h.Run(context.Background())
+
+	go verify.New(ls, cfg.Library.VerifyRate).Run(context.Background())
+
+	if cfg.Library.Watch && len(cfg.Library.Roots) > 0 {
+		w := watcher.New(ls, library.NewMatcher(ms), cfg.Library.Roots, cfg.Library.Settle)
+		w.Subscribe(func(ev watcher.Event) {
+			r.Logger.Infof("library: %s media=%d episode=%d %s", ev.Type, ev.MediaID, ev.Episode, ev.Path)
+		})
+		go func() {
+			if err := w.Run(context.Background()); err != nil {
+				r.Logger.Error(err)
+			}
+		}()
+	}
+
 	r.Logger.Fatal(r.Start(cfg.Server.Host + ":" + cfg.Server.Port))
 }
@@ -1,6 +1,7 @@
 package article
 
 import (
+	"github.com/xenking/kitsu-media-server/pkg/comment"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 )
 
@@ -17,9 +18,9 @@ type Store interface {
 	ListFeed(userID uint, offset, limit int) ([]model.Article, int, error)
 
 	AddComment(*model.Article, *model.Comment) error
-	GetCommentsBySlug(string) ([]model.Comment, error)
-	GetCommentByID(uint) (*model.Comment, error)
-	DeleteComment(*model.Comment) error
+	GetCommentsBySlug(slug string, q comment.Query) (*comment.Page, error)
+	GetComment(*model.Article, uint) (*model.Comment, error)
+	DeleteComment(*model.Article, *model.Comment) error
 
 	AddFavorite(*model.Article, uint) error
 	RemoveFavorite(*model.Article, uint) error
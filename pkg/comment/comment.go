@@ -0,0 +1,62 @@
+package comment
+
+import (
+	"sort"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// DeletedBody stands in for the body of a removed comment.
+const DeletedBody = "[deleted]"
+
+// Store holds what comments have in common, whatever they are about.
+type Store interface {
+	GetByID(uint) (*model.Comment, error)
+	// Update replaces the body and keeps the old one as a revision. It
+	// returns false when the comment was edited or removed meanwhile.
+	Update(c *model.Comment, body string) (bool, error)
+	ListRevisions(commentID uint) ([]model.CommentRevision, error)
+	// Like counts a like of the user, once. It returns false when the user
+	// liked the comment already.
+	Like(c *model.Comment, userID uint) (bool, error)
+	Unlike(c *model.Comment, userID uint) (bool, error)
+	// Liked returns which of the comments the user liked.
+	Liked(userID uint, commentIDs []uint) (map[uint]bool, error)
+}
+
+// Thread puts each reply right after its parent, siblings oldest first.
+// Top level comments keep their order. Comments whose parent is missing
+// count as top level.
+func Thread(comments []model.Comment) []model.Comment {
+	ids := make(map[uint]bool, len(comments))
+	for _, c := range comments {
+		ids[c.ID] = true
+	}
+	children := make(map[uint][]model.Comment)
+	var roots []model.Comment
+	for _, c := range comments {
+		if c.ParentID != nil && ids[*c.ParentID] && *c.ParentID != c.ID {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	thread := make([]model.Comment, 0, len(comments))
+	var walk func([]model.Comment)
+	walk = func(level []model.Comment) {
+		for _, c := range level {
+			thread = append(thread, c)
+			replies := children[c.ID]
+			sort.SliceStable(replies, func(i, j int) bool {
+				if !replies[i].CreatedAt.Equal(replies[j].CreatedAt) {
+					return replies[i].CreatedAt.Before(replies[j].CreatedAt)
+				}
+				return replies[i].ID < replies[j].ID
+			})
+			walk(replies)
+		}
+	}
+	walk(roots)
+	return thread
+}
@@ -0,0 +1,59 @@
+package comment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+func newComment(id uint, parent uint, at int) model.Comment {
+	c := model.Comment{}
+	c.ID = id
+	c.CreatedAt = time.Unix(int64(at), 0)
+	if parent != 0 {
+		c.ParentID = &parent
+	}
+	return c
+}
+
+func TestThread(t *testing.T) {
+	comments := []model.Comment{
+		newComment(4, 1, 4),
+		newComment(1, 0, 1),
+		newComment(2, 0, 2),
+		newComment(3, 1, 3),
+		newComment(5, 3, 5),
+		newComment(6, 99, 0),
+	}
+
+	var ids []uint
+	for _, c := range Thread(comments) {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []uint{1, 3, 5, 4, 2, 6}, ids)
+	assert.Empty(t, Thread(nil))
+}
+
+func TestThreadKeepsTopLevelOrder(t *testing.T) {
+	comments := []model.Comment{newComment(2, 0, 2), newComment(3, 1, 3), newComment(1, 0, 1)}
+
+	var ids []uint
+	for _, c := range Thread(comments) {
+		ids = append(ids, c.ID)
+	}
+	assert.Equal(t, []uint{2, 1, 3}, ids)
+}
+
+func TestCursor(t *testing.T) {
+	c := &Cursor{Likes: 12, ID: 34}
+	got, err := ParseCursor(c.String())
+	assert.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	for _, s := range []string{"", "!!", "MTI", "YS4x", "MS5h"} {
+		_, err := ParseCursor(s)
+		assert.Equal(t, ErrCursor, err, s)
+	}
+}
@@ -0,0 +1,101 @@
+package comment
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// Sort orders of the top level comments.
+const (
+	SortOldest = "oldest"
+	SortNewest = "newest"
+	SortLiked  = "liked"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	// MaxReplies is the most replies a thread comes with in a page.
+	MaxReplies = 50
+)
+
+var (
+	ErrCursor   = errors.New("invalid comment cursor")
+	ErrNotFound = errors.New("comment not found")
+)
+
+// Query selects a page of threads. At most one of After, Before and Around
+// is set.
+type Query struct {
+	Sort  string
+	Limit int
+	After *Cursor
+	// Before pages backwards.
+	Before *Cursor
+	// Around is a comment whose thread is put in the middle of the page,
+	// for links to a comment.
+	Around uint
+}
+
+// ValidSort reports whether sort is a known order.
+func ValidSort(sort string) bool {
+	return sort == SortOldest || sort == SortNewest || sort == SortLiked
+}
+
+// Cursor is the position of a top level comment in a sort order.
+type Cursor struct {
+	Likes int
+	ID    uint
+}
+
+// NewCursor is the position of c.
+func NewCursor(c *model.Comment) *Cursor {
+	return &Cursor{Likes: c.LikesCount, ID: c.ID}
+}
+
+// String encodes the cursor opaquely.
+func (c *Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.Likes, c.ID)))
+}
+
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrCursor
+	}
+	parts := strings.SplitN(string(b), ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrCursor
+	}
+	likes, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, ErrCursor
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, ErrCursor
+	}
+	return &Cursor{Likes: likes, ID: uint(id)}, nil
+}
+
+// Page is a page of threads.
+type Page struct {
+	// Comments are the top level comments of the page in the sort order,
+	// each followed by its replies. Replies come level by level up to
+	// MaxReplies per thread, the thread of Around always reaches it.
+	Comments []model.Comment
+	// Cut are the top level comments whose replies did not all fit.
+	Cut map[uint]bool
+	// Count is the number of comments, replies included, that were not
+	// deleted. Threads is the number of top level comments.
+	Count   int
+	Threads int
+	// Next and Prev are nil at the ends.
+	Next *Cursor
+	Prev *Cursor
+}
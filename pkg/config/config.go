@@ -1,12 +1,26 @@
 package config
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/xenking/kitsu-media-server/pkg/keyset"
+	"github.com/xenking/kitsu-media-server/pkg/lockout"
+	"github.com/xenking/kitsu-media-server/pkg/mail"
+	"github.com/xenking/kitsu-media-server/pkg/oidc"
+	"github.com/xenking/kitsu-media-server/pkg/password"
+	"github.com/xenking/kitsu-media-server/pkg/ratelimit"
+	"github.com/xenking/kitsu-media-server/pkg/throttle"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn"
 )
 
 // Config is a application configuration structure
@@ -23,12 +37,110 @@ type Config struct {
 		UserImg string `yaml:"user_img" env-description:"Default user image"`
 	} `yaml:"default"`
 	Server struct {
-		Host      string `yaml:"host" env:"SRV_HOST,HOST" env-description:"Server host" env-default:"localhost"`
-		Port      string `yaml:"port" env:"SRV_PORT,PORT" env-description:"Server port" env-default:"8080"`
-		JWTSecret string `yaml:"secret" env:"SRV_SECRET,SECRET" env-description:"JWT secret string"`
+		Host          string        `yaml:"host" env:"SRV_HOST,HOST" env-description:"Server host" env-default:"localhost"`
+		Port          string        `yaml:"port" env:"SRV_PORT,PORT" env-description:"Server port" env-default:"8080"`
+		JWTSecret     string        `yaml:"secret" env:"SRV_SECRET,SECRET" env-description:"JWT secret string, at least 32 bytes. Signs HS256 tokens and links when no link keys are set"`
+		JWTAlg        string        `yaml:"jwt_alg" env:"SRV_JWT_ALG" env-description:"Access token algorithm: HS256, RS256 or EdDSA" env-default:"HS256"`
+		JWTKeyFiles   []string      `yaml:"jwt_key_files" env:"SRV_JWT_KEY_FILES" env-separator:"," env-description:"Comma separated kid:path PEM private keys for RS256 or EdDSA, or raw secrets for HS256, used instead of the JWT secret. The first one signs"`
+		JWTRotate     time.Duration `yaml:"jwt_rotate" env:"SRV_JWT_ROTATE" env-description:"Sign with the next of the JWT key files this often from the rotation start, 0 to always sign with the first. The last file keeps signing once reached. Needs at least two key files"`
+		JWTRotateFrom string        `yaml:"jwt_rotate_from" env:"SRV_JWT_ROTATE_FROM" env-description:"RFC 3339 time the first JWT key file started signing, needed for rotation"`
+		JWTOverlap    time.Duration `yaml:"jwt_overlap" env:"SRV_JWT_OVERLAP" env-description:"How long a rotated out JWT key keeps verifying tokens, at least the access token lifetime" env-default:"1h"`
+		LinkTTL       time.Duration `yaml:"link_ttl" env:"SRV_LINK_TTL" env-description:"Lifetime of signed links handed out in playlists" env-default:"24h"`
+		AccessTTL     time.Duration `yaml:"access_ttl" env:"SRV_ACCESS_TTL" env-description:"Lifetime of access tokens" env-default:"15m"`
+		RefreshTTL    time.Duration `yaml:"refresh_ttl" env:"SRV_REFRESH_TTL" env-description:"Lifetime of refresh tokens, a session ends when it is not refreshed for that long" env-default:"720h"`
+		SeenInterval  time.Duration `yaml:"seen_interval" env:"SRV_SEEN_INTERVAL" env-description:"How often the last seen time of sessions is written" env-default:"1m"`
+		Admins        []string      `yaml:"admins" env:"SRV_ADMINS" env-separator:"," env-description:"Comma separated usernames granted the admin role on startup"`
+		Proxies       []string      `yaml:"trusted_proxies" env:"SRV_TRUSTED_PROXIES" env-separator:"," env-description:"Comma separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For header is trusted. Without them the client is the address of the connection"`
+		LinkKeys      []string      `yaml:"link_keys" env:"SRV_LINK_KEYS" env-separator:"," env-description:"Comma separated id:secret keys for signed links, the first one signs new links. Defaults to the JWT secret"`
 	} `yaml:"server"`
+	Library struct {
+		Roots          []string      `yaml:"roots" env:"LIBRARY_ROOTS" env-separator:"," env-description:"Comma separated list of media library directories"`
+		VerifyRate     int64         `yaml:"verify_rate" env:"LIBRARY_VERIFY_RATE" env-description:"Bytes per second read when verifying file checksums, 0 for unlimited" env-default:"16777216"`
+		Watch          bool          `yaml:"watch" env:"LIBRARY_WATCH" env-description:"Link new files in the library directories automatically" env-default:"true"`
+		Settle         time.Duration `yaml:"settle" env:"LIBRARY_SETTLE" env-description:"How long a file must stop growing before it is linked" env-default:"30s"`
+		WatchedPercent float64       `yaml:"watched_percent" env:"LIBRARY_WATCHED_PERCENT" env-description:"Share of an episode in percent after which it counts as watched" env-default:"90"`
+	} `yaml:"library"`
+	Stream struct {
+		Rate       int64            `yaml:"rate" env:"STREAM_RATE" env-description:"Bytes per second shared by all streams, 0 for unlimited"`
+		UserRate   int64            `yaml:"user_rate" env:"STREAM_USER_RATE" env-description:"Bytes per second of the streams of one user, 0 for unlimited"`
+		RoleRates  map[string]int64 `yaml:"role_rates" env:"STREAM_ROLE_RATES" env-separator:"," env-description:"Comma separated role:rate pairs replacing the user rate for users with the role"`
+		MaxStreams int              `yaml:"max_streams" env:"STREAM_MAX_STREAMS" env-description:"Files a user may stream at once, 0 for unlimited" env-default:"3"`
+	} `yaml:"stream"`
+	Mail struct {
+		Host      string        `yaml:"host" env:"MAIL_SMTP_HOST" env-description:"SMTP relay host. Without one mails are written to MAIL_DIR, or logged"`
+		Port      int           `yaml:"port" env:"MAIL_SMTP_PORT" env-description:"SMTP relay port, STARTTLS is used when offered" env-default:"587"`
+		Username  string        `yaml:"username" env:"MAIL_SMTP_USERNAME" env-description:"SMTP user name"`
+		Password  string        `yaml:"password" env:"MAIL_SMTP_PASSWORD" env-description:"SMTP password"`
+		From      string        `yaml:"from" env:"MAIL_FROM" env-description:"Sender address" env-default:"kitsu.media <noreply@localhost>"`
+		Dir       string        `yaml:"dir" env:"MAIL_DIR" env-description:"Directory mails are written to when there is no SMTP relay"`
+		LinkURL   string        `yaml:"link_url" env:"MAIL_LINK_URL" env-description:"URL of the web app, mails link to its /verify-email and /reset-password pages" env-default:"http://localhost:8080"`
+		VerifyTTL time.Duration `yaml:"verify_ttl" env:"MAIL_VERIFY_TTL" env-description:"Lifetime of email verification links" env-default:"48h"`
+		ResetTTL  time.Duration `yaml:"reset_ttl" env:"MAIL_RESET_TTL" env-description:"Lifetime of password reset links" env-default:"1h"`
+	} `yaml:"mail"`
+	Password struct {
+		MinLength   int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-description:"Shortest password accepted" env-default:"8"`
+		Blocklist   string `yaml:"blocklist" env:"PASSWORD_BLOCKLIST" env-description:"File of passwords to refuse, one per line, on top of the built-in common ones"`
+		Memory      uint32 `yaml:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY" env-description:"Memory of argon2id in KiB" env-default:"65536"`
+		Iterations  uint32 `yaml:"argon2_iterations" env:"PASSWORD_ARGON2_ITERATIONS" env-description:"Passes of argon2id" env-default:"3"`
+		Parallelism uint8  `yaml:"argon2_parallelism" env:"PASSWORD_ARGON2_PARALLELISM" env-description:"Lanes of argon2id" env-default:"2"`
+	} `yaml:"password"`
+	WebAuthn struct {
+		RPID    string        `yaml:"rp_id" env:"WEBAUTHN_RP_ID" env-description:"Domain passkeys are registered for" env-default:"localhost"`
+		RPName  string        `yaml:"rp_name" env:"WEBAUTHN_RP_NAME" env-description:"Name authenticators show for the site" env-default:"kitsu.media"`
+		Origins []string      `yaml:"origins" env:"WEBAUTHN_ORIGINS" env-separator:"," env-description:"Comma separated origins of the web app allowed to use passkeys" env-default:"http://localhost:8080"`
+		Timeout time.Duration `yaml:"timeout" env:"WEBAUTHN_TIMEOUT" env-description:"How long a passkey registration or login may take" env-default:"5m"`
+	} `yaml:"webauthn"`
+	Login struct {
+		FreeAttempts     int           `yaml:"free_attempts" env:"LOGIN_FREE_ATTEMPTS" env-description:"Failed logins of an account or network before attempts are delayed" env-default:"3"`
+		BaseDelay        time.Duration `yaml:"base_delay" env:"LOGIN_BASE_DELAY" env-description:"First delay after the free attempts, doubling with each failure" env-default:"1s"`
+		MaxDelay         time.Duration `yaml:"max_delay" env:"LOGIN_MAX_DELAY" env-description:"Longest delay between attempts" env-default:"1m"`
+		AccountLockAfter int           `yaml:"account_lock_after" env:"LOGIN_ACCOUNT_LOCK_AFTER" env-description:"Failed logins that lock an account, 0 never locks" env-default:"10"`
+		IPLockAfter      int           `yaml:"ip_lock_after" env:"LOGIN_IP_LOCK_AFTER" env-description:"Failed logins that lock a network, 0 never locks" env-default:"50"`
+		LockDuration     time.Duration `yaml:"lock_duration" env:"LOGIN_LOCK_DURATION" env-description:"How long a lock lasts" env-default:"15m"`
+		Window           time.Duration `yaml:"window" env:"LOGIN_WINDOW" env-description:"How long failed logins are remembered after the last one" env-default:"1h"`
+		IPv4Prefix       int           `yaml:"ipv4_prefix" env:"LOGIN_IPV4_PREFIX" env-description:"Bits of IPv4 addresses failed logins are counted for" env-default:"32"`
+		IPv6Prefix       int           `yaml:"ipv6_prefix" env:"LOGIN_IPV6_PREFIX" env-description:"Bits of IPv6 addresses failed logins are counted for" env-default:"64"`
+	} `yaml:"login"`
+	Rate struct {
+		Store      string            `yaml:"store" env:"RATE_STORE" env-description:"Where rate limits are counted: memory, or sql to share them between instances" env-default:"memory"`
+		UserLimits map[string]string `yaml:"user_limits" env:"RATE_USER_LIMITS" env-separator:"," env-description:"Comma separated group:limit/period token buckets per user, groups are read, write, comment and auth" env-default:"read:600/1m,write:120/1m,comment:5/1m"`
+		IPLimits   map[string]string `yaml:"ip_limits" env:"RATE_IP_LIMITS" env-separator:"," env-description:"Comma separated group:limit/period token buckets per client address" env-default:"read:1200/1m,write:240/1m,comment:10/1m,auth:20/1m"`
+	} `yaml:"rate"`
+	Registration struct {
+		Mode          string        `yaml:"mode" env:"REGISTRATION_MODE" env-description:"Who can sign up: open, invite-only or closed. Single sign-on only creates users while open" env-default:"open"`
+		InviterRoles  []string      `yaml:"inviter_roles" env:"REGISTRATION_INVITER_ROLES" env-separator:"," env-description:"Comma separated roles allowed to create invites, member allows every user" env-default:"admin,moderator"`
+		InviteMaxUses int           `yaml:"invite_max_uses" env:"REGISTRATION_INVITE_MAX_USES" env-description:"Most uses of an invite created by a user who cannot manage invites" env-default:"5"`
+		InviteTTL     time.Duration `yaml:"invite_ttl" env:"REGISTRATION_INVITE_TTL" env-description:"Default lifetime of invites, and the longest for users who cannot manage invites" env-default:"168h"`
+	} `yaml:"registration"`
+	Comments struct {
+		MaxDepth   int    `yaml:"max_depth" env:"COMMENT_MAX_DEPTH" env-description:"How deep replies to comments can nest, 0 allows no replies" env-default:"6"`
+		LegacyType string `yaml:"legacy_type" env:"COMMENT_LEGACY_TYPE" env-description:"What comments from before media had comments are on: articles or media, empty to guess from creation dates"`
+	} `yaml:"comments"`
+	OIDC struct {
+		StateTTL  time.Duration  `yaml:"state_ttl" env:"OIDC_STATE_TTL" env-description:"How long a single sign-on login may take at the provider" env-default:"10m"`
+		Providers []OIDCProvider `yaml:"providers" env-description:"OpenID Connect providers users can log in with, only in the configuration file"`
+	} `yaml:"oidc"`
 }
 
+// OIDCProvider is an OpenID Connect provider users can log in with.
+type OIDCProvider struct {
+	Name         string            `yaml:"name"`
+	Issuer       string            `yaml:"issuer"`
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	RedirectURL  string            `yaml:"redirect_url"`
+	Scopes       []string          `yaml:"scopes"`
+	GroupsClaim  string            `yaml:"groups_claim"`
+	Roles        map[string]string `yaml:"roles"`
+}
+
+// Registration modes.
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite-only"
+	RegistrationClosed     = "closed"
+)
+
 // args command-line parameters
 type args struct {
 	ConfigPath      string
@@ -55,8 +167,39 @@ func processArgs(cfg interface{}) args {
 }
 
 var Global = &struct {
-	JWTSecret []byte
-	UserImg   string
+	JWTSecret      []byte
+	JWTKeys        *keyset.Set
+	TrustedProxies []*net.IPNet
+	UserImg        string
+	LibraryRoots   []string
+	LinkTTL        time.Duration
+	AccessTTL      time.Duration
+	RefreshTTL     time.Duration
+	SeenInterval   time.Duration
+	LinkKeys       []LinkKey
+	WatchedPercent float64
+	StreamLimits   throttle.Limits
+	Mail           mail.Config
+	MailLinkURL    string
+	VerifyTTL      time.Duration
+	ResetTTL       time.Duration
+	PasswordParams password.Params
+	PasswordPolicy *password.Policy
+	WebAuthn       webauthn.Config
+	AccountLockout lockout.Policy
+	IPLockout      lockout.Policy
+	LoginIPv4Bits  int
+	LoginIPv6Bits  int
+	RateStore      string
+	RateLimits     map[string]ratelimit.Limit
+	Registration   string
+	InviterRoles   []string
+	InviteMaxUses  int
+	InviteTTL      time.Duration
+	CommentDepth   int
+	CommentLegacy  string
+	OIDCStateTTL   time.Duration
+	OIDCProviders  []oidc.Config
 }{}
 
 func (cfg *Config) Init() {
@@ -66,10 +209,242 @@ func (cfg *Config) Init() {
 		log.Println(err)
 		os.Exit(2)
 	}
-	setGlobal(cfg)
+	if err := setGlobal(cfg); err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
 }
 
-func setGlobal(cfg *Config) {
+func setGlobal(cfg *Config) error {
 	Global.JWTSecret = []byte(cfg.Server.JWTSecret)
 	Global.UserImg = cfg.Default.UserImg
+	Global.LibraryRoots = cfg.Library.Roots
+	Global.LinkTTL = cfg.Server.LinkTTL
+	Global.AccessTTL = cfg.Server.AccessTTL
+	proxies, err := parseProxies(cfg.Server.Proxies)
+	if err != nil {
+		return err
+	}
+	Global.TrustedProxies = proxies
+	Global.RefreshTTL = cfg.Server.RefreshTTL
+	Global.SeenInterval = cfg.Server.SeenInterval
+	Global.WatchedPercent = cfg.Library.WatchedPercent
+	Global.StreamLimits = throttle.Limits{
+		Rate:       cfg.Stream.Rate,
+		UserRate:   cfg.Stream.UserRate,
+		RoleRates:  cfg.Stream.RoleRates,
+		MaxStreams: cfg.Stream.MaxStreams,
+	}
+	Global.Mail = mail.Config{
+		Host:     cfg.Mail.Host,
+		Port:     cfg.Mail.Port,
+		Username: cfg.Mail.Username,
+		Password: cfg.Mail.Password,
+		From:     cfg.Mail.From,
+		Dir:      cfg.Mail.Dir,
+	}
+	Global.MailLinkURL = strings.TrimSuffix(cfg.Mail.LinkURL, "/")
+	Global.VerifyTTL = cfg.Mail.VerifyTTL
+	Global.ResetTTL = cfg.Mail.ResetTTL
+
+	Global.PasswordParams = password.Params{
+		Memory:      cfg.Password.Memory,
+		Iterations:  cfg.Password.Iterations,
+		Parallelism: cfg.Password.Parallelism,
+	}
+	Global.WebAuthn = webauthn.Config{
+		RPID:    cfg.WebAuthn.RPID,
+		RPName:  cfg.WebAuthn.RPName,
+		Origins: cfg.WebAuthn.Origins,
+		Timeout: cfg.WebAuthn.Timeout,
+	}
+
+	Global.AccountLockout = lockout.Policy{
+		FreeAttempts: cfg.Login.FreeAttempts,
+		BaseDelay:    cfg.Login.BaseDelay,
+		MaxDelay:     cfg.Login.MaxDelay,
+		LockAfter:    cfg.Login.AccountLockAfter,
+		LockDuration: cfg.Login.LockDuration,
+		Window:       cfg.Login.Window,
+	}
+	Global.IPLockout = Global.AccountLockout
+	Global.IPLockout.LockAfter = cfg.Login.IPLockAfter
+	if cfg.Login.IPv4Prefix < 0 || cfg.Login.IPv4Prefix > 32 || cfg.Login.IPv6Prefix < 0 || cfg.Login.IPv6Prefix > 128 {
+		return fmt.Errorf("invalid login network prefixes /%d and /%d", cfg.Login.IPv4Prefix, cfg.Login.IPv6Prefix)
+	}
+	Global.LoginIPv4Bits = cfg.Login.IPv4Prefix
+	Global.LoginIPv6Bits = cfg.Login.IPv6Prefix
+
+	if cfg.Rate.Store != "memory" && cfg.Rate.Store != "sql" {
+		return fmt.Errorf("unknown rate limit store %q", cfg.Rate.Store)
+	}
+	Global.RateStore = cfg.Rate.Store
+	rateLimits, err := ratelimit.ParseLimits(cfg.Rate.UserLimits, cfg.Rate.IPLimits)
+	if err != nil {
+		return err
+	}
+	Global.RateLimits = rateLimits
+
+	switch cfg.Registration.Mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed:
+	default:
+		return fmt.Errorf("unknown registration mode %q", cfg.Registration.Mode)
+	}
+	Global.Registration = cfg.Registration.Mode
+	Global.InviterRoles = cfg.Registration.InviterRoles
+	Global.InviteMaxUses = cfg.Registration.InviteMaxUses
+	Global.InviteTTL = cfg.Registration.InviteTTL
+
+	if cfg.Comments.MaxDepth < 0 {
+		return fmt.Errorf("invalid comment depth %d", cfg.Comments.MaxDepth)
+	}
+	Global.CommentDepth = cfg.Comments.MaxDepth
+	switch cfg.Comments.LegacyType {
+	case "", "articles", "media":
+	default:
+		return fmt.Errorf("unknown legacy comment type %q", cfg.Comments.LegacyType)
+	}
+	Global.CommentLegacy = cfg.Comments.LegacyType
+
+	Global.OIDCStateTTL = cfg.OIDC.StateTTL
+	providers, err := oidcProviders(cfg.OIDC.Providers)
+	if err != nil {
+		return err
+	}
+	Global.OIDCProviders = providers
+
+	policy, err := password.NewPolicy(cfg.Password.MinLength, cfg.Password.Blocklist)
+	if err != nil {
+		return err
+	}
+	Global.PasswordPolicy = policy
+
+	keys, err := parseLinkKeys(cfg.Server.LinkKeys)
+	if err != nil {
+		return err
+	}
+	Global.LinkKeys = keys
+
+	jwtKeys, err := newJWTKeys(cfg)
+	if err != nil {
+		return err
+	}
+	Global.JWTKeys = jwtKeys
+	return nil
+}
+
+// oidcProviders checks the providers. Names appear in URLs and in the
+// linked accounts, so they must be unique and stay the same.
+func oidcProviders(providers []OIDCProvider) ([]oidc.Config, error) {
+	seen := make(map[string]bool, len(providers))
+	configs := make([]oidc.Config, 0, len(providers))
+	for _, p := range providers {
+		if p.Name == "" || p.Name != url.PathEscape(p.Name) || seen[p.Name] {
+			return nil, fmt.Errorf("OIDC provider name %q is empty, taken or not URL safe", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, fmt.Errorf("OIDC provider %s needs an issuer, a client ID and a redirect URL", p.Name)
+		}
+		configs = append(configs, oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+			GroupsClaim:  p.GroupsClaim,
+			Roles:        p.Roles,
+		})
+	}
+	return configs, nil
+}
+
+// parseProxies reads addresses and CIDR ranges, an address is a range of
+// itself.
+func parseProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if ip := net.ParseIP(p); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an address or a CIDR range", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// newJWTKeys refuses to start with a short secret even when it only signs
+// links, as every deployment has one.
+func newJWTKeys(cfg *Config) (*keyset.Set, error) {
+	if len(cfg.Server.JWTSecret) < keyset.MinSecretLength {
+		return nil, keyset.ErrWeakSecret
+	}
+
+	opts := keyset.Options{
+		Alg:     cfg.Server.JWTAlg,
+		Secret:  []byte(cfg.Server.JWTSecret),
+		Rotate:  cfg.Server.JWTRotate,
+		Overlap: cfg.Server.JWTOverlap,
+	}
+	if opts.Rotate > 0 {
+		from, err := time.Parse(time.RFC3339, cfg.Server.JWTRotateFrom)
+		if err != nil {
+			return nil, fmt.Errorf("the JWT rotation start %q is not an RFC 3339 time", cfg.Server.JWTRotateFrom)
+		}
+		opts.From = from
+		if opts.Overlap < cfg.Server.AccessTTL {
+			return nil, fmt.Errorf("the JWT key overlap %s is shorter than the access token lifetime %s", opts.Overlap, cfg.Server.AccessTTL)
+		}
+	}
+	for _, f := range cfg.Server.JWTKeyFiles {
+		i := strings.IndexByte(f, ':')
+		if i <= 0 || i == len(f)-1 {
+			return nil, fmt.Errorf("JWT key file %q is not in the kid:path form", f)
+		}
+		data, err := ioutil.ReadFile(f[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		var k *keyset.Key
+		if opts.Alg == keyset.HS256 {
+			k, err = keyset.NewHMACKey(f[:i], bytes.TrimSpace(data))
+		} else {
+			k, err = keyset.ParsePEM(f[:i], data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		opts.Keys = append(opts.Keys, k)
+	}
+	return keyset.New(opts)
+}
+
+// LinkKey is a secret for signing links. Keys are referenced by ID from the
+// links, so a new key can be put first while the old ones keep verifying
+// the links already handed out until they are removed.
+type LinkKey struct {
+	ID     string
+	Secret []byte
+}
+
+func parseLinkKeys(keys []string) ([]LinkKey, error) {
+	parsed := make([]LinkKey, 0, len(keys))
+	for _, k := range keys {
+		i := strings.IndexByte(k, ':')
+		if i <= 0 || i == len(k)-1 {
+			return nil, fmt.Errorf("link key %q is not in the id:secret form", k)
+		}
+		parsed = append(parsed, LinkKey{ID: k[:i], Secret: []byte(k[i+1:])})
+	}
+	return parsed, nil
 }
@@ -47,9 +47,36 @@ func AutoMigrate(db *gorm.DB) {
 	db.AutoMigrate(
 		&model.User{},
 		&model.Follow{},
+		&model.UserRole{},
+		&model.RoleSetting{},
+		&model.RecoveryCode{},
+		&model.WebAuthnCredential{},
+		&model.WebAuthnChallenge{},
+		&model.AccessToken{},
+		&model.LoginThrottle{},
+		&model.RateLimitBucket{},
+		&model.Invite{},
+		&model.OIDCIdentity{},
+		&model.OIDCState{},
+		&model.Session{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
 		&model.Article{},
 		&model.Media{},
 		&model.Comment{},
+		&model.CommentRevision{},
+		&model.CommentLike{},
 		&model.Tag{},
+		&model.MediaFile{},
+		&model.MediaTrack{},
+		&model.MediaProgress{},
+		&model.PlaybackPosition{},
+		&model.MediaExternalID{},
+		&model.WatchHistory{},
+		&model.SkipSegment{},
+		&model.SkipVote{},
 	)
+	if err := migrateComments(db, config.Global.CommentLegacy); err != nil {
+		fmt.Println("storage err: ", err)
+	}
 }
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// migrateComments moves comments from the content_id they had before they
+// were polymorphic to their commentable. legacyType is what content_id
+// referred to, and every comment goes there when it is set. Otherwise, as
+// articles and media had overlapping IDs, a top level comment goes to
+// whichever of the two existed when it was written, and is left alone when
+// both did; replies go where their parent went. Comments left alone are not
+// shown anywhere and are reported, to be set by hand. Once no comment is
+// left, content_id is renamed to content_id_legacy so this does not run
+// again.
+func migrateComments(db *gorm.DB, legacyType string) error {
+	comments := db.NewScope(&model.Comment{}).TableName()
+	if !db.Dialect().HasColumn(comments, "content_id") {
+		return nil
+	}
+
+	unset := "(commentable_type IS NULL OR commentable_type = '') AND content_id IS NOT NULL"
+	if legacyType != "" {
+		err := db.Exec(fmt.Sprintf(
+			"UPDATE %s SET commentable_type = ?, commentable_id = content_id WHERE %s",
+			comments, unset,
+		), legacyType).Error
+		if err != nil {
+			return err
+		}
+	} else if err := guessCommentables(db, comments, unset); err != nil {
+		return err
+	}
+
+	var left []uint
+	if err := db.Unscoped().Model(&model.Comment{}).Where(unset).Pluck("id", &left).Error; err != nil {
+		return err
+	}
+	if len(left) > 0 {
+		log.Printf("storage: comments %v could be on either an article or a media, set COMMENT_LEGACY_TYPE or their commentable_type and commentable_id", left)
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN content_id TO content_id_legacy", comments)).Error
+}
+
+// guessCommentables sets the commentable of the comments matching unset
+// from the creation dates of articles and media.
+func guessCommentables(db *gorm.DB, comments, unset string) error {
+	articles := db.NewScope(&model.Article{}).TableName()
+	media := db.NewScope(&model.Media{}).TableName()
+
+	existed := "EXISTS (SELECT 1 FROM %s WHERE %s.id = %s.content_id AND %s.created_at <= %s.created_at)"
+	for _, m := range []struct{ typ, table, other string }{
+		{model.CommentableArticle, articles, media},
+		{model.CommentableMedia, media, articles},
+	} {
+		err := db.Exec(fmt.Sprintf(
+			"UPDATE %s SET commentable_type = ?, commentable_id = content_id WHERE %s AND parent_id IS NULL AND "+existed+" AND NOT "+existed,
+			comments, unset,
+			m.table, m.table, comments, m.table, comments,
+			m.other, m.other, comments, m.other, comments,
+		), m.typ).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// One level of replies at a time.
+	for {
+		res := db.Exec(fmt.Sprintf(
+			"UPDATE %[1]s SET "+
+				"commentable_type = (SELECT p.commentable_type FROM %[1]s p WHERE p.id = %[1]s.parent_id), "+
+				"commentable_id = (SELECT p.commentable_id FROM %[1]s p WHERE p.id = %[1]s.parent_id) "+
+				"WHERE %[2]s AND parent_id IN (SELECT id FROM %[1]s WHERE commentable_type <> '')",
+			comments, unset,
+		))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// legacyDB returns a database with an article and a media of ID 1, both
+// older than a comment on content 1 and its reply.
+func legacyDB(t *testing.T) *gorm.DB {
+	dir, err := ioutil.TempDir("", "kitsu-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	db.LogMode(false)
+	db.AutoMigrate(&model.Article{}, &model.Media{}, &model.Comment{})
+	then := time.Now().Add(-time.Hour)
+	a := model.Article{Content: model.Content{Slug: "a", Title: "a", AuthorID: 1}, Description: "a", Body: "a"}
+	a.ID, a.CreatedAt = 1, then
+	m := model.Media{Content: model.Content{Slug: "m", Title: "m", AuthorID: 1}}
+	m.ID, m.CreatedAt = 1, then
+	for _, v := range []interface{}{&a, &m} {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		"ALTER TABLE comments ADD COLUMN content_id integer",
+		"INSERT INTO comments (id, content_id, user_id, body, created_at) VALUES (1, 1, 1, 'top', ?)",
+		"INSERT INTO comments (id, content_id, user_id, parent_id, depth, body, created_at) VALUES (2, 1, 1, 1, 1, 'reply', ?)",
+	} {
+		if err := db.Exec(q, time.Now()).Error; err != nil {
+			t.Fatal(q, err)
+		}
+	}
+	return db
+}
+
+func commentables(t *testing.T, db *gorm.DB) []string {
+	var cc []model.Comment
+	assert.NoError(t, db.Order("id").Find(&cc).Error)
+	var types []string
+	for _, c := range cc {
+		types = append(types, c.CommentableType)
+	}
+	return types
+}
+
+func TestMigrateCommentsCaseLegacyType(t *testing.T) {
+	db := legacyDB(t)
+	assert.NoError(t, migrateComments(db, model.CommentableMedia))
+	assert.Equal(t, []string{model.CommentableMedia, model.CommentableMedia}, commentables(t, db))
+	assert.False(t, db.Dialect().HasColumn("comments", "content_id"))
+	assert.True(t, db.Dialect().HasColumn("comments", "content_id_legacy"))
+	assert.NoError(t, migrateComments(db, ""), "runs once")
+}
+
+func TestMigrateCommentsCaseAmbiguous(t *testing.T) {
+	db := legacyDB(t)
+	assert.NoError(t, migrateComments(db, ""))
+	assert.Equal(t, []string{"", ""}, commentables(t, db))
+	assert.True(t, db.Dialect().HasColumn("comments", "content_id"), "kept for another run")
+
+	assert.NoError(t, migrateComments(db, model.CommentableArticle))
+	assert.Equal(t, []string{model.CommentableArticle, model.CommentableArticle}, commentables(t, db))
+	assert.False(t, db.Dialect().HasColumn("comments", "content_id"))
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// findAccessToken looks up a personal access token for the JWT middleware.
+// Tokens carry the roles of their user, except those that require a
+// second factor.
+func (h *Handler) findAccessToken(token string) (*middleware.AccessToken, error) {
+	t, err := h.userStore.GetAccessTokenByHash(utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || (t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)) {
+		return nil, nil
+	}
+
+	u, err := h.userStore.GetByID(t.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, nil
+	}
+	roles, err := h.tokenRoles(u, false)
+	if err != nil {
+		return nil, err
+	}
+
+	h.tokensUsed.Touch(t.ID)
+	return &middleware.AccessToken{
+		ID:     t.ID,
+		UserID: t.UserID,
+		Roles:  roles,
+		Scopes: t.ScopeList(),
+	}, nil
+}
+
+// AccessTokens godoc
+// @Summary List personal access tokens
+// @Description List the personal access tokens of the current user. Auth is required
+// @ID access-tokens
+// @Tags user
+// @Produce  json
+// @Success 200 {object} accessTokenListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/tokens [get]
+func (h *Handler) AccessTokens(c echo.Context) error {
+	tokens, err := h.userStore.ListAccessTokens(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newAccessTokenListResponse(tokens, h.tokensUsed))
+}
+
+// CreateAccessToken godoc
+// @Summary Create a personal access token
+// @Description Create a token for scripts, sent as "Authorization: Token <token>". It can do what its scopes allow and the roles of the user grant. The token is only shown in this response. Auth with a login is required
+// @ID create-access-token
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param token body accessTokenCreateRequest true "Name, scopes and expiry"
+// @Success 201 {object} accessTokenCreateResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/tokens [post]
+func (h *Handler) CreateAccessToken(c echo.Context) error {
+	req := &accessTokenCreateRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	random, err := utils.NewToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+	token := user.AccessTokenPrefix + random
+
+	t := &model.AccessToken{
+		UserID:    userIDFromToken(c),
+		Name:      req.Token.Name,
+		Hash:      utils.HashToken(token),
+		Scopes:    strings.Join(req.Token.Scopes, " "),
+		ExpiresAt: req.Token.ExpiresAt,
+	}
+	if err := h.userStore.CreateAccessToken(t); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newAccessTokenCreateResponse(t, token))
+}
+
+// DeleteAccessToken godoc
+// @Summary Revoke a personal access token
+// @Description Revoke a personal access token of the current user. Auth is required
+// @ID delete-access-token
+// @Tags user
+// @Produce  json
+// @Param id path integer true "ID of the token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/tokens/{id} [delete]
+func (h *Handler) DeleteAccessToken(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	t, err := h.userStore.GetAccessToken(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if t == nil || t.UserID != userIDFromToken(c) {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if err := h.userStore.DeleteAccessToken(t); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+)
+
+type accessTokenCreateRequest struct {
+	Token struct {
+		Name   string   `json:"name" validate:"required,max=64"`
+		Scopes []string `json:"scopes" validate:"required,min=1"`
+		// ExpiresAt is optional, tokens without one work until revoked.
+		ExpiresAt *time.Time `json:"expiresAt"`
+	} `json:"token"`
+}
+
+func (r *accessTokenCreateRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	for _, s := range r.Token.Scopes {
+		if !user.ValidScope(s) {
+			return errors.New("unknown scope " + s)
+		}
+	}
+	if r.Token.ExpiresAt != nil && !r.Token.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+)
+
+type accessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// newAccessTokenResponse takes the last used time not written yet from used,
+// if given.
+func newAccessTokenResponse(t *model.AccessToken, used *user.Seen) *accessTokenResponse {
+	r := &accessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     t.ScopeList(),
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+	if used == nil {
+		return r
+	}
+	if at, ok := used.Get(t.ID); ok && (r.LastUsedAt == nil || at.After(*r.LastUsedAt)) {
+		r.LastUsedAt = &at
+	}
+	return r
+}
+
+type accessTokenListResponse struct {
+	Tokens      []*accessTokenResponse `json:"tokens"`
+	TokensCount int                    `json:"tokensCount"`
+}
+
+func newAccessTokenListResponse(tokens []model.AccessToken, used *user.Seen) *accessTokenListResponse {
+	r := new(accessTokenListResponse)
+	r.Tokens = make([]*accessTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		r.Tokens = append(r.Tokens, newAccessTokenResponse(&tokens[i], used))
+	}
+	r.TokensCount = len(tokens)
+	return r
+}
+
+type accessTokenCreateResponse struct {
+	Token struct {
+		*accessTokenResponse
+		Token string `json:"token"`
+	} `json:"token"`
+}
+
+func newAccessTokenCreateResponse(t *model.AccessToken, token string) *accessTokenCreateResponse {
+	r := new(accessTokenCreateResponse)
+	r.Token.accessTokenResponse = newAccessTokenResponse(t, nil)
+	r.Token.Token = token
+	return r
+}
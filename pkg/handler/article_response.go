@@ -19,6 +19,7 @@ type articleResponse struct {
 	UpdatedAt      time.Time `json:"updatedAt"`
 	Favorited      bool      `json:"favorited"`
 	FavoritesCount int       `json:"favoritesCount"`
+	CommentsCount  int       `json:"commentsCount"`
 	Author         struct {
 		Username  string  `json:"username"`
 		Bio       *string `json:"bio"`
@@ -54,6 +55,7 @@ func newArticleResponse(c echo.Context, a *model.Article) *singleArticleResponse
 		}
 	}
 	ar.FavoritesCount = len(a.Favorites)
+	ar.CommentsCount = a.CommentsCount
 	ar.Author.Username = a.Author.Username
 	ar.Author.Image = a.Author.Image
 	ar.Author.Bio = a.Author.Bio
@@ -82,6 +84,7 @@ func newArticleListResponse(us user.Store, userID uint, articles []model.Article
 			}
 		}
 		ar.FavoritesCount = len(a.Favorites)
+		ar.CommentsCount = a.CommentsCount
 		ar.Author.Username = a.Author.Username
 		ar.Author.Image = a.Author.Image
 		ar.Author.Bio = a.Author.Bio
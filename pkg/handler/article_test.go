@@ -9,6 +9,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
 	"github.com/xenking/kitsu-media-server/pkg/router"
 	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
 	"github.com/xenking/kitsu-media-server/pkg/utils"
@@ -57,10 +58,10 @@ func TestCreateArticlesCaseSuccess(t *testing.T) {
 	var (
 		reqJSON = `{"article":{"title":"article2", "description":"article2", "body":"article2", "tagList":["tag1","tag2"]}}`
 	)
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.POST, "/api/articles", strings.NewReader(reqJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	err := jwtMiddleware(func(context echo.Context) error {
@@ -85,10 +86,10 @@ func TestUpdateArticlesCaseSuccess(t *testing.T) {
 	var (
 		reqJSON = `{"article":{"title":"article1 part 2", "tagList":["tag3"]}}`
 	)
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.PUT, "/api/articles/:slug", strings.NewReader(reqJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug")
@@ -112,14 +113,14 @@ func TestUpdateArticlesCaseSuccess(t *testing.T) {
 func TestFeedCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.GET, "/api/articles/feed", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	err := jwtMiddleware(func(context echo.Context) error {
-		return h.MediaFeed(c)
+		return h.ArticleFeed(c)
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusOK, rec.Code) {
@@ -136,10 +137,10 @@ func TestFeedCaseSuccess(t *testing.T) {
 func TestDeleteArticleCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.DELETE, "/api/articles/:slug", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug")
@@ -155,17 +156,17 @@ func TestDeleteArticleCaseSuccess(t *testing.T) {
 func TestGetCommentsCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.GET, "/api/articles/:slug/comments", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(2)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(2, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug/comments")
 	c.SetParamNames("slug")
 	c.SetParamValues("article1-slug")
 	err := jwtMiddleware(func(context echo.Context) error {
-		return h.GetMediaComments(c)
+		return h.GetArticleComments(c)
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusOK, rec.Code) {
@@ -182,17 +183,17 @@ func TestAddCommentCaseSuccess(t *testing.T) {
 	var (
 		reqJSON = `{"comment":{"body":"article1 comment2 by user2"}}`
 	)
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.POST, "/api/articles/:slug/comments", strings.NewReader(reqJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(2)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(2, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug/comments")
 	c.SetParamNames("slug")
 	c.SetParamValues("article1-slug")
 	err := jwtMiddleware(func(context echo.Context) error {
-		return h.AddMediaComment(c)
+		return h.AddArticleComment(c)
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusCreated, rec.Code) {
@@ -207,19 +208,17 @@ func TestAddCommentCaseSuccess(t *testing.T) {
 func TestDeleteCommentCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.DELETE, "/api/articles/:slug/comments/:id", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug/comments/:id")
-	c.SetParamNames("slug")
-	c.SetParamValues("article1-slug")
-	c.SetParamNames("id")
-	c.SetParamValues("1")
+	c.SetParamNames("slug", "id")
+	c.SetParamValues("article1-slug", "1")
 	err := jwtMiddleware(func(context echo.Context) error {
-		return h.DeleteMediaComment(c)
+		return h.DeleteArticleComment(c)
 	})(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
@@ -228,17 +227,17 @@ func TestDeleteCommentCaseSuccess(t *testing.T) {
 func TestFavoriteCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.POST, "/api/articles/:slug/favorite", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(2)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(2, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug/comments")
 	c.SetParamNames("slug")
 	c.SetParamValues("article1-slug")
 	err := jwtMiddleware(func(context echo.Context) error {
-		return h.MediaFavorite(c)
+		return h.ArticleFavorite(c)
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusOK, rec.Code) {
@@ -254,17 +253,17 @@ func TestFavoriteCaseSuccess(t *testing.T) {
 func TestUnfavoriteCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.DELETE, "/api/articles/:slug/favorite", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/articles/:slug/favorite")
 	c.SetParamNames("slug")
 	c.SetParamValues("article2-slug")
 	err := jwtMiddleware(func(context echo.Context) error {
-		return h.MediaUnfavorite(c)
+		return h.ArticleUnfavorite(c)
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusOK, rec.Code) {
@@ -284,7 +283,7 @@ func TestGetTagsCaseSuccess(t *testing.T) {
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
-	assert.NoError(t, h.MediaTags(c))
+	assert.NoError(t, h.ArticleTags(c))
 	if assert.Equal(t, http.StatusOK, rec.Code) {
 		var tt tagListResponse
 		err := json.Unmarshal(rec.Body.Bytes(), &tt)
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var (
+	errCommentParent  = errors.New("the comment replied to is not on this page")
+	errCommentRemoved = errors.New("the comment was deleted")
+	errCommentEdited  = errors.New("the comment was changed meanwhile, reload it")
+)
+
+// replyTo makes cm a reply to parent, which the caller looked up on the
+// article or media of cm, nil when it is not there.
+func replyTo(cm *model.Comment, parent *model.Comment) error {
+	if parent == nil {
+		return errCommentParent
+	}
+	if parent.Removed() {
+		return errCommentRemoved
+	}
+	if parent.Depth >= config.Global.CommentDepth {
+		return fmt.Errorf("replies cannot nest deeper than %d levels", config.Global.CommentDepth)
+	}
+	cm.ParentID = &parent.ID
+	cm.Depth = parent.Depth + 1
+	return nil
+}
+
+// commentList answers with the page list returns for the query of c.
+func (h *Handler) commentList(c echo.Context, list func(comment.Query) (*comment.Page, error)) error {
+	var q comment.Query
+	req := &commentListRequest{}
+	if err := req.bind(c, &q); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	p, err := list(q)
+	if err == comment.ErrNotFound {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if p == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	ids := make([]uint, 0, len(p.Comments))
+	for _, cm := range p.Comments {
+		ids = append(ids, cm.ID)
+	}
+	liked, err := h.commentStore.Liked(userIDFromToken(c), ids)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newCommentListResponse(c, p, liked))
+}
+
+// UpdateComment godoc
+// @Summary Edit a comment
+// @Description Replace the body of an own comment. The former body is kept in the history of the comment. Auth is required
+// @ID update-comment
+// @Tags comment
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "ID of the comment"
+// @Param comment body updateCommentRequest true "New body"
+// @Success 200 {object} singleCommentResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /comments/{id} [put]
+func (h *Handler) UpdateComment(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	cm, err := h.commentStore.GetByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if cm == nil || cm.Removed() {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if cm.UserID != userIDFromToken(c) {
+		return c.JSON(http.StatusForbidden, utils.AccessForbidden())
+	}
+
+	req := &updateCommentRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if req.Comment.Body != cm.Body {
+		ok, err := h.commentStore.Update(cm, req.Comment.Body)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+
+		if !ok {
+			return c.JSON(http.StatusConflict, utils.NewError(errCommentEdited))
+		}
+	}
+
+	liked, err := h.commentStore.Liked(cm.UserID, []uint{cm.ID})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newCommentResponse(c, cm, liked[cm.ID]))
+}
+
+// CommentRevisions godoc
+// @Summary Get the history of a comment
+// @Description List the bodies a comment had before it was edited, newest first
+// @ID comment-revisions
+// @Tags comment
+// @Produce  json
+// @Param id path integer true "ID of the comment"
+// @Success 200 {object} commentRevisionListResponse
+// @Failure 400 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /comments/{id}/revisions [get]
+func (h *Handler) CommentRevisions(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	cm, err := h.commentStore.GetByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if cm == nil || cm.Removed() {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	revisions, err := h.commentStore.ListRevisions(cm.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newCommentRevisionListResponse(revisions))
+}
+
+// LikeComment godoc
+// @Summary Like a comment
+// @Description Like a comment, once per user. Auth is required
+// @ID like-comment
+// @Tags comment
+// @Produce  json
+// @Param id path integer true "ID of the comment"
+// @Success 200 {object} singleCommentResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /comments/{id}/like [post]
+func (h *Handler) LikeComment(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	cm, err := h.commentStore.GetByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if cm == nil || cm.Removed() {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if _, err := h.commentStore.Like(cm, userIDFromToken(c)); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newCommentResponse(c, cm, true))
+}
+
+// UnlikeComment godoc
+// @Summary Take back a like
+// @Description Take back the like of the current user for a comment. Auth is required
+// @ID unlike-comment
+// @Tags comment
+// @Produce  json
+// @Param id path integer true "ID of the comment"
+// @Success 200 {object} singleCommentResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /comments/{id}/like [delete]
+func (h *Handler) UnlikeComment(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	cm, err := h.commentStore.GetByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if cm == nil || cm.Removed() {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if _, err := h.commentStore.Unlike(cm, userIDFromToken(c)); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newCommentResponse(c, cm, false))
+}
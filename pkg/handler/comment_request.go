@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
+)
+
+type updateCommentRequest struct {
+	Comment struct {
+		Body string `json:"body" validate:"required"`
+	} `json:"comment"`
+}
+
+func (r *updateCommentRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type commentListRequest struct {
+	Sort   string `query:"sort" validate:"omitempty,oneof=oldest newest liked"`
+	Limit  int    `query:"limit" validate:"min=0,max=100"`
+	After  string `query:"after"`
+	Before string `query:"before"`
+	Around uint   `query:"around"`
+}
+
+func (r *commentListRequest) bind(c echo.Context, q *comment.Query) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	set := 0
+	for _, given := range []bool{r.After != "", r.Before != "", r.Around != 0} {
+		if given {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of after, before and around can be given")
+	}
+
+	q.Sort = r.Sort
+	if q.Sort == "" {
+		q.Sort = comment.SortOldest
+	}
+	q.Limit = r.Limit
+	if q.Limit == 0 {
+		q.Limit = comment.DefaultLimit
+	}
+	q.Around = r.Around
+	var err error
+	if r.After != "" {
+		if q.After, err = comment.ParseCursor(r.After); err != nil {
+			return err
+		}
+	}
+	if r.Before != "" {
+		if q.Before, err = comment.ParseCursor(r.Before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
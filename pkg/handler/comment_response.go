@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type commentRevisionResponse struct {
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type commentRevisionListResponse struct {
+	Revisions      []commentRevisionResponse `json:"revisions"`
+	RevisionsCount int                       `json:"revisionsCount"`
+}
+
+func newCommentRevisionListResponse(revisions []model.CommentRevision) *commentRevisionListResponse {
+	r := new(commentRevisionListResponse)
+	r.Revisions = make([]commentRevisionResponse, 0, len(revisions))
+	for _, rev := range revisions {
+		r.Revisions = append(r.Revisions, commentRevisionResponse{Body: rev.Body, CreatedAt: rev.CreatedAt})
+	}
+	r.RevisionsCount = len(revisions)
+	return r
+}
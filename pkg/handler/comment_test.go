@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikeCommentCaseLookup(t *testing.T) {
+	tearDown()
+	setup()
+	r := routes()
+	token := sessionToken(2)
+
+	assert.Equal(t, http.StatusBadRequest, request(r, echo.POST, "/api/comments/one/like", token).Code)
+	assert.Equal(t, http.StatusNotFound, request(r, echo.POST, "/api/comments/99/like", token).Code)
+	assert.Equal(t, http.StatusNotFound, request(r, echo.GET, "/api/comments/99/revisions", "").Code)
+
+	rec := request(r, echo.POST, "/api/comments/1/like", token)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var c singleCommentResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &c))
+		assert.Equal(t, "article1 comment1", c.Comment.Body)
+	}
+	assert.Equal(t, http.StatusOK, request(r, echo.DELETE, "/api/comments/1/like", token).Code)
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/mail"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var errEmailVerified = errors.New("email address is already verified")
+
+// sendMail sends the mail in the background, a mail server that is down
+// must not fail the request.
+func (h *Handler) sendMail(template string, u *model.User, data mail.Data) {
+	data.Username = u.Username
+	m, err := mail.Render(template, u.Email, data)
+	if err != nil {
+		log.Println("mail:", err)
+		return
+	}
+	go func() {
+		if err := h.mailer.Send(m); err != nil {
+			log.Println("mail:", err)
+		}
+	}()
+}
+
+// verifyState changes once the address is verified or replaced, which ends
+// the verification links sent for it.
+func verifyState(u *model.User) string {
+	return u.Email + ":" + strconv.FormatBool(u.EmailVerified())
+}
+
+func (h *Handler) sendVerification(u *model.User) {
+	expires := time.Now().Add(config.Global.VerifyTTL)
+	token := utils.NewActionToken(utils.ActionVerifyEmail, u.ID, verifyState(u), expires)
+	h.sendMail(mail.TemplateVerify, u, mail.Data{
+		Link:    config.Global.MailLinkURL + "/verify-email?token=" + url.QueryEscape(token),
+		Expires: expires,
+	})
+}
+
+// emailVerified backs middleware.Verified.
+func (h *Handler) emailVerified(userID uint) (bool, error) {
+	u, err := h.userStore.GetByID(userID)
+	if err != nil || u == nil {
+		return false, err
+	}
+	return u.EmailVerified(), nil
+}
+
+// SendVerification godoc
+// @Summary Send the verification email again
+// @Description Mail a new link to verify the email address of the current user. Auth is required
+// @ID send-verification
+// @Tags user
+// @Produce  json
+// @Success 202 {object} map[string]interface{}
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/verification [post]
+func (h *Handler) SendVerification(c echo.Context) error {
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if u.EmailVerified() {
+		return c.JSON(http.StatusConflict, utils.NewError(errEmailVerified))
+	}
+
+	h.sendVerification(u)
+	return c.JSON(http.StatusAccepted, map[string]interface{}{"result": "ok"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirm the email address of a user with the token from the verification email
+// @ID verify-email
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param token body actionTokenRequest true "Token from the email"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /verify-email [post]
+func (h *Handler) VerifyEmail(c echo.Context) error {
+	req := &actionTokenRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	t, err := utils.ParseActionToken(utils.ActionVerifyEmail, req.Token)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByID(t.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(utils.ErrActionInvalid))
+	}
+
+	if err := t.Verify(verifyState(u)); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	now := time.Now()
+	if err := h.userStore.SetEmailVerified(u.ID, &now); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
@@ -0,0 +1,17 @@
+package handler
+
+import "github.com/labstack/echo/v4"
+
+type actionTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (r *actionTokenRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
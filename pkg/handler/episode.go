@@ -0,0 +1,371 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// Episodes godoc
+// @Summary Get the episodes of a media
+// @Description Get the episodes of a media that have files linked, with the probed stream information. Auth not required
+// @ID get-episodes
+// @Tags episode
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Success 200 {object} episodeListResponse
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /medias/{slug}/episodes [get]
+func (h *Handler) Episodes(c echo.Context) error {
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	files, err := h.libraryStore.ListFiles(m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newEpisodeListResponse(files))
+}
+
+// GetEpisode godoc
+// @Summary Get an episode of a media
+// @Description Get an episode with its duration, resolution, codecs and audio/subtitle tracks. Auth not required
+// @ID get-episode
+// @Tags episode
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Success 200 {object} singleEpisodeResponse
+// @Failure 400 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /medias/{slug}/episodes/{episode} [get]
+func (h *Handler) GetEpisode(c echo.Context) error {
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	files, err := h.libraryStore.ListEpisodeFiles(m.ID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if len(files) == 0 {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	return c.JSON(http.StatusOK, newSingleEpisodeResponse(episode, files))
+}
+
+// Playlist godoc
+// @Summary Get a playlist of a media
+// @Description Get an extended M3U playlist with stream URLs of all available episodes signed for the current user, so it plays without an Authorization header. Auth is required
+// @ID get-playlist
+// @Tags episode
+// @Produce  audio/x-mpegurl
+// @Param slug path string true "Slug of the media"
+// @Param from query string false "Episode number to start from, or next for the episode after the last one watched"
+// @Success 200 {string} string
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/playlist.m3u8 [get]
+func (h *Handler) Playlist(c echo.Context) error {
+	userID := userIDFromToken(c)
+	if userID == 0 {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(middleware.ErrJWTMissing))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	start := 0
+	switch from := c.QueryParam("from"); from {
+	case "":
+	case "next":
+		p, err := h.libraryStore.GetProgress(userID, m.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		if p != nil {
+			start = p.Episode + 1
+		}
+	default:
+		if start, err = strconv.Atoi(from); err != nil {
+			return c.JSON(http.StatusBadRequest, utils.NewError(err))
+		}
+	}
+
+	files, err := h.libraryStore.ListFiles(m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	baseURL := c.Scheme() + "://" + c.Request().Host
+	expires := time.Now().Add(config.Global.LinkTTL)
+	c.Response().Header().Set(echo.HeaderContentDisposition, `inline; filename="`+m.Slug+`.m3u8"`)
+	return c.Blob(http.StatusOK, "audio/x-mpegurl", newPlaylist(m, files, start, baseURL, userID, expires))
+}
+
+// StreamFile godoc
+// @Summary Stream a file
+// @Description Stream a linked file. Range requests are supported. Bandwidth is limited and a user may only stream a few files at once. Auth is required, either by header or by a signed URL like the ones in playlists
+// @ID stream-file
+// @Tags episode
+// @Produce  octet-stream
+// @Param id path integer true "ID of the file"
+// @Param exp query integer false "Expiry of the signed URL"
+// @Param uid query integer false "User of the signed URL"
+// @Param kid query string false "Key of the signed URL"
+// @Param sig query string false "Signature of the signed URL"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 429 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /files/{id}/stream [get]
+func (h *Handler) StreamFile(c echo.Context) error {
+	// Limits are per user, streams without one would share a quota.
+	userID := userIDFromToken(c)
+	if userID == 0 {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(middleware.ErrJWTMissing))
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	f, err := h.libraryStore.GetFileByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if f == nil || f.OrphanedAt != nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	stream, err := h.streams.Acquire(userID, f.ID)
+	if err != nil {
+		return c.JSON(http.StatusTooManyRequests, utils.NewError(err))
+	}
+	defer stream.Release()
+
+	res := c.Response()
+	res.Writer = stream.ResponseWriter(c.Request().Context(), res.Writer)
+	return c.File(f.Path)
+}
+
+// LinkEpisodeFile godoc
+// @Summary Link a file to an episode
+// @Description Link a file from the library to an episode of a media and probe its streams. Auth is required
+// @ID link-episode-file
+// @Tags episode
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Param file body linkFileRequest true "File to link"
+// @Success 201 {object} singleFileResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/episodes/{episode}/files [post]
+func (h *Handler) LinkEpisodeFile(c echo.Context) error {
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil || episode < 0 {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errors.New("invalid episode number")))
+	}
+
+	m, err := h.editableMedia(c, c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if m.Episodes > 0 && episode > m.Episodes {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("episode is out of range")))
+	}
+
+	f := model.MediaFile{MediaID: m.ID, Episode: episode}
+
+	req := &linkFileRequest{}
+	if err := req.bind(c, &f); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	linked, err := h.libraryStore.GetFileByPath(f.Path)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if linked != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("file is already linked")))
+	}
+
+	if err := library.Probe(&f); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if err := h.libraryStore.CreateFile(&f); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newSingleFileResponse(&f))
+}
+
+// UnlinkEpisodeFile godoc
+// @Summary Unlink a file from an episode
+// @Description Remove a file from an episode of a media. The file on disk is left untouched. Auth is required
+// @ID unlink-episode-file
+// @Tags episode
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Param id path integer true "ID of the file"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/episodes/{episode}/files/{id} [delete]
+func (h *Handler) UnlinkEpisodeFile(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	m, err := h.editableMedia(c, c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	f, err := h.libraryStore.GetFileByID(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if f == nil || f.MediaID != m.ID || strconv.Itoa(f.Episode) != c.Param("episode") {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if err := h.libraryStore.DeleteFile(f); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
+
+// CorruptedFiles godoc
+// @Summary List corrupted files
+// @Description List linked files whose CRC32 does not match the checksum in their name. Auth is required
+// @ID corrupted-files
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param limit query integer false "Limit number of files returned (default is 20)"
+// @Param offset query integer false "Offset/skip number of files (default is 0)"
+// @Success 200 {object} corruptedFileListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/files/corrupted [get]
+func (h *Handler) CorruptedFiles(c echo.Context) error {
+	offset, err := strconv.Atoi(c.QueryParam("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil {
+		limit = 20
+	}
+
+	files, count, err := h.libraryStore.ListCorruptedFiles(offset, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newCorruptedFileListResponse(files, count))
+}
+
+// StreamUsage godoc
+// @Summary List current streams
+// @Description List the users streaming right now with their files, the bytes sent and their bandwidth limit. Auth is required
+// @ID stream-usage
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} streamUsageListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/streams [get]
+func (h *Handler) StreamUsage(c echo.Context) error {
+	usage := h.streams.Usage()
+	users := make(map[uint]*model.User, len(usage))
+	for _, u := range usage {
+		if u.UserID == 0 {
+			continue
+		}
+		user, err := h.userStore.GetByID(u.UserID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		users[u.UserID] = user
+	}
+
+	return c.JSON(http.StatusOK, newStreamUsageListResponse(usage, users))
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type linkFileRequest struct {
+	File struct {
+		Path string `json:"path" validate:"required"`
+	} `json:"file"`
+}
+
+func (r *linkFileRequest) bind(c echo.Context, f *model.MediaFile) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	path, err := library.Resolve(r.File.Path, config.Global.LibraryRoots)
+	if err != nil {
+		return err
+	}
+	f.Path = path
+	return nil
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/throttle"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+type trackResponse struct {
+	Codec    string `json:"codec"`
+	Language string `json:"language"`
+	Name     string `json:"name"`
+	Default  bool   `json:"default"`
+	Forced   bool   `json:"forced"`
+}
+
+type fileResponse struct {
+	ID             uint            `json:"id"`
+	Name           string          `json:"name"`
+	Size           int64           `json:"size"`
+	Format         string          `json:"format"`
+	Duration       float64         `json:"duration"`
+	Width          int             `json:"width"`
+	Height         int             `json:"height"`
+	VideoCodec     string          `json:"videoCodec"`
+	CRCState       string          `json:"crcState"`
+	AudioTracks    []trackResponse `json:"audioTracks"`
+	SubtitleTracks []trackResponse `json:"subtitleTracks"`
+}
+
+type singleFileResponse struct {
+	File *fileResponse `json:"file"`
+}
+
+type episodeResponse struct {
+	Number   int             `json:"number"`
+	Duration float64         `json:"duration"`
+	Files    []*fileResponse `json:"files"`
+}
+
+type singleEpisodeResponse struct {
+	Episode *episodeResponse `json:"episode"`
+}
+
+type episodeListResponse struct {
+	Episodes      []*episodeResponse `json:"episodes"`
+	EpisodesCount int                `json:"episodesCount"`
+}
+
+func newTrackListResponse(tracks []model.MediaTrack) []trackResponse {
+	r := make([]trackResponse, 0, len(tracks))
+	for _, t := range tracks {
+		r = append(r, trackResponse{
+			Codec:    t.Codec,
+			Language: t.Language,
+			Name:     t.Name,
+			Default:  t.Default,
+			Forced:   t.Forced,
+		})
+	}
+	return r
+}
+
+func newFileResponse(f *model.MediaFile) *fileResponse {
+	fr := new(fileResponse)
+	fr.ID = f.ID
+	fr.Name = filepath.Base(f.Path)
+	fr.Size = f.Size
+	fr.Format = f.Format
+	fr.Duration = f.Duration
+	fr.Width = f.Width
+	fr.Height = f.Height
+	fr.VideoCodec = f.VideoCodec
+	fr.CRCState = f.CRCState
+	fr.AudioTracks = newTrackListResponse(f.AudioTracks())
+	fr.SubtitleTracks = newTrackListResponse(f.SubtitleTracks())
+	return fr
+}
+
+func newSingleFileResponse(f *model.MediaFile) *singleFileResponse {
+	return &singleFileResponse{newFileResponse(f)}
+}
+
+func newEpisodeResponse(number int, files []model.MediaFile) *episodeResponse {
+	er := new(episodeResponse)
+	er.Number = number
+	er.Files = make([]*fileResponse, 0, len(files))
+	for i := range files {
+		if er.Duration == 0 {
+			er.Duration = files[i].Duration
+		}
+		er.Files = append(er.Files, newFileResponse(&files[i]))
+	}
+	return er
+}
+
+func newSingleEpisodeResponse(number int, files []model.MediaFile) *singleEpisodeResponse {
+	return &singleEpisodeResponse{newEpisodeResponse(number, files)}
+}
+
+// newEpisodeListResponse groups files ordered by episode number.
+func newEpisodeListResponse(files []model.MediaFile) *episodeListResponse {
+	r := new(episodeListResponse)
+	r.Episodes = make([]*episodeResponse, 0)
+	for start := 0; start < len(files); {
+		end := start
+		for end < len(files) && files[end].Episode == files[start].Episode {
+			end++
+		}
+		r.Episodes = append(r.Episodes, newEpisodeResponse(files[start].Episode, files[start:end]))
+		start = end
+	}
+	r.EpisodesCount = len(r.Episodes)
+	return r
+}
+
+type corruptedFileResponse struct {
+	ID        uint       `json:"id"`
+	Media     string     `json:"media"`
+	Episode   int        `json:"episode"`
+	Path      string     `json:"path"`
+	Expected  string     `json:"expected"`
+	Actual    string     `json:"actual"`
+	CheckedAt *time.Time `json:"checkedAt"`
+}
+
+type corruptedFileListResponse struct {
+	Files      []*corruptedFileResponse `json:"files"`
+	FilesCount int                      `json:"filesCount"`
+}
+
+func newCorruptedFileListResponse(files []model.MediaFile, count int) *corruptedFileListResponse {
+	r := new(corruptedFileListResponse)
+	r.Files = make([]*corruptedFileResponse, 0, len(files))
+	for _, f := range files {
+		r.Files = append(r.Files, &corruptedFileResponse{
+			ID:        f.ID,
+			Media:     f.Media.Slug,
+			Episode:   f.Episode,
+			Path:      f.Path,
+			Expected:  f.CRCExpected,
+			Actual:    f.CRCActual,
+			CheckedAt: f.CRCCheckedAt,
+		})
+	}
+	r.FilesCount = count
+	return r
+}
+
+func streamPath(fileID uint) string {
+	return "/api/files/" + strconv.FormatUint(uint64(fileID), 10) + "/stream"
+}
+
+var playlistEscaper = strings.NewReplacer("\r", " ", "\n", " ")
+
+// newPlaylist renders an extended M3U playlist with one stream URL per episode
+// signed for userID, starting at episode start. When an episode has several files the
+// one with the highest resolution is used.
+func newPlaylist(m *model.Media, files []model.MediaFile, start int, baseURL string, userID uint, expires time.Time) []byte {
+	title := playlistEscaper.Replace(m.Title)
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#PLAYLIST:" + title + "\n")
+	for i := 0; i < len(files); {
+		best := &files[i]
+		for ; i < len(files) && files[i].Episode == best.Episode; i++ {
+			if files[i].Height > best.Height {
+				best = &files[i]
+			}
+		}
+		if best.Episode < start {
+			continue
+		}
+		duration := int(math.Round(best.Duration))
+		if duration == 0 {
+			duration = -1
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s - Episode %d\n", duration, title, best.Episode)
+		b.WriteString(baseURL + utils.SignURL(streamPath(best.ID), userID, expires) + "\n")
+	}
+	return b.Bytes()
+}
+
+type streamUsageResponse struct {
+	// Username is empty for streams opened with links not bound to a user.
+	Username string    `json:"username"`
+	Files    []uint    `json:"files"`
+	Sent     int64     `json:"sent"`
+	Since    time.Time `json:"since"`
+	Rate     int64     `json:"rate"`
+}
+
+type streamUsageListResponse struct {
+	Streams []*streamUsageResponse `json:"streams"`
+}
+
+func newStreamUsageListResponse(usage []throttle.Usage, users map[uint]*model.User) *streamUsageListResponse {
+	r := new(streamUsageListResponse)
+	r.Streams = make([]*streamUsageResponse, 0, len(usage))
+	for _, u := range usage {
+		sr := &streamUsageResponse{Files: u.Files, Sent: u.Sent, Since: u.Since, Rate: u.Rate}
+		if user := users[u.UserID]; user != nil {
+			sr.Username = user.Username
+		}
+		r.Streams = append(r.Streams, sr)
+	}
+	return r
+}
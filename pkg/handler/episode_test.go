@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// streamFixture adds a media with one linked episode file and returns the
+// routes with it.
+func streamFixture(t *testing.T) (*echo.Echo, *model.MediaFile) {
+	dir, err := ioutil.TempDir("", "kitsu-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "media1 - 01.mkv")
+	if err := ioutil.WriteFile(path, []byte("episode 1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := model.Media{
+		Content:  model.Content{Slug: "media1-slug", Title: "media1 title", AuthorID: 1},
+		Episodes: 1,
+	}
+	if err := ms.CreateMedia(&m); err != nil {
+		t.Fatal(err)
+	}
+	f := model.MediaFile{MediaID: m.ID, Episode: 1, Path: path, Size: 9}
+	if err := ls.CreateFile(&f); err != nil {
+		t.Fatal(err)
+	}
+
+	return routes(), &f
+}
+
+func TestPlaylistCaseAnonymous(t *testing.T) {
+	tearDown()
+	setup()
+	r, _ := streamFixture(t)
+	rec := request(r, echo.GET, "/api/medias/media1-slug/playlist.m3u8", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestPlaylistCaseSuccess(t *testing.T) {
+	tearDown()
+	setup()
+	r, _ := streamFixture(t)
+	rec := request(r, echo.GET, "/api/medias/media1-slug/playlist.m3u8", sessionToken(1))
+	if !assert.Equal(t, http.StatusOK, rec.Code) {
+		return
+	}
+
+	var link string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "http://") {
+			link = strings.TrimPrefix(line, "http://example.com")
+		}
+	}
+	if assert.Contains(t, link, "uid=1") {
+		rec = request(r, echo.GET, link, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "episode 1", rec.Body.String())
+	}
+}
+
+func TestStreamFileCaseAnonymous(t *testing.T) {
+	tearDown()
+	setup()
+	r, f := streamFixture(t)
+	path := streamPath(f.ID)
+
+	rec := request(r, echo.GET, path, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Links without a user do not authorize anything.
+	rec = request(r, echo.GET, utils.SignURL(path, 0, time.Now().Add(time.Hour)), "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = request(r, echo.GET, utils.SignURL(path, 1, time.Now().Add(time.Hour)), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestStreamFileCaseNoUser(t *testing.T) {
+	tearDown()
+	setup()
+	_, f := streamFixture(t)
+	req := httptest.NewRequest(echo.GET, streamPath(f.ID), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/api/files/:id/stream")
+	c.SetParamNames("id")
+	c.SetParamValues(strconv.FormatUint(uint64(f.ID), 10))
+	assert.NoError(t, h.StreamFile(c))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestCorruptedFilesCaseOrphaned(t *testing.T) {
+	tearDown()
+	setup()
+	_, f := streamFixture(t)
+	gone := model.MediaFile{MediaID: f.MediaID, Episode: 1, Path: "/library/gone - 01 [00000000].mkv"}
+	assert.NoError(t, ls.CreateFile(&gone))
+	for _, mf := range []*model.MediaFile{f, &gone} {
+		mf.CRCState = model.CRCMismatch
+		assert.NoError(t, ls.SaveChecksum(mf))
+	}
+	now := time.Now()
+	gone.OrphanedAt = &now
+	assert.NoError(t, ls.UpdateFile(&gone))
+
+	req := httptest.NewRequest(echo.GET, "/api/admin/files/corrupted", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.CorruptedFiles(e.NewContext(req, rec)))
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var r corruptedFileListResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		assert.Equal(t, 1, r.FilesCount)
+		if assert.Len(t, r.Files, 1) {
+			assert.Equal(t, f.ID, r.Files[0].ID)
+		}
+	}
+}
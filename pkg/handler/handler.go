@@ -1,21 +1,80 @@
 package handler
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"github.com/xenking/kitsu-media-server/pkg/article"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/mail"
 	"github.com/xenking/kitsu-media-server/pkg/media"
+	"github.com/xenking/kitsu-media-server/pkg/oidc"
+	"github.com/xenking/kitsu-media-server/pkg/ratelimit"
+	"github.com/xenking/kitsu-media-server/pkg/scrobble"
+	"github.com/xenking/kitsu-media-server/pkg/throttle"
 	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn"
 )
 
 type Handler struct {
 	userStore    user.Store
 	articleStore article.Store
 	mediaStore   media.Store
+	libraryStore library.Store
+	commentStore comment.Store
+
+	scrobbleResolver *scrobble.Resolver
+	streams          *throttle.Limiter
+	seen             *user.Seen
+	tokensUsed       *user.Seen
+	mailer           mail.Mailer
+	relyingParty     *webauthn.RelyingParty
+	rateLimits       ratelimit.Store
+	oidcProviders    []*oidc.Provider
 }
 
-func NewHandler(us user.Store, as article.Store, ms media.Store) *Handler {
-	return &Handler{
+// rateLimitSweep is how often full rate limit buckets are forgotten.
+const rateLimitSweep = time.Minute
+
+func NewHandler(us user.Store, as article.Store, ms media.Store, ls library.Store, cs comment.Store) *Handler {
+	h := &Handler{
 		userStore:    us,
 		articleStore: as,
 		mediaStore:   ms,
+		libraryStore: ls,
+		commentStore: cs,
+
+		scrobbleResolver: scrobble.NewResolver(ls, library.NewMatcher(ms)),
+		streams:          throttle.New(config.Global.StreamLimits),
+		seen:             user.NewSeen(us.TouchSessions, config.Global.SeenInterval),
+		tokensUsed:       user.NewSeen(us.TouchAccessTokens, config.Global.SeenInterval),
+		mailer:           mail.New(config.Global.Mail),
+		relyingParty:     webauthn.New(config.Global.WebAuthn),
+		rateLimits:       ratelimit.NewMemory(),
+		oidcProviders:    newOIDCProviders(config.Global.OIDCProviders),
 	}
+	h.streams.SetRoles(func(userID uint) []string {
+		roles, err := us.ListRoles(userID)
+		if err != nil {
+			log.Println("throttle:", err)
+		}
+		return roles
+	})
+	return h
+}
+
+// SetRateLimitStore replaces the in-memory rate limits, e.g. with a store
+// shared by several instances. It must be called before Register.
+func (h *Handler) SetRateLimitStore(s ratelimit.Store) {
+	h.rateLimits = s
+}
+
+// Run does the background work of the handlers until ctx is done.
+func (h *Handler) Run(ctx context.Context) {
+	go h.tokensUsed.Run(ctx)
+	go ratelimit.Run(ctx, h.rateLimits, rateLimitSweep)
+	h.seen.Run(ctx)
 }
@@ -3,8 +3,11 @@ package handler
 import (
 	"github.com/xenking/kitsu-media-server/pkg/media"
 	"log"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"encoding/json"
 
@@ -12,11 +15,15 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/labstack/echo/v4"
 	"github.com/xenking/kitsu-media-server/pkg/article"
+	"github.com/xenking/kitsu-media-server/pkg/config"
 	"github.com/xenking/kitsu-media-server/pkg/db"
+	"github.com/xenking/kitsu-media-server/pkg/keyset"
+	"github.com/xenking/kitsu-media-server/pkg/library"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 	"github.com/xenking/kitsu-media-server/pkg/router"
 	"github.com/xenking/kitsu-media-server/pkg/store"
 	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
 )
 
 var (
@@ -24,6 +31,7 @@ var (
 	us user.Store
 	as article.Store
 	ms media.Store
+	ls library.Store
 	h  *Handler
 	e  *echo.Echo
 )
@@ -39,13 +47,26 @@ func authHeader(token string) string {
 	return "Token " + token
 }
 
+// sessionToken returns an access token of a new session of userID, for
+// requests that go through the revocation check of the router.
+func sessionToken(userID uint) string {
+	s := &model.Session{UserID: userID, LastSeenAt: time.Now()}
+	if err := us.CreateSession(s); err != nil {
+		log.Fatal(err)
+	}
+	return utils.GenerateJWT(userID, s.ID)
+}
+
 func setup() {
+	config.Global.JWTKeys, _ = keyset.New(keyset.Options{Alg: keyset.HS256, Secret: []byte("a test secret of at least 32 bytes")})
+	config.Global.LinkKeys = []config.LinkKey{{ID: "test", Secret: []byte("link secret")}}
 	d = db.TestDB()
 	db.AutoMigrate(d)
 	us = store.NewUserStore(d)
 	as = store.NewArticleStore(d)
 	ms = store.NewMediaStore(d)
-	h = NewHandler(us, as, ms)
+	ls = store.NewLibraryStore(d)
+	h = NewHandler(us, as, ms, ls, store.NewCommentStore(d))
 	e = router.New()
 	loadFixtures()
 }
@@ -57,6 +78,31 @@ func tearDown() {
 	}
 }
 
+func request(r *echo.Echo, method, target, token string) *httptest.ResponseRecorder {
+	return requestJSON(r, method, target, token, "")
+}
+
+// requestJSON is request with body as the JSON payload.
+func requestJSON(r *echo.Echo, method, target, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, authHeader(token))
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// routes returns an echo with all routes, for tests of the middleware.
+func routes() *echo.Echo {
+	r := router.New()
+	h.Register(r.Group("/api"))
+	return r
+}
+
 func responseMap(b []byte, key string) map[string]interface{} {
 	var m map[string]interface{}
 	json.Unmarshal(b, &m)
@@ -93,10 +139,10 @@ func loadFixtures() error {
 
 	a := model.Article{
 		Content: model.Content{
-			Slug:        "article1-slug",
-			Title:       "article1 title",
+			Slug:     "article1-slug",
+			Title:    "article1 title",
 			Author:   model.User{},
-			AuthorID:    1,
+			AuthorID: 1,
 		},
 
 		Description: "article1 description",
@@ -112,17 +158,16 @@ func loadFixtures() error {
 	}
 	as.CreateArticle(&a)
 	as.AddComment(&a, &model.Comment{
-		Body:      "article1 comment1",
-		ArticleID: 1,
-		UserID:    1,
+		Body:   "article1 comment1",
+		UserID: 1,
 	})
 
 	a2 := model.Article{
 		Content: model.Content{
-			Slug:        "article2-slug",
-			Title:       "article2 title",
+			Slug:     "article2-slug",
+			Title:    "article2 title",
 			Author:   model.User{},
-			AuthorID:    2,
+			AuthorID: 2,
 		},
 		Description: "article2 description",
 		Body:        "article2 body",
@@ -137,9 +182,8 @@ func loadFixtures() error {
 	}
 	as.CreateArticle(&a2)
 	as.AddComment(&a2, &model.Comment{
-		Body:      "article2 comment1 by user1",
-		ArticleID: 2,
-		UserID:    1,
+		Body:   "article2 comment1 by user1",
+		UserID: 1,
 	})
 	as.AddFavorite(&a2, 1)
 
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var (
+	errRegistrationClosed = errors.New("registration is closed")
+	errInviteRequired     = errors.New("registration needs an invite")
+	errInviteInvalid      = errors.New("invalid, expired or used up invite")
+)
+
+// useInvite counts a registration with code. It returns nil for codes
+// that cannot be used.
+func (h *Handler) useInvite(code string) (*model.Invite, error) {
+	return h.userStore.UseInvite(utils.HashToken(code), time.Now())
+}
+
+// Registration godoc
+// @Summary Registration mode
+// @Description Tell whether anybody can sign up, only people with an invite, or nobody
+// @ID registration
+// @Tags user
+// @Produce  json
+// @Success 200 {object} registrationResponse
+// @Router /registration [get]
+func (h *Handler) Registration(c echo.Context) error {
+	return c.JSON(http.StatusOK, newRegistrationResponse())
+}
+
+// Invites godoc
+// @Summary List own invites
+// @Description List the invites the current user created, with the users who registered with them. Auth is required
+// @ID invites
+// @Tags user
+// @Produce  json
+// @Success 200 {object} inviteListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/invites [get]
+func (h *Handler) Invites(c echo.Context) error {
+	invites, err := h.userStore.ListInvites(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newInviteListResponse(invites))
+}
+
+// AllInvites godoc
+// @Summary List all invites
+// @Description List the invites of every user, with who created them and who registered with them. Auth is required, the user must be able to manage invites
+// @ID all-invites
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} inviteListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/invites [get]
+func (h *Handler) AllInvites(c echo.Context) error {
+	invites, err := h.userStore.ListInvites(0)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newInviteListResponse(invites))
+}
+
+// CreateInvite godoc
+// @Summary Create an invite
+// @Description Create an invite code for people to register with. The code is only shown in this response. Auth is required, the user needs one of the inviter roles
+// @ID create-invite
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param invite body inviteCreateRequest true "Uses, expiry and a note"
+// @Success 201 {object} singleInviteResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/invites [post]
+func (h *Handler) CreateInvite(c echo.Context) error {
+	roles := rolesFromToken(c)
+	if !user.CanInvite(roles, config.Global.InviterRoles) && !user.Can(roles, user.PermInvitesManage) {
+		return c.JSON(http.StatusForbidden, utils.AccessForbidden())
+	}
+
+	req := &inviteCreateRequest{}
+	if err := req.bind(c, user.Can(roles, user.PermInvitesManage)); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	code, err := utils.NewToken(12)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	i := &model.Invite{
+		CreatorID: userIDFromToken(c),
+		Hash:      utils.HashToken(code),
+		Note:      req.Invite.Note,
+		MaxUses:   req.Invite.MaxUses,
+		ExpiresAt: req.Invite.ExpiresAt,
+	}
+	if err := h.userStore.CreateInvite(i); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newSingleInviteResponse(i, code))
+}
+
+// RevokeInvite godoc
+// @Summary Revoke an invite
+// @Description Stop an invite from being used. Users who registered with it stay. Auth is required, only its creator or users who manage invites can revoke it
+// @ID revoke-invite
+// @Tags user
+// @Produce  json
+// @Param id path integer true "ID of the invite"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/invites/{id} [delete]
+func (h *Handler) RevokeInvite(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	i, err := h.userStore.GetInvite(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if i == nil || (i.CreatorID != userIDFromToken(c) && !user.Can(rolesFromToken(c), user.PermInvitesManage)) {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if err := h.userStore.RevokeInvite(i.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
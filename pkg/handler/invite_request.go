@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+type inviteCreateRequest struct {
+	Invite struct {
+		MaxUses int `json:"maxUses" validate:"min=0"`
+		// ExpiresAt defaults to REGISTRATION_INVITE_TTL from now.
+		ExpiresAt *time.Time `json:"expiresAt"`
+		Note      string     `json:"note" validate:"max=200"`
+	} `json:"invite"`
+}
+
+// bind applies the defaults. Users who cannot manage invites are held to
+// the configured limits.
+func (r *inviteCreateRequest) bind(c echo.Context, manager bool) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	now := time.Now()
+	if r.Invite.MaxUses == 0 {
+		r.Invite.MaxUses = 1
+	}
+	if r.Invite.ExpiresAt == nil {
+		expires := now.Add(config.Global.InviteTTL)
+		r.Invite.ExpiresAt = &expires
+	}
+	if !r.Invite.ExpiresAt.After(now) {
+		return errors.New("expiresAt must be in the future")
+	}
+	if !manager && (r.Invite.MaxUses > config.Global.InviteMaxUses || r.Invite.ExpiresAt.After(now.Add(config.Global.InviteTTL))) {
+		return fmt.Errorf("invites can have at most %d uses and expire within %s", config.Global.InviteMaxUses, config.Global.InviteTTL)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type registrationResponse struct {
+	Registration struct {
+		Mode string `json:"mode"`
+	} `json:"registration"`
+}
+
+func newRegistrationResponse() *registrationResponse {
+	r := new(registrationResponse)
+	r.Registration.Mode = config.Global.Registration
+	if r.Registration.Mode == "" {
+		r.Registration.Mode = config.RegistrationOpen
+	}
+	return r
+}
+
+type inviteResponse struct {
+	ID        uint       `json:"id"`
+	Code      string     `json:"code,omitempty"`
+	Note      string     `json:"note"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	Creator   string     `json:"creator,omitempty"`
+	Invitees  []string   `json:"invitees"`
+}
+
+func newInviteResponse(i *model.Invite) *inviteResponse {
+	r := &inviteResponse{
+		ID:        i.ID,
+		Note:      i.Note,
+		MaxUses:   i.MaxUses,
+		Uses:      i.Uses,
+		CreatedAt: i.CreatedAt,
+		ExpiresAt: i.ExpiresAt,
+		RevokedAt: i.RevokedAt,
+		Creator:   i.Creator.Username,
+		Invitees:  make([]string, 0, len(i.Invitees)),
+	}
+	for _, u := range i.Invitees {
+		r.Invitees = append(r.Invitees, u.Username)
+	}
+	return r
+}
+
+type singleInviteResponse struct {
+	Invite *inviteResponse `json:"invite"`
+}
+
+func newSingleInviteResponse(i *model.Invite, code string) *singleInviteResponse {
+	r := &singleInviteResponse{Invite: newInviteResponse(i)}
+	r.Invite.Code = code
+	return r
+}
+
+type inviteListResponse struct {
+	Invites      []*inviteResponse `json:"invites"`
+	InvitesCount int               `json:"invitesCount"`
+}
+
+func newInviteListResponse(invites []model.Invite) *inviteListResponse {
+	r := new(inviteListResponse)
+	r.Invites = make([]*inviteResponse, 0, len(invites))
+	for i := range invites {
+		r.Invites = append(r.Invites, newInviteResponse(&invites[i]))
+	}
+	r.InvitesCount = len(invites)
+	return r
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// registration sets the registration settings until the test ends.
+func registration(t *testing.T, mode string) {
+	oldMode, oldRoles := config.Global.Registration, config.Global.InviterRoles
+	oldUses, oldTTL := config.Global.InviteMaxUses, config.Global.InviteTTL
+	t.Cleanup(func() {
+		config.Global.Registration, config.Global.InviterRoles = oldMode, oldRoles
+		config.Global.InviteMaxUses, config.Global.InviteTTL = oldUses, oldTTL
+	})
+	config.Global.Registration = mode
+	config.Global.InviterRoles = []string{user.RoleAdmin}
+	config.Global.InviteMaxUses = 2
+	config.Global.InviteTTL = time.Hour
+}
+
+// createInvite stores an invite of user 1 and returns its code.
+func createInvite(i *model.Invite) string {
+	code, _ := utils.NewToken(12)
+	i.CreatorID = 1
+	i.Hash = utils.HashToken(code)
+	if err := us.CreateInvite(i); err != nil {
+		log.Fatal(err)
+	}
+	return code
+}
+
+func signUp(username, invite string) int {
+	body := `{"user":{"username":"` + username + `","email":"` + username + `@realworld.io","password":"secret","invite":"` + invite + `"}}`
+	return requestJSON(routes(), http.MethodPost, "/api/register", "", body).Code
+}
+
+func TestSignUpCaseClosed(t *testing.T) {
+	tearDown()
+	setup()
+	registration(t, config.RegistrationClosed)
+	code := createInvite(&model.Invite{MaxUses: 1})
+
+	assert.Equal(t, http.StatusForbidden, signUp("alice", ""))
+	assert.Equal(t, http.StatusForbidden, signUp("alice", code))
+	u, err := us.GetByUsername("alice")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestSignUpCaseInviteOnly(t *testing.T) {
+	tearDown()
+	setup()
+	registration(t, config.RegistrationInviteOnly)
+	code := createInvite(&model.Invite{MaxUses: 1})
+
+	assert.Equal(t, http.StatusForbidden, signUp("alice", ""))
+	assert.Equal(t, http.StatusForbidden, signUp("alice", "not an invite"))
+	assert.Equal(t, http.StatusCreated, signUp("alice", code))
+	u, err := us.GetByUsername("alice")
+	assert.NoError(t, err)
+	if assert.NotNil(t, u) && assert.NotNil(t, u.InviteID) {
+		assert.Equal(t, uint(1), *u.InvitedByID)
+		i, _ := us.GetInvite(*u.InviteID)
+		assert.Equal(t, 1, i.Uses)
+	}
+}
+
+func TestUseInviteCaseUnusable(t *testing.T) {
+	tearDown()
+	setup()
+	registration(t, config.RegistrationInviteOnly)
+	past := time.Now().Add(-time.Minute)
+	usedUp := createInvite(&model.Invite{MaxUses: 1})
+	expired := createInvite(&model.Invite{MaxUses: 1, ExpiresAt: &past})
+	revoked := createInvite(&model.Invite{MaxUses: 1})
+	i, _ := h.useInvite(revoked)
+	assert.NoError(t, us.ReleaseInvite(i.ID))
+	assert.NoError(t, us.RevokeInvite(i.ID))
+
+	assert.Equal(t, http.StatusCreated, signUp("alice", usedUp))
+	assert.Equal(t, http.StatusForbidden, signUp("bob", usedUp))
+	assert.Equal(t, http.StatusForbidden, signUp("bob", expired))
+	assert.Equal(t, http.StatusForbidden, signUp("bob", revoked))
+	u, _ := us.GetByUsername("bob")
+	assert.Nil(t, u)
+}
+
+func TestSignUpCaseReleaseInvite(t *testing.T) {
+	tearDown()
+	setup()
+	registration(t, config.RegistrationInviteOnly)
+	code := createInvite(&model.Invite{MaxUses: 1})
+
+	// The username is taken, the invite keeps its use.
+	assert.Equal(t, http.StatusUnprocessableEntity, signUp("user1", code))
+	i, _ := us.GetInvite(1)
+	assert.Equal(t, 0, i.Uses)
+	assert.Equal(t, http.StatusCreated, signUp("alice", code))
+}
+
+func TestCreateInviteCaseLimits(t *testing.T) {
+	tearDown()
+	setup()
+	registration(t, config.RegistrationInviteOnly)
+	config.Global.InviterRoles = []string{user.RoleMember}
+	r := routes()
+	token := sessionToken(2)
+	create := func(token, body string) int {
+		return requestJSON(r, http.MethodPost, "/api/user/invites", token, body).Code
+	}
+	later := time.Now().Add(2 * time.Hour).Format(time.RFC3339)
+
+	// Users who cannot manage invites are held to the limits.
+	assert.Equal(t, http.StatusUnprocessableEntity, create(token, `{"invite":{"maxUses":3}}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, create(token, `{"invite":{"expiresAt":"`+later+`"}}`))
+	assert.Equal(t, http.StatusCreated, create(token, `{"invite":{"maxUses":2}}`))
+	invites, err := us.ListInvites(2)
+	assert.NoError(t, err)
+	if assert.Len(t, invites, 1) {
+		assert.Equal(t, 2, invites[0].MaxUses)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *invites[0].ExpiresAt, time.Minute)
+	}
+
+	// Managers are not.
+	s := &model.Session{UserID: 1, LastSeenAt: time.Now()}
+	assert.NoError(t, us.CreateSession(s))
+	admin := utils.GenerateJWT(1, s.ID, user.RoleAdmin)
+	assert.Equal(t, http.StatusCreated, create(admin, `{"invite":{"maxUses":10,"expiresAt":"`+later+`"}}`))
+}
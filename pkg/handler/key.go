@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description List the public keys access tokens can be verified with, for other services. Empty while tokens are signed with HS256. Served at /.well-known/jwks.json
+// @ID jwks
+// @Tags keys
+// @Produce  json
+// @Success 200 {object} jwksResponse
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, newJWKSResponse(config.Global.JWTKeys.JWKS()))
+}
@@ -0,0 +1,11 @@
+package handler
+
+import "github.com/xenking/kitsu-media-server/pkg/keyset"
+
+type jwksResponse struct {
+	Keys []keyset.JWK `json:"keys"`
+}
+
+func newJWKSResponse(keys []keyset.JWK) *jwksResponse {
+	return &jwksResponse{Keys: keys}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// CreateSignedLink godoc
+// @Summary Create a signed link
+// @Description Sign a link to an API path for the current user, for players, image tags and other clients that cannot send an Authorization header. Only GET requests to routes that accept signed links are authorized by it. Auth is required
+// @ID create-signed-link
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param link body signedLinkRequest true "Path to sign"
+// @Success 201 {object} signedLinkResponse
+// @Failure 401 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/links [post]
+func (h *Handler) CreateSignedLink(c echo.Context) error {
+	req := &signedLinkRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	expires := time.Now().Add(config.Global.LinkTTL)
+	url := c.Scheme() + "://" + c.Request().Host + utils.SignURL(req.Link.Path, userIDFromToken(c), expires)
+	return c.JSON(http.StatusCreated, newSignedLinkResponse(url, expires))
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type signedLinkRequest struct {
+	Link struct {
+		Path string `json:"path" validate:"required"`
+	} `json:"link"`
+}
+
+func (r *signedLinkRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(r.Link.Path, "/api/") || strings.ContainsAny(r.Link.Path, "?#") {
+		return errors.New("path must be an API path without a query")
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package handler
+
+import "time"
+
+type signedLinkResponse struct {
+	Link struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	} `json:"link"`
+}
+
+func newSignedLinkResponse(url string, expires time.Time) *signedLinkResponse {
+	r := new(signedLinkResponse)
+	r.Link.URL = url
+	r.Link.ExpiresAt = expires
+	return r
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/lockout"
+	"github.com/xenking/kitsu-media-server/pkg/mail"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var errTooManyLogins = errors.New("too many failed logins, try again later")
+
+// loginKey is an account or a network failed logins are counted for.
+type loginKey struct {
+	key    string
+	userID uint
+	policy lockout.Policy
+}
+
+func userLoginKey(userID uint) string {
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// loginKeys returns the keys of a login to the account of u, or of email
+// when there is no such user, from the network of c. The account comes
+// first. The address of c is what router.IPExtractor trusts, a client
+// cannot pick it to dodge a lock or to lock out someone else.
+func loginKeys(c echo.Context, u *model.User, email string) []loginKey {
+	account := loginKey{key: "email:" + strings.ToLower(email), policy: config.Global.AccountLockout}
+	if u != nil {
+		account.key = userLoginKey(u.ID)
+		account.userID = u.ID
+	}
+	network := loginKey{
+		key:    "ip:" + lockout.Subnet(c.RealIP(), config.Global.LoginIPv4Bits, config.Global.LoginIPv6Bits),
+		policy: config.Global.IPLockout,
+	}
+	return []loginKey{account, network}
+}
+
+// loginWait returns how long a login with keys has to wait.
+func (h *Handler) loginWait(keys []loginKey) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, k := range keys {
+		t, err := h.userStore.GetLoginThrottle(k.key)
+		if err != nil {
+			return 0, err
+		}
+		if t == nil {
+			continue
+		}
+		if w := k.policy.Wait(&t.State, now); w > wait {
+			wait = w
+		}
+	}
+	return wait, nil
+}
+
+// loginFailed counts a failed login for keys. The user is told by mail when
+// it locked their account.
+func (h *Handler) loginFailed(c echo.Context, u *model.User, keys []loginKey, reason string) error {
+	now := time.Now()
+	for i, k := range keys {
+		t, locked, err := h.userStore.FailLogin(k.key, k.userID, k.policy, now)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			securityEvent(c, "login_failed", k.userID, fmt.Sprintf("reason=%q key=%s failures=%d", reason, k.key, t.Failures))
+		}
+		if !locked {
+			continue
+		}
+		securityEvent(c, "login_locked", k.userID, fmt.Sprintf("key=%s until=%s", k.key, t.LockedUntil.Format(time.RFC3339)))
+		if u != nil && k.userID == u.ID {
+			link, _ := resetLink(u)
+			h.sendMail(mail.TemplateLockout, u, mail.Data{Link: link, Expires: *t.LockedUntil, IP: c.RealIP()})
+		}
+	}
+	return nil
+}
+
+// loginSucceeded forgets the failures of the account. Those of the network
+// stay, an attacker could log in to an account of their own otherwise to
+// reset them.
+func (h *Handler) loginSucceeded(keys []loginKey) error {
+	_, err := h.userStore.DeleteLoginThrottle(keys[0].key)
+	return err
+}
+
+func tooManyLogins(c echo.Context, wait time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.JSON(http.StatusTooManyRequests, utils.NewError(errTooManyLogins))
+}
+
+// LoginLocks godoc
+// @Summary List login locks
+// @Description List the accounts and networks locked out after failed logins. Auth is required, the user must be able to unlock users
+// @ID login-locks
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} loginLockListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/login-locks [get]
+func (h *Handler) LoginLocks(c echo.Context) error {
+	locks, err := h.userStore.ListLoginLocks(time.Now())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newLoginLockListResponse(locks))
+}
+
+// ClearLoginLock godoc
+// @Summary Clear a login lock
+// @Description Unlock an account or a network and forget its failed logins. Auth is required, the user must be able to unlock users
+// @ID clear-login-lock
+// @Tags admin
+// @Produce  json
+// @Param key query string true "Key of the lock, e.g. user:42 or ip:203.0.113.0/24"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/login-locks [delete]
+func (h *Handler) ClearLoginLock(c echo.Context) error {
+	key := c.QueryParam("key")
+	found, err := h.userStore.DeleteLoginThrottle(key)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if !found {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	securityEvent(c, "login_lock_cleared", userIDFromToken(c), "key="+key)
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type loginLockResponse struct {
+	Key           string    `json:"key"`
+	UserID        uint      `json:"userId,omitempty"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"lastFailureAt"`
+	LockedUntil   time.Time `json:"lockedUntil"`
+}
+
+type loginLockListResponse struct {
+	Locks      []*loginLockResponse `json:"locks"`
+	LocksCount int                  `json:"locksCount"`
+}
+
+func newLoginLockListResponse(locks []model.LoginThrottle) *loginLockListResponse {
+	r := new(loginLockListResponse)
+	r.Locks = make([]*loginLockResponse, 0, len(locks))
+	for _, l := range locks {
+		lr := &loginLockResponse{
+			Key:           l.Key,
+			UserID:        l.UserID,
+			Failures:      l.Failures,
+			LastFailureAt: l.LastFailureAt,
+		}
+		if l.LockedUntil != nil {
+			lr.LockedUntil = *l.LockedUntil
+		}
+		r.Locks = append(r.Locks, lr)
+	}
+	r.LocksCount = len(locks)
+	return r
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/lockout"
+)
+
+// lockoutPolicies sets the lockout policies until the test ends.
+func lockoutPolicies(t *testing.T, account, ip lockout.Policy) {
+	oldAccount, oldIP := config.Global.AccountLockout, config.Global.IPLockout
+	oldV4, oldV6 := config.Global.LoginIPv4Bits, config.Global.LoginIPv6Bits
+	t.Cleanup(func() {
+		config.Global.AccountLockout, config.Global.IPLockout = oldAccount, oldIP
+		config.Global.LoginIPv4Bits, config.Global.LoginIPv6Bits = oldV4, oldV6
+	})
+	config.Global.AccountLockout, config.Global.IPLockout = account, ip
+	config.Global.LoginIPv4Bits, config.Global.LoginIPv6Bits = 24, 64
+}
+
+func TestLoginLockoutCaseSpoofedForwardedFor(t *testing.T) {
+	tearDown()
+	setup()
+	trustProxies(t)
+	lockoutPolicies(t, lockout.Policy{}, lockout.Policy{LockAfter: 3, LockDuration: time.Hour})
+	r := routes()
+
+	// Every attempt claims another address and tries another account.
+	for i := 0; i < 3; i++ {
+		xff := "203.0.113." + strconv.Itoa(i+1)
+		body := `{"user":{"email":"nobody` + strconv.Itoa(i) + `@realworld.io","password":"wrong"}}`
+		assert.Equal(t, http.StatusForbidden, login(r, "192.0.2.1", xff, body).Code)
+	}
+	body := `{"user":{"email":"user1@realworld.io","password":"secret"}}`
+	assert.Equal(t, http.StatusTooManyRequests, login(r, "192.0.2.1", "203.0.113.9", body).Code)
+
+	// The network the attempts claimed to come from is not locked.
+	assert.Equal(t, http.StatusOK, login(r, "203.0.113.1", "", body).Code)
+}
+
+func TestLoginLockoutCaseConcurrent(t *testing.T) {
+	tearDown()
+	setup()
+	const attempts = 8
+	lockoutPolicies(t, lockout.Policy{LockAfter: attempts, LockDuration: time.Hour}, lockout.Policy{})
+	r := routes()
+
+	// Failures at the same time all count.
+	body := `{"user":{"email":"user1@realworld.io","password":"wrong"}}`
+	var wg sync.WaitGroup
+	codes := make([]int, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = login(r, "192.0.2.1", "", body).Code
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		assert.Equal(t, http.StatusForbidden, code)
+	}
+	th, err := us.GetLoginThrottle(userLoginKey(1))
+	assert.NoError(t, err)
+	if assert.NotNil(t, th) {
+		assert.Equal(t, attempts, th.Failures)
+		assert.True(t, th.Locked(time.Now()))
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
 	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
 	"github.com/xenking/kitsu-media-server/pkg/utils"
 )
 
@@ -187,7 +189,7 @@ func (h *Handler) CreateMedia(c echo.Context) error {
 func (h *Handler) UpdateMedia(c echo.Context) error {
 	slug := c.Param("slug")
 
-	a, err := h.mediaStore.GetUserMediaBySlug(userIDFromToken(c), slug)
+	a, err := h.editableMedia(c, slug)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
@@ -227,7 +229,15 @@ func (h *Handler) UpdateMedia(c echo.Context) error {
 func (h *Handler) DeleteMedia(c echo.Context) error {
 	slug := c.Param("slug")
 
-	a, err := h.mediaStore.GetUserMediaBySlug(userIDFromToken(c), slug)
+	var (
+		a   *model.Media
+		err error
+	)
+	if user.Can(rolesFromToken(c), user.PermMediaDelete) {
+		a, err = h.mediaStore.GetBySlug(slug)
+	} else {
+		a, err = h.mediaStore.GetUserMediaBySlug(userIDFromToken(c), slug)
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
@@ -246,7 +256,7 @@ func (h *Handler) DeleteMedia(c echo.Context) error {
 
 // AddArticleComment godoc
 // @Summary Create a comment for an media
-// @Description Create a comment for an media. Auth is required
+// @Description Create a comment for an media, or a reply to one of its comments with parentId. Auth is required
 // @ID add-comment
 // @ArticleTags comment
 // @Accept  json
@@ -280,39 +290,52 @@ func (h *Handler) AddMediaComment(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
 	}
 
+	if req.Comment.ParentID != nil {
+		parent, err := h.mediaStore.GetComment(a, *req.Comment.ParentID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		if err := replyTo(&cm, parent); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+		}
+	}
+
 	if err = h.mediaStore.AddComment(a, &cm); err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
 
-	return c.JSON(http.StatusCreated, newCommentResponse(c, &cm))
+	return c.JSON(http.StatusCreated, newCommentResponse(c, &cm, false))
 }
 
 // GetArticleComments godoc
 // @Summary Get the comments for an media
-// @Description Get the comments for an media. Auth is optional
+// @Description Get a page of the comment threads of an media, each reply right after its parent with its depth. Auth is optional
 // @ID get-comments
 // @ArticleTags comment
 // @Accept  json
 // @Produce  json
 // @Param slug path string true "Slug of the media that you want to get comments for"
+// @Param sort query string false "Order of the threads: oldest, newest or liked" default(oldest)
+// @Param limit query integer false "Threads per page, at most 100" default(20)
+// @Param after query string false "Cursor of the next page"
+// @Param before query string false "Cursor of the previous page"
+// @Param around query integer false "ID of a comment whose thread to center the page on"
 // @Success 200 {object} commentListResponse
+// @Failure 404 {object} utils.Error
 // @Failure 422 {object} utils.Error
 // @Failure 500 {object} utils.Error
 // @Router /medias/{slug}/comments [get]
 func (h *Handler) GetMediaComments(c echo.Context) error {
 	slug := c.Param("slug")
 
-	cm, err := h.mediaStore.GetCommentsBySlug(slug)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
-	}
-
-	return c.JSON(http.StatusOK, newCommentListResponse(c, cm))
+	return h.commentList(c, func(q comment.Query) (*comment.Page, error) {
+		return h.mediaStore.GetCommentsBySlug(slug, q)
+	})
 }
 
 // DeleteArticleComment godoc
 // @Summary Delete a comment for an media
-// @Description Delete a comment for an media. Auth is required
+// @Description Delete a comment for an media. A comment with replies stays as [deleted] without its author. Auth is required
 // @ID delete-comments
 // @ArticleTags comment
 // @Accept  json
@@ -335,20 +358,29 @@ func (h *Handler) DeleteMediaComment(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, utils.NewError(err))
 	}
 
-	cm, err := h.mediaStore.GetCommentByID(id)
+	a, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if a == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	cm, err := h.mediaStore.GetComment(a, id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
 
-	if cm == nil {
+	if cm == nil || cm.Removed() {
 		return c.JSON(http.StatusNotFound, utils.NotFound())
 	}
 
-	if cm.UserID != userIDFromToken(c) {
+	if cm.UserID != userIDFromToken(c) && !user.Can(rolesFromToken(c), user.PermCommentsDelete) {
 		return c.JSON(http.StatusUnauthorized, utils.NewError(errors.New("unauthorized action")))
 	}
 
-	if err := h.mediaStore.DeleteComment(cm); err != nil {
+	if err := h.mediaStore.DeleteComment(a, cm); err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
 
@@ -447,3 +479,12 @@ func (h *Handler) MediaTags(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, newTagListResponse(tags))
 }
+
+// editableMedia returns the media of slug if the current user may edit it.
+// Authors may edit their own media and editors any media.
+func (h *Handler) editableMedia(c echo.Context, slug string) (*model.Media, error) {
+	if user.Can(rolesFromToken(c), user.PermMediaEdit) {
+		return h.mediaStore.GetBySlug(slug)
+	}
+	return h.mediaStore.GetUserMediaBySlug(userIDFromToken(c), slug)
+}
@@ -16,7 +16,7 @@ type mediaCreateRequest struct {
 		Type        string    `json:"type" validate:"required"`
 		AiringDate  time.Time `json:"airingDate"`
 		Poster      string    `json:"poster"`
-		Tags        []string  `json:"tagList, omitempty"`
+		Tags        []string  `json:"tagList,omitempty"`
 	} `json:"media"`
 }
 
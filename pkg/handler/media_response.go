@@ -23,6 +23,7 @@ type mediaResponse struct {
 	Poster         *string   `json:"poster"`
 	Favorited      bool      `json:"favorited"`
 	FavoritesCount int       `json:"favoritesCount"`
+	CommentsCount  int       `json:"commentsCount"`
 	Author         struct {
 		Username  string  `json:"username"`
 		Bio       *string `json:"bio"`
@@ -62,6 +63,7 @@ func newMediaResponse(c echo.Context, m *model.Media) *singleMediaResponse {
 		}
 	}
 	mr.FavoritesCount = len(m.Favorites)
+	mr.CommentsCount = m.CommentsCount
 	mr.Author.Username = m.Author.Username
 	mr.Author.Image = m.Author.Image
 	mr.Author.Bio = m.Author.Bio
@@ -94,6 +96,7 @@ func newMediaListResponse(us user.Store, userID uint, medias []model.Media, coun
 			}
 		}
 		mr.FavoritesCount = len(m.Favorites)
+		mr.CommentsCount = m.CommentsCount
 		mr.Author.Username = m.Author.Username
 		mr.Author.Image = m.Author.Image
 		mr.Author.Bio = m.Author.Bio
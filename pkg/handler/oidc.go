@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/oidc"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var (
+	errOIDCState          = errors.New("invalid or expired single sign-on state")
+	errOIDCEmail          = errors.New("the provider did not share a verified email address")
+	errOIDCEmailNotLinked = errors.New("an account with this email address exists; verify its address before logging in with the provider")
+)
+
+// usernameAttempts is how many numbered usernames are tried for a new
+// user before giving up.
+const usernameAttempts = 100
+
+func newOIDCProviders(configs []oidc.Config) []*oidc.Provider {
+	providers := make([]*oidc.Provider, 0, len(configs))
+	for _, cfg := range configs {
+		providers = append(providers, oidc.New(cfg))
+	}
+	return providers
+}
+
+func (h *Handler) oidcProvider(name string) *oidc.Provider {
+	for _, p := range h.oidcProviders {
+		if p.Config().Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// OIDCProviders godoc
+// @Summary List single sign-on providers
+// @Description List the OpenID Connect providers users can log in with
+// @ID oidc-providers
+// @Tags user
+// @Produce  json
+// @Success 200 {object} oidcProviderListResponse
+// @Router /login/oidc [get]
+func (h *Handler) OIDCProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, newOIDCProviderListResponse(h.oidcProviders))
+}
+
+// BeginOIDCLogin godoc
+// @Summary Start single sign-on
+// @Description Get the URL to send the user to for logging in with the provider. It redirects back to the web app with a code and the state, which the web app should check against the one returned here before finishing the login
+// @ID begin-oidc-login
+// @Tags user
+// @Produce  json
+// @Param provider path string true "Name of the provider"
+// @Success 200 {object} oidcAuthorizationResponse
+// @Failure 404 {object} utils.Error
+// @Failure 502 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /login/oidc/{provider} [post]
+func (h *Handler) BeginOIDCLogin(c echo.Context) error {
+	p := h.oidcProvider(c.Param("provider"))
+	if p == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	var tokens [3]string
+	for i := range tokens {
+		t, err := utils.NewToken(32)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		tokens[i] = t
+	}
+	state, nonce, verifier := tokens[0], tokens[1], tokens[2]
+
+	authURL, err := p.AuthURL(c.Request().Context(), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		log.Println("oidc:", err)
+		return c.JSON(http.StatusBadGateway, utils.NewError(err))
+	}
+
+	s := &model.OIDCState{
+		Hash:      utils.HashToken(state),
+		Provider:  p.Config().Name,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: time.Now().Add(config.Global.OIDCStateTTL),
+	}
+	if err := h.userStore.SaveOIDCState(s); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, &oidcAuthorizationResponse{AuthorizationURL: authURL, State: state})
+}
+
+// FinishOIDCLogin godoc
+// @Summary Finish single sign-on
+// @Description Log in with the code the provider redirected back with. The account linked to the provider account is used; otherwise the one with the same verified email address is linked, or a new one is created while registration is open. Roles mapped from the groups at the provider are granted or revoked. Users with two-factor authentication get a challenge for /login/2fa
+// @ID finish-oidc-login
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param provider path string true "Name of the provider"
+// @Param login body oidcCallbackRequest true "Code and state from the redirect"
+// @Success 200 {object} userResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /login/oidc/{provider}/callback [post]
+func (h *Handler) FinishOIDCLogin(c echo.Context) error {
+	p := h.oidcProvider(c.Param("provider"))
+	if p == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	req := &oidcCallbackRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	s, err := h.userStore.TakeOIDCState(utils.HashToken(req.State))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if s == nil || s.Provider != p.Config().Name {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errOIDCState))
+	}
+
+	claims, err := p.Exchange(c.Request().Context(), req.Code, s.Verifier, s.Nonce)
+	if err != nil {
+		log.Println("oidc:", err)
+		return c.JSON(http.StatusUnauthorized, utils.NewError(err))
+	}
+
+	u, status, err := h.oidcUser(c, p.Config().Name, claims)
+	if err != nil {
+		return c.JSON(status, utils.NewError(err))
+	}
+
+	if err := h.syncGroupRoles(c, u, p.Config(), claims.Groups); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	// Load the roles as they are now.
+	if u, err = h.userStore.GetByID(u.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errOIDCState))
+	}
+
+	if u.TwoFactorEnabled() {
+		return c.JSON(http.StatusOK, newTwoFactorChallengeResponse(u))
+	}
+	return h.startSession(c, http.StatusOK, u, false)
+}
+
+// oidcUser finds the user linked to the provider account of claims. An
+// unlinked account is linked to the user with its email address, or to a
+// new user. Both need the provider to have verified the address, and an
+// existing user must have verified it too, or whoever registered the
+// address first would get the account of its owner. New users are only
+// created while registration is open, as there is no invite to check.
+func (h *Handler) oidcUser(c echo.Context, provider string, claims *oidc.Claims) (*model.User, int, error) {
+	now := time.Now()
+	i, err := h.userStore.GetOIDCIdentity(provider, claims.Subject)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if i != nil {
+		u, err := h.userStore.GetByID(i.UserID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if u == nil {
+			return nil, http.StatusUnauthorized, errOIDCState
+		}
+		if err := h.userStore.TouchOIDCIdentity(i.ID, now); err != nil {
+			log.Println("oidc:", err)
+		}
+		return u, http.StatusOK, nil
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, http.StatusForbidden, errOIDCEmail
+	}
+
+	u, err := h.userStore.GetByEmail(claims.Email)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if u != nil && !u.EmailVerified() {
+		return nil, http.StatusConflict, errOIDCEmailNotLinked
+	}
+
+	if u == nil {
+		switch config.Global.Registration {
+		case config.RegistrationClosed:
+			return nil, http.StatusForbidden, errRegistrationClosed
+		case config.RegistrationInviteOnly:
+			return nil, http.StatusForbidden, errInviteRequired
+		}
+		if u, err = h.createOIDCUser(claims, now); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+		securityEvent(c, "oidc_signup", u.ID, "provider="+provider)
+	}
+
+	i = &model.OIDCIdentity{
+		UserID:     u.ID,
+		Provider:   provider,
+		Subject:    claims.Subject,
+		Email:      claims.Email,
+		LastUsedAt: &now,
+	}
+	if err := h.userStore.CreateOIDCIdentity(i); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	securityEvent(c, "oidc_link", u.ID, "provider="+provider)
+	return u, http.StatusOK, nil
+}
+
+// createOIDCUser creates a user for claims. The password is random, the
+// user can set one with a password reset.
+func (h *Handler) createOIDCUser(claims *oidc.Claims, now time.Time) (*model.User, error) {
+	secret, err := utils.NewToken(32)
+	if err != nil {
+		return nil, err
+	}
+	u := &model.User{Email: claims.Email, EmailVerifiedAt: &now}
+	if u.Password, err = u.HashPassword(secret); err != nil {
+		return nil, err
+	}
+	if u.Username, err = h.freeUsername(claims); err != nil {
+		return nil, err
+	}
+	if err := h.userStore.Create(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// freeUsername picks a username from the preferred username, the email
+// address or the name in claims, numbered when taken.
+func (h *Handler) freeUsername(claims *oidc.Claims) (string, error) {
+	base := ""
+	for _, s := range []string{claims.PreferredUsername, strings.SplitN(claims.Email, "@", 2)[0], claims.Name} {
+		if base = usernameFrom(s); base != "" {
+			break
+		}
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	name := base
+	for n := 2; n < usernameAttempts+2; n++ {
+		u, err := h.userStore.GetByUsername(name)
+		if err != nil {
+			return "", err
+		}
+		if u == nil {
+			return name, nil
+		}
+		name = base + strconv.Itoa(n)
+	}
+	return "", errors.New("no free username for " + base)
+}
+
+// usernameFrom keeps the letters, digits, dots, dashes and underscores of s.
+func usernameFrom(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// syncGroupRoles grants and revokes the roles cfg maps from the groups of
+// the user at the provider.
+func (h *Handler) syncGroupRoles(c echo.Context, u *model.User, cfg oidc.Config, groups []string) error {
+	if len(cfg.Roles) == 0 {
+		return nil
+	}
+	roles, err := h.userStore.ListRoles(u.ID)
+	if err != nil {
+		return err
+	}
+	add, remove := user.GroupRoles(roles, groups, cfg.Roles)
+	for _, role := range add {
+		if err := h.userStore.AddRole(u.ID, role); err != nil {
+			return err
+		}
+		securityEvent(c, "role_granted", u.ID, "role="+role+" provider="+cfg.Name)
+	}
+	for _, role := range remove {
+		if err := h.userStore.RemoveRole(u.ID, role); err != nil {
+			return err
+		}
+		securityEvent(c, "role_revoked", u.ID, "role="+role+" provider="+cfg.Name)
+	}
+	return nil
+}
+
+// OIDCIdentities godoc
+// @Summary List linked provider accounts
+// @Description List the single sign-on accounts linked to the current user. Auth is required
+// @ID oidc-identities
+// @Tags user
+// @Produce  json
+// @Success 200 {object} oidcIdentityListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/oidc [get]
+func (h *Handler) OIDCIdentities(c echo.Context) error {
+	identities, err := h.userStore.ListOIDCIdentities(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newOIDCIdentityListResponse(identities))
+}
+
+// DeleteOIDCIdentity godoc
+// @Summary Unlink a provider account
+// @Description Stop logging in with a single sign-on account. Logging in with it again links it anew by email address. Auth is required
+// @ID delete-oidc-identity
+// @Tags user
+// @Produce  json
+// @Param id path integer true "ID of the linked account"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/oidc/{id} [delete]
+func (h *Handler) DeleteOIDCIdentity(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	identities, err := h.userStore.ListOIDCIdentities(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	for i := range identities {
+		if identities[i].ID != uint(id64) {
+			continue
+		}
+		if err := h.userStore.DeleteOIDCIdentity(&identities[i]); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		securityEvent(c, "oidc_unlink", identities[i].UserID, "provider="+identities[i].Provider)
+		return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+	}
+
+	return c.JSON(http.StatusNotFound, utils.NotFound())
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/oidc"
+)
+
+type oidcProviderListResponse struct {
+	Providers []string `json:"providers"`
+}
+
+func newOIDCProviderListResponse(providers []*oidc.Provider) *oidcProviderListResponse {
+	r := &oidcProviderListResponse{Providers: make([]string, 0, len(providers))}
+	for _, p := range providers {
+		r.Providers = append(r.Providers, p.Config().Name)
+	}
+	return r
+}
+
+type oidcAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+type oidcIdentityResponse struct {
+	ID         uint       `json:"id"`
+	Provider   string     `json:"provider"`
+	Email      string     `json:"email"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type oidcIdentityListResponse struct {
+	Identities      []*oidcIdentityResponse `json:"identities"`
+	IdentitiesCount int                     `json:"identitiesCount"`
+}
+
+func newOIDCIdentityListResponse(identities []model.OIDCIdentity) *oidcIdentityListResponse {
+	r := new(oidcIdentityListResponse)
+	r.Identities = make([]*oidcIdentityResponse, 0, len(identities))
+	for _, i := range identities {
+		r.Identities = append(r.Identities, &oidcIdentityResponse{
+			ID:         i.ID,
+			Provider:   i.Provider,
+			Email:      i.Email,
+			CreatedAt:  i.CreatedAt,
+			LastUsedAt: i.LastUsedAt,
+		})
+	}
+	r.IdentitiesCount = len(identities)
+	return r
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/oidc"
+)
+
+func TestOIDCUserCaseRegistration(t *testing.T) {
+	tearDown()
+	setup()
+	defer func() { config.Global.Registration = "" }()
+	c := e.NewContext(httptest.NewRequest(echo.POST, "/api/login/oidc/test/callback", nil), httptest.NewRecorder())
+	claims := &oidc.Claims{Subject: "new", Email: "new@example.com", EmailVerified: true, PreferredUsername: "new"}
+
+	for mode, want := range map[string]error{
+		config.RegistrationClosed:     errRegistrationClosed,
+		config.RegistrationInviteOnly: errInviteRequired,
+	} {
+		config.Global.Registration = mode
+		u, status, err := h.oidcUser(c, "test", claims)
+		assert.Nil(t, u, mode)
+		assert.Equal(t, http.StatusForbidden, status, mode)
+		assert.Equal(t, want, err, mode)
+	}
+
+	config.Global.Registration = config.RegistrationOpen
+	u, status, err := h.oidcUser(c, "test", claims)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.NotNil(t, u) {
+		assert.Equal(t, "new", u.Username)
+	}
+
+	// Accounts that are linked already keep logging in.
+	config.Global.Registration = config.RegistrationClosed
+	linked, status, err := h.oidcUser(c, "test", claims)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.NotNil(t, linked) {
+		assert.Equal(t, u.ID, linked.ID)
+	}
+}
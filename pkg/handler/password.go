@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/mail"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// resetState changes with the password and the address, so a reset link
+// dies with the password and proves only the address it was mailed to.
+func resetState(u *model.User) string {
+	return u.Password + ":" + u.Email
+}
+
+// resetLink returns a link to reset the password of u and its expiry.
+func resetLink(u *model.User) (string, time.Time) {
+	expires := time.Now().Add(config.Global.ResetTTL)
+	token := utils.NewActionToken(utils.ActionResetPassword, u.ID, resetState(u), expires)
+	return config.Global.MailLinkURL + "/reset-password?token=" + url.QueryEscape(token), expires
+}
+
+// ForgotPassword godoc
+// @Summary Ask for a password reset
+// @Description Mail a link to reset the password to the address, if it belongs to a user. The response is the same either way
+// @ID forgot-password
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param email body forgotPasswordRequest true "Email address of the account"
+// @Success 202 {object} map[string]interface{}
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /password/forgot [post]
+func (h *Handler) ForgotPassword(c echo.Context) error {
+	req := &forgotPasswordRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByEmail(req.Email)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u != nil {
+		link, expires := resetLink(u)
+		h.sendMail(mail.TemplateReset, u, mail.Data{Link: link, Expires: expires})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{"result": "ok"})
+}
+
+// ResetPassword godoc
+// @Summary Reset the password
+// @Description Set a new password with the token from the reset email. All sessions of the user are logged out
+// @ID reset-password
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param reset body resetPasswordRequest true "Token from the email and the new password"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /password/reset [post]
+func (h *Handler) ResetPassword(c echo.Context) error {
+	req := &resetPasswordRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	t, err := utils.ParseActionToken(utils.ActionResetPassword, req.Token)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByID(t.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(utils.ErrActionInvalid))
+	}
+
+	if err := t.Verify(resetState(u)); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	if err := config.Global.PasswordPolicy.Check(req.Password, u.Username, u.Email); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if u.Password, err = u.HashPassword(req.Password); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if err := h.userStore.Update(u); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	// The link arrived by mail, which proves the address as well.
+	if !u.EmailVerified() {
+		now := time.Now()
+		if err := h.userStore.SetEmailVerified(u.ID, &now); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+	}
+
+	if err := h.userStore.RevokeUserSessions(u.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	// Whoever locked the account out does not know the new password.
+	if _, err := h.userStore.DeleteLoginThrottle(userLoginKey(u.ID)); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+// resetPassword posts the token of the reset link with a new password.
+func resetPassword(t *testing.T, link, password string) *httptest.ResponseRecorder {
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"token":"` + u.Query().Get("token") + `","password":"` + password + `"}`
+	req := httptest.NewRequest(echo.POST, "/api/password/reset", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.ResetPassword(e.NewContext(req, rec)))
+	return rec
+}
+
+func TestResetPasswordCaseSuccess(t *testing.T) {
+	tearDown()
+	setup()
+	config.Global.ResetTTL = time.Hour
+	u, _ := us.GetByID(1)
+	link, _ := resetLink(u)
+
+	assert.Equal(t, http.StatusOK, resetPassword(t, link, "new secret").Code)
+	u, _ = us.GetByID(1)
+	assert.True(t, u.CheckPassword("new secret"))
+	assert.True(t, u.EmailVerified())
+
+	// The link dies with the password.
+	assert.Equal(t, http.StatusBadRequest, resetPassword(t, link, "another secret").Code)
+}
+
+func TestResetPasswordCaseEmailChanged(t *testing.T) {
+	tearDown()
+	setup()
+	config.Global.ResetTTL = time.Hour
+	u, _ := us.GetByID(1)
+	link, _ := resetLink(u)
+
+	// The link was mailed to the old address, it proves nothing about the
+	// new one.
+	u.Email = "user1@elsewhere.io"
+	assert.NoError(t, us.Update(u))
+	assert.Equal(t, http.StatusBadRequest, resetPassword(t, link, "new secret").Code)
+	u, _ = us.GetByID(1)
+	assert.True(t, u.CheckPassword("secret"))
+	assert.False(t, u.EmailVerified())
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// GetMediaProgress godoc
+// @Summary Get watch progress of a media
+// @Description Get the last episode of a media the current user has watched. Auth is required
+// @ID get-media-progress
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Success 200 {object} mediaProgressResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/progress [get]
+func (h *Handler) GetMediaProgress(c echo.Context) error {
+	userID := userIDFromToken(c)
+	if userID == 0 {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(middleware.ErrJWTMissing))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	p, err := h.libraryStore.GetProgress(userID, m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newMediaProgressResponse(p))
+}
+
+// UpdateMediaProgress godoc
+// @Summary Update watch progress of a media
+// @Description Set the last episode of a media the current user has watched. Auth is required
+// @ID update-media-progress
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param progress body mediaProgressRequest true "Last watched episode"
+// @Success 200 {object} mediaProgressResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/progress [put]
+func (h *Handler) UpdateMediaProgress(c echo.Context) error {
+	userID := userIDFromToken(c)
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	p, err := h.libraryStore.GetProgress(userID, m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if p == nil {
+		p = &model.MediaProgress{UserID: userID, MediaID: m.ID}
+	}
+
+	req := &mediaProgressRequest{}
+	if err := req.bind(c, p); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if err := h.libraryStore.SaveProgress(p); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newMediaProgressResponse(p))
+}
+
+// GetPlaybackPosition godoc
+// @Summary Get the playback position of an episode
+// @Description Get where the current user stopped playing an episode. Auth is required
+// @ID get-playback-position
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Success 200 {object} singlePlaybackPositionResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/episodes/{episode}/position [get]
+func (h *Handler) GetPlaybackPosition(c echo.Context) error {
+	userID := userIDFromToken(c)
+	if userID == 0 {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(middleware.ErrJWTMissing))
+	}
+
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	p, err := h.libraryStore.GetPosition(userID, m.ID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if p == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	return c.JSON(http.StatusOK, newSinglePlaybackPositionResponse(m, p))
+}
+
+// UpdatePlaybackPosition godoc
+// @Summary Report the playback position of an episode
+// @Description Report where the current user is in an episode. Clients send this periodically; a report older than the stored one is ignored. Crossing the configured share of the duration marks the episode as watched and advances the progress on the media. Auth is required
+// @ID update-playback-position
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Param position body playbackPositionRequest true "Position in seconds"
+// @Success 200 {object} singlePlaybackPositionResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/episodes/{episode}/position [put]
+func (h *Handler) UpdatePlaybackPosition(c echo.Context) error {
+	userID := userIDFromToken(c)
+
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil || episode < 0 {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errors.New("invalid episode number")))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	p, err := h.libraryStore.GetPosition(userID, m.ID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if p == nil {
+		p = &model.PlaybackPosition{UserID: userID, MediaID: m.ID, Episode: episode}
+	}
+
+	req := &playbackPositionRequest{}
+	newer, err := req.bind(c, p)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if !newer {
+		return c.JSON(http.StatusOK, newSinglePlaybackPositionResponse(m, p))
+	}
+
+	if err := library.Report(h.libraryStore, p, false, config.Global.WatchedPercent, model.SourceAPI); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newSinglePlaybackPositionResponse(m, p))
+}
+
+// ContinueWatching godoc
+// @Summary Get the episodes to continue watching
+// @Description Get the episodes the current user started but did not finish, most recently played first. Auth is required
+// @ID continue-watching
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Param limit query integer false "Limit number of positions returned (default is 20)"
+// @Param offset query integer false "Offset/skip number of positions (default is 0)"
+// @Success 200 {object} playbackPositionListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /continue-watching [get]
+func (h *Handler) ContinueWatching(c echo.Context) error {
+	offset, err := strconv.Atoi(c.QueryParam("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil {
+		limit = 20
+	}
+
+	positions, count, err := h.libraryStore.ListInProgress(userIDFromToken(c), offset, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newPlaybackPositionListResponse(positions, count))
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type mediaProgressRequest struct {
+	Progress struct {
+		Episode int `json:"episode" validate:"min=0"`
+	} `json:"progress"`
+}
+
+func (r *mediaProgressRequest) bind(c echo.Context, p *model.MediaProgress) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	p.Episode = r.Progress.Episode
+	return nil
+}
+
+type playbackPositionRequest struct {
+	Position struct {
+		Position   float64    `json:"position" validate:"min=0"`
+		Duration   float64    `json:"duration" validate:"min=0"`
+		ReportedAt *time.Time `json:"reportedAt"`
+	} `json:"position"`
+}
+
+// bind fills p from the request unless p already holds a newer report.
+// It returns false when the request lost to that newer report.
+func (r *playbackPositionRequest) bind(c echo.Context, p *model.PlaybackPosition) (bool, error) {
+	if err := c.Bind(r); err != nil {
+		return false, err
+	}
+	if err := c.Validate(r); err != nil {
+		return false, err
+	}
+	// Clocks of clients run ahead sometimes, never trust a report from the future.
+	now := time.Now()
+	reportedAt := now
+	if r.Position.ReportedAt != nil && r.Position.ReportedAt.Before(now) {
+		reportedAt = *r.Position.ReportedAt
+	}
+	if reportedAt.Before(p.ReportedAt) {
+		return false, nil
+	}
+	p.ReportedAt = reportedAt
+	p.Position = r.Position.Position
+	if r.Position.Duration > 0 {
+		p.Duration = r.Position.Duration
+	}
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type mediaProgressResponse struct {
+	Progress struct {
+		Episode   int        `json:"episode"`
+		UpdatedAt *time.Time `json:"updatedAt"`
+	} `json:"progress"`
+}
+
+func newMediaProgressResponse(p *model.MediaProgress) *mediaProgressResponse {
+	r := new(mediaProgressResponse)
+	if p != nil {
+		r.Progress.Episode = p.Episode
+		r.Progress.UpdatedAt = &p.UpdatedAt
+	}
+	return r
+}
+
+type playbackPositionResponse struct {
+	Media struct {
+		Slug   string  `json:"slug"`
+		Title  string  `json:"title"`
+		Poster *string `json:"poster"`
+	} `json:"media"`
+	Episode    int       `json:"episode"`
+	Position   float64   `json:"position"`
+	Duration   float64   `json:"duration"`
+	Watched    bool      `json:"watched"`
+	ReportedAt time.Time `json:"reportedAt"`
+}
+
+type singlePlaybackPositionResponse struct {
+	Position *playbackPositionResponse `json:"position"`
+}
+
+type playbackPositionListResponse struct {
+	Positions      []*playbackPositionResponse `json:"positions"`
+	PositionsCount int                         `json:"positionsCount"`
+}
+
+func newPlaybackPositionResponse(m *model.Media, p *model.PlaybackPosition) *playbackPositionResponse {
+	r := new(playbackPositionResponse)
+	r.Media.Slug = m.Slug
+	r.Media.Title = m.Title
+	r.Media.Poster = m.Poster
+	r.Episode = p.Episode
+	r.Position = p.Position
+	r.Duration = p.Duration
+	r.Watched = p.Watched
+	r.ReportedAt = p.ReportedAt
+	return r
+}
+
+func newSinglePlaybackPositionResponse(m *model.Media, p *model.PlaybackPosition) *singlePlaybackPositionResponse {
+	return &singlePlaybackPositionResponse{newPlaybackPositionResponse(m, p)}
+}
+
+func newPlaybackPositionListResponse(positions []model.PlaybackPosition, count int) *playbackPositionListResponse {
+	r := new(playbackPositionListResponse)
+	r.Positions = make([]*playbackPositionResponse, 0, len(positions))
+	for i := range positions {
+		r.Positions = append(r.Positions, newPlaybackPositionResponse(&positions[i].Media, &positions[i]))
+	}
+	r.PositionsCount = count
+	return r
+}
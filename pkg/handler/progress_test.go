@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// progressFixture adds a media of three episodes and returns the routes and
+// a token of user 1.
+func progressFixture(t *testing.T) (*echo.Echo, string) {
+	m := model.Media{
+		Content:  model.Content{Slug: "media1-slug", Title: "media1 title", AuthorID: 1},
+		Episodes: 3,
+	}
+	if err := ms.CreateMedia(&m); err != nil {
+		t.Fatal(err)
+	}
+	percent := config.Global.WatchedPercent
+	config.Global.WatchedPercent = 90
+	t.Cleanup(func() { config.Global.WatchedPercent = percent })
+	return routes(), sessionToken(1)
+}
+
+func reportPosition(t *testing.T, r *echo.Echo, token string, episode int, position float64, reportedAt time.Time) *playbackPositionResponse {
+	body := fmt.Sprintf(`{"position":{"position":%g,"duration":1000,"reportedAt":%q}}`, position, reportedAt.Format(time.RFC3339Nano))
+	rec := requestJSON(r, echo.PUT, fmt.Sprintf("/api/medias/media1-slug/episodes/%d/position", episode), token, body)
+	if !assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String()) {
+		t.FailNow()
+	}
+	var p singlePlaybackPositionResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	return p.Position
+}
+
+func TestUpdatePlaybackPositionCaseLastWriteWins(t *testing.T) {
+	tearDown()
+	setup()
+	r, token := progressFixture(t)
+	now := time.Now()
+
+	reportPosition(t, r, token, 1, 300, now.Add(-time.Minute))
+	// A report that arrives late loses to the newer one.
+	p := reportPosition(t, r, token, 1, 100, now.Add(-2*time.Minute))
+	assert.Equal(t, float64(300), p.Position)
+
+	rec := request(r, echo.GET, "/api/medias/media1-slug/episodes/1/position", token)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var got singlePlaybackPositionResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, float64(300), got.Position.Position)
+	}
+
+	// A report from the future counts as made now, so it cannot lock out
+	// the reports after it.
+	p = reportPosition(t, r, token, 1, 400, now.Add(time.Hour))
+	assert.Equal(t, float64(400), p.Position)
+	assert.True(t, p.ReportedAt.Before(now.Add(time.Minute)))
+	p = reportPosition(t, r, token, 1, 500, time.Now())
+	assert.Equal(t, float64(500), p.Position)
+}
+
+func TestUpdatePlaybackPositionCaseWatched(t *testing.T) {
+	tearDown()
+	setup()
+	r, token := progressFixture(t)
+
+	p := reportPosition(t, r, token, 2, 800, time.Now())
+	assert.False(t, p.Watched)
+	rec := request(r, echo.GET, "/api/medias/media1-slug/progress", token)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Contains(t, rec.Body.String(), `"episode":0`)
+	}
+
+	p = reportPosition(t, r, token, 2, 900, time.Now())
+	assert.True(t, p.Watched)
+	rec = request(r, echo.GET, "/api/medias/media1-slug/progress", token)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var got mediaProgressResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, 2, got.Progress.Episode)
+	}
+
+	// Watching an earlier episode again does not move the progress back.
+	reportPosition(t, r, token, 1, 950, time.Now())
+	rec = request(r, echo.GET, "/api/medias/media1-slug/progress", token)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var got mediaProgressResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, 2, got.Progress.Episode)
+	}
+}
+
+func TestContinueWatchingCaseOrder(t *testing.T) {
+	tearDown()
+	setup()
+	r, token := progressFixture(t)
+	now := time.Now()
+
+	reportPosition(t, r, token, 1, 100, now.Add(-3*time.Minute))
+	reportPosition(t, r, token, 3, 100, now.Add(-time.Minute))
+	reportPosition(t, r, token, 2, 100, now.Add(-2*time.Minute))
+	// Finished episodes are not continued.
+	reportPosition(t, r, token, 2, 950, now.Add(-30*time.Second))
+
+	rec := request(r, echo.GET, "/api/continue-watching", token)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var got playbackPositionListResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, 2, got.PositionsCount)
+		var episodes []int
+		for _, p := range got.Positions {
+			episodes = append(episodes, p.Episode)
+			assert.Equal(t, "media1-slug", p.Media.Slug)
+		}
+		assert.Equal(t, []int{3, 1}, episodes)
+	}
+
+	rec = request(r, echo.GET, "/api/continue-watching", sessionToken(2))
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		assert.Contains(t, rec.Body.String(), `"positionsCount":0`)
+	}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+)
+
+// Rate limit groups, see RATE_USER_LIMITS and RATE_IP_LIMITS.
+const (
+	rateRead    = "read"
+	rateWrite   = "write"
+	rateComment = "comment"
+	rateAuth    = "auth"
+)
+
+// rateGroup puts reads and writes in their groups.
+func rateGroup(c echo.Context) string {
+	m := c.Request().Method
+	if m == http.MethodGet || m == http.MethodHead {
+		return rateRead
+	}
+	return rateWrite
+}
+
+// rateLimit limits the requests of one group.
+func (h *Handler) rateLimit(group string) echo.MiddlewareFunc {
+	return middleware.RateLimit(h.rateLimits, config.Global.RateLimits, group)
+}
+
+// requestRateLimit limits reads and writes. It has to run after the JWT
+// middleware to count per user.
+func (h *Handler) requestRateLimit() echo.MiddlewareFunc {
+	return middleware.RateLimitWithConfig(middleware.RateLimitConfig{
+		Store:  h.rateLimits,
+		Limits: config.Global.RateLimits,
+		Group:  rateGroup,
+	})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/ratelimit"
+)
+
+// login posts a login from the address remote, forwarded for xff when it is
+// not empty.
+func login(r *echo.Echo, remote, xff, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(echo.POST, "/api/login", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.RemoteAddr = remote + ":1234"
+	if xff != "" {
+		req.Header.Set(echo.HeaderXForwardedFor, xff)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// trustProxies sets the trusted proxies for the routes created until the
+// test ends.
+func trustProxies(t *testing.T, cidrs ...string) {
+	old := config.Global.TrustedProxies
+	t.Cleanup(func() { config.Global.TrustedProxies = old })
+	config.Global.TrustedProxies = nil
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Global.TrustedProxies = append(config.Global.TrustedProxies, n)
+	}
+}
+
+func TestRateLimitCaseSpoofedForwardedFor(t *testing.T) {
+	tearDown()
+	setup()
+	old := config.Global.RateLimits
+	t.Cleanup(func() { config.Global.RateLimits = old })
+	config.Global.RateLimits = map[string]ratelimit.Limit{
+		rateAuth: {IP: ratelimit.Rule{Limit: 1, Period: time.Hour}},
+	}
+	body := `{"user":{"email":"user1@realworld.io","password":"wrong"}}`
+
+	// Without trusted proxies the header is ignored.
+	trustProxies(t)
+	r := routes()
+	assert.NotEqual(t, http.StatusTooManyRequests, login(r, "192.0.2.1", "203.0.113.1", body).Code)
+	assert.Equal(t, http.StatusTooManyRequests, login(r, "192.0.2.1", "203.0.113.2", body).Code)
+	assert.NotEqual(t, http.StatusTooManyRequests, login(r, "192.0.2.2", "", body).Code)
+
+	// Behind a proxy, what the client sent before the address the proxy
+	// added is ignored.
+	trustProxies(t, "198.51.100.0/24")
+	r = routes()
+	assert.NotEqual(t, http.StatusTooManyRequests, login(r, "198.51.100.1", "10.0.0.1, 203.0.113.9", body).Code)
+	assert.Equal(t, http.StatusTooManyRequests, login(r, "198.51.100.1", "10.0.0.2, 203.0.113.9", body).Code)
+	assert.NotEqual(t, http.StatusTooManyRequests, login(r, "198.51.100.1", "203.0.113.10", body).Code)
+}
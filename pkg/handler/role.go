@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// GrantRole godoc
+// @Summary Grant a role
+// @Description Grant the admin, moderator or editor role to a user. It applies to tokens issued afterwards. Auth is required
+// @ID grant-role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param username path string true "Username of the user"
+// @Param role path string true "admin, moderator or editor"
+// @Success 200 {object} roleListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/users/{username}/roles/{role} [put]
+func (h *Handler) GrantRole(c echo.Context) error {
+	role := c.Param("role")
+	if !user.ValidRole(role) {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("unknown role")))
+	}
+
+	u, err := h.userStore.GetByUsername(c.Param("username"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if err := h.userStore.AddRole(u.ID, role); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	roles, err := h.userStore.ListRoles(u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newRoleListResponse(u.Username, roles))
+}
+
+// RevokeRole godoc
+// @Summary Revoke a role
+// @Description Revoke a role from a user. It applies to tokens issued afterwards. Admins cannot revoke their own admin role. Auth is required
+// @ID revoke-role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param username path string true "Username of the user"
+// @Param role path string true "admin, moderator or editor"
+// @Success 200 {object} roleListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/users/{username}/roles/{role} [delete]
+func (h *Handler) RevokeRole(c echo.Context) error {
+	role := c.Param("role")
+	if !user.ValidRole(role) {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("unknown role")))
+	}
+
+	u, err := h.userStore.GetByUsername(c.Param("username"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	// Keeps the last admin from locking everybody out.
+	if u.ID == userIDFromToken(c) && role == user.RoleAdmin {
+		return c.JSON(http.StatusForbidden, utils.NewError(errors.New("cannot revoke your own admin role")))
+	}
+
+	if err := h.userStore.RemoveRole(u.ID, role); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	roles, err := h.userStore.ListRoles(u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newRoleListResponse(u.Username, roles))
+}
+
+// RoleSettings godoc
+// @Summary List role settings
+// @Description List the roles that can be granted with their settings. Auth is required
+// @ID role-settings
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} roleSettingListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/roles [get]
+func (h *Handler) RoleSettings(c echo.Context) error {
+	settings, err := h.userStore.ListRoleSettings()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newRoleSettingListResponse(user.Roles(), settings))
+}
+
+// UpdateRoleSetting godoc
+// @Summary Update a role setting
+// @Description Require a second factor for a role. Sessions that logged in without one don't get the role in their tokens, so its users have to enable two-factor authentication and log in again. Auth is required
+// @ID update-role-setting
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param role path string true "admin, moderator or editor"
+// @Param setting body roleSettingRequest true "Settings of the role"
+// @Success 200 {object} roleSettingResponse
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /admin/roles/{role} [put]
+func (h *Handler) UpdateRoleSetting(c echo.Context) error {
+	role := c.Param("role")
+	if !user.ValidRole(role) {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("unknown role")))
+	}
+
+	s := model.RoleSetting{Role: role}
+	req := &roleSettingRequest{}
+	if err := req.bind(c, &s); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if err := h.userStore.SaveRoleSetting(&s); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newRoleSettingResponse(&s))
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type roleSettingRequest struct {
+	RequireTwoFactor bool `json:"requireTwoFactor"`
+}
+
+func (r *roleSettingRequest) bind(c echo.Context, s *model.RoleSetting) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	s.RequireTwoFactor = r.RequireTwoFactor
+	return nil
+}
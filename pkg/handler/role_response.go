@@ -0,0 +1,47 @@
+package handler
+
+import "github.com/xenking/kitsu-media-server/pkg/model"
+
+type roleListResponse struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+func newRoleListResponse(username string, roles []string) *roleListResponse {
+	if roles == nil {
+		roles = make([]string, 0)
+	}
+	return &roleListResponse{Username: username, Roles: roles}
+}
+
+type roleSettingResponse struct {
+	Role             string `json:"role"`
+	RequireTwoFactor bool   `json:"requireTwoFactor"`
+}
+
+func newRoleSettingResponse(s *model.RoleSetting) *roleSettingResponse {
+	return &roleSettingResponse{Role: s.Role, RequireTwoFactor: s.RequireTwoFactor}
+}
+
+type roleSettingListResponse struct {
+	Roles []*roleSettingResponse `json:"roles"`
+}
+
+// newRoleSettingListResponse lists every role, with defaults for those
+// never configured.
+func newRoleSettingListResponse(roles []string, settings []model.RoleSetting) *roleSettingListResponse {
+	byRole := make(map[string]*model.RoleSetting, len(settings))
+	for i := range settings {
+		byRole[settings[i].Role] = &settings[i]
+	}
+
+	r := &roleSettingListResponse{Roles: make([]*roleSettingResponse, 0, len(roles))}
+	for _, role := range roles {
+		s, ok := byRole[role]
+		if !ok {
+			s = &model.RoleSetting{Role: role}
+		}
+		r.Roles = append(r.Roles, newRoleSettingResponse(s))
+	}
+	return r
+}
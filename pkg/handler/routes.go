@@ -4,25 +4,90 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/xenking/kitsu-media-server/pkg/config"
 	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+	"github.com/xenking/kitsu-media-server/pkg/user"
 )
 
 func (h *Handler) Register(v1 *echo.Group) {
-	v1.POST("/register", h.SignUp)
-	v1.POST("/login", h.Login)
+	auth := h.rateLimit(rateAuth)
+	requests := h.requestRateLimit()
+	comment := h.rateLimit(rateComment)
 
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
-	user := v1.Group("/user", jwtMiddleware)
+	v1.GET("/registration", h.Registration)
+	v1.POST("/register", h.SignUp, auth)
+	v1.POST("/login", h.Login, auth)
+	v1.POST("/login/2fa", h.LoginTwoFactor, auth)
+	v1.POST("/login/webauthn", h.BeginWebAuthnLogin, auth)
+	v1.POST("/login/webauthn/finish", h.FinishWebAuthnLogin, auth)
+	v1.GET("/login/oidc", h.OIDCProviders)
+	v1.POST("/login/oidc/:provider", h.BeginOIDCLogin, auth)
+	v1.POST("/login/oidc/:provider/callback", h.FinishOIDCLogin, auth)
+	v1.POST("/scrobble/:provider", h.Scrobble, requests)
+
+	v1.POST("/refresh", h.Refresh, auth)
+	v1.POST("/verify-email", h.VerifyEmail, auth)
+	v1.POST("/password/forgot", h.ForgotPassword, auth)
+	v1.POST("/password/reset", h.ResetPassword, auth)
+
+	jwtMiddleware := middleware.JWTWithConfig(
+		middleware.JWTConfig{
+			Keys:    config.Global.JWTKeys,
+			Revoked: h.userStore.IsTokenRevoked,
+			Seen:    h.seen.Touch,
+			Tokens:  h.findAccessToken,
+			Scope:   requiredScope,
+		},
+	)
+	verified := middleware.Verified(h.emailVerified)
+	v1.POST("/logout", h.Logout, jwtMiddleware, requests)
+	v1.POST("/logout/all", h.LogoutAll, jwtMiddleware, requests)
+
+	admin := v1.Group("/admin", jwtMiddleware, requests)
+	admin.GET("/users", h.UsersList, middleware.Authorize(user.PermUsersRead))
+	admin.DELETE("/user/:username", h.DeleteUser, middleware.Authorize(user.PermUsersDelete))
+	admin.PUT("/users/:username/roles/:role", h.GrantRole, middleware.Authorize(user.PermRolesManage))
+	admin.DELETE("/users/:username/roles/:role", h.RevokeRole, middleware.Authorize(user.PermRolesManage))
+	admin.GET("/login-locks", h.LoginLocks, middleware.Authorize(user.PermUsersUnlock))
+	admin.DELETE("/login-locks", h.ClearLoginLock, middleware.Authorize(user.PermUsersUnlock))
+	admin.GET("/invites", h.AllInvites, middleware.Authorize(user.PermInvitesManage))
+	admin.GET("/roles", h.RoleSettings, middleware.Authorize(user.PermRolesManage))
+	admin.PUT("/roles/:role", h.UpdateRoleSetting, middleware.Authorize(user.PermRolesManage))
+	admin.GET("/files/corrupted", h.CorruptedFiles, middleware.Authorize(user.PermLibraryManage))
+	admin.GET("/streams", h.StreamUsage, middleware.Authorize(user.PermLibraryManage))
+
+	user := v1.Group("/user", jwtMiddleware, requests)
 	user.GET("", h.CurrentUser)
 	user.PUT("", h.UpdateUser)
+	user.POST("/verification", h.SendVerification)
+	user.POST("/2fa/totp", h.EnrollTOTP)
+	user.GET("/2fa/totp/qr.png", h.TOTPQRCode)
+	user.POST("/2fa/totp/confirm", h.ConfirmTOTP)
+	user.DELETE("/2fa/totp", h.DisableTOTP)
+	user.POST("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+	user.POST("/webauthn/register", h.BeginWebAuthnRegistration)
+	user.POST("/webauthn/register/finish", h.FinishWebAuthnRegistration)
+	user.GET("/webauthn/credentials", h.WebAuthnCredentials)
+	user.PUT("/webauthn/credentials/:id", h.UpdateWebAuthnCredential)
+	user.DELETE("/webauthn/credentials/:id", h.DeleteWebAuthnCredential)
+	user.GET("/oidc", h.OIDCIdentities)
+	user.DELETE("/oidc/:id", h.DeleteOIDCIdentity)
+	user.POST("/scrobble-token", h.CreateScrobbleToken)
+	user.GET("/history", h.WatchHistory)
+	user.POST("/links", h.CreateSignedLink)
+	user.GET("/invites", h.Invites)
+	user.POST("/invites", h.CreateInvite)
+	user.DELETE("/invites/:id", h.RevokeInvite)
+	user.GET("/tokens", h.AccessTokens)
+	user.POST("/tokens", h.CreateAccessToken)
+	user.DELETE("/tokens/:id", h.DeleteAccessToken)
+	user.GET("/sessions", h.Sessions)
+	user.DELETE("/sessions/:id", h.DeleteSession)
 
-	users := v1.Group("/users", jwtMiddleware)
+	users := v1.Group("/users", jwtMiddleware, requests)
 	users.GET("/:username", h.GetProfile)
 	users.POST("/:username/follow", h.Follow)
 	users.DELETE("/:username/follow", h.Unfollow)
 
-	admin := v1.Group("/admin", jwtMiddleware)
-	admin.GET("/users", h.UsersList)
-	admin.DELETE("/user/:username", h.DeleteUser)
+	v1.GET("/continue-watching", h.ContinueWatching, jwtMiddleware, requests)
 
 	articles := v1.Group("/articles", middleware.JWTWithConfig(
 		middleware.JWTConfig{
@@ -32,14 +97,18 @@ func (h *Handler) Register(v1 *echo.Group) {
 				}
 				return false
 			},
-			SigningKey: config.Global.JWTSecret,
+			Keys:    config.Global.JWTKeys,
+			Revoked: h.userStore.IsTokenRevoked,
+			Seen:    h.seen.Touch,
+			Tokens:  h.findAccessToken,
+			Scope:   requiredScope,
 		},
-	))
+	), requests)
 	articles.POST("", h.CreateArticle)
 	articles.GET("/feed", h.ArticleFeed)
 	articles.PUT("/:slug", h.UpdateArticle)
 	articles.DELETE("/:slug", h.DeleteArticle)
-	articles.POST("/:slug/comments", h.AddArticleComment)
+	articles.POST("/:slug/comments", h.AddArticleComment, verified, comment)
 	articles.DELETE("/:slug/comments/:id", h.DeleteArticleComment)
 	articles.POST("/:slug/favorite", h.ArticleFavorite)
 	articles.DELETE("/:slug/favorite", h.ArticleUnfavorite)
@@ -57,21 +126,69 @@ func (h *Handler) Register(v1 *echo.Group) {
 				}
 				return false
 			},
-			SigningKey: config.Global.JWTSecret,
+			Keys:       config.Global.JWTKeys,
+			SignedURLs: true,
+			Revoked:    h.userStore.IsTokenRevoked,
+			Seen:       h.seen.Touch,
+			Tokens:     h.findAccessToken,
+			Scope:      requiredScope,
 		},
-	))
+	), requests)
 	medias.POST("", h.CreateMedia)
 	medias.GET("/feed", h.MediaFeed)
 	medias.PUT("/:slug", h.UpdateMedia)
 	medias.DELETE("/:slug", h.DeleteMedia)
-	medias.POST("/:slug/comments", h.AddMediaComment)
+	medias.POST("/:slug/comments", h.AddMediaComment, verified, comment)
 	medias.DELETE("/:slug/comments/:id", h.DeleteMediaComment)
 	medias.POST("/:slug/favorite", h.MediaFavorite)
 	medias.DELETE("/:slug/favorite", h.MediaUnfavorite)
 	medias.GET("", h.Medias)
 	medias.GET("/:slug", h.GetMedia)
 	medias.GET("/:slug/comments", h.GetMediaComments)
+	medias.GET("/:slug/episodes", h.Episodes)
+	medias.GET("/:slug/episodes/:episode", h.GetEpisode)
+	medias.POST("/:slug/episodes/:episode/files", h.LinkEpisodeFile)
+	medias.DELETE("/:slug/episodes/:episode/files/:id", h.UnlinkEpisodeFile)
+	medias.GET("/:slug/episodes/:episode/position", h.GetPlaybackPosition)
+	medias.PUT("/:slug/episodes/:episode/position", h.UpdatePlaybackPosition)
+	medias.GET("/:slug/episodes/:episode/segments", h.EpisodeSegments)
+	medias.POST("/:slug/episodes/:episode/segments", h.SubmitSegment, verified)
+	medias.POST("/:slug/episodes/:episode/segments/:id/vote", h.VoteSegment, verified)
+	medias.GET("/:slug/episodes/:episode/skip", h.EpisodeSkipRanges)
+	medias.GET("/:slug/playlist.m3u8", h.Playlist)
+	medias.POST("/:slug/external-ids", h.AddMediaExternalID)
+	medias.GET("/:slug/progress", h.GetMediaProgress)
+	medias.PUT("/:slug/progress", h.UpdateMediaProgress)
 
 	mediaTags := medias.Group("/tags")
 	mediaTags.GET("", h.MediaTags)
+
+	comments := v1.Group("/comments", middleware.JWTWithConfig(
+		middleware.JWTConfig{
+			Skipper: func(c echo.Context) bool {
+				return c.Request().Method == "GET"
+			},
+			Keys:    config.Global.JWTKeys,
+			Revoked: h.userStore.IsTokenRevoked,
+			Seen:    h.seen.Touch,
+			Tokens:  h.findAccessToken,
+			Scope:   requiredScope,
+		},
+	), requests)
+	comments.PUT("/:id", h.UpdateComment, verified, comment)
+	comments.GET("/:id/revisions", h.CommentRevisions)
+	comments.POST("/:id/like", h.LikeComment)
+	comments.DELETE("/:id/like", h.UnlikeComment)
+
+	files := v1.Group("/files", middleware.JWTWithConfig(
+		middleware.JWTConfig{
+			Keys:       config.Global.JWTKeys,
+			SignedURLs: true,
+			Revoked:    h.userStore.IsTokenRevoked,
+			Seen:       h.seen.Touch,
+			Tokens:     h.findAccessToken,
+			Scope:      requiredScope,
+		},
+	), requests)
+	files.GET("/:id/stream", h.StreamFile)
 }
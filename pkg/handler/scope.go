@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+)
+
+// writeScopes are the scopes personal access tokens need for the routes
+// that change something. Routes missing here are closed to tokens, so new
+// ones stay safe until they are given a scope.
+var writeScopes = map[string]string{
+	"POST /api/user/links": user.ScopeRead,
+
+	"POST /api/articles/:slug/favorite":                          user.ScopeLibraryWrite,
+	"DELETE /api/articles/:slug/favorite":                        user.ScopeLibraryWrite,
+	"POST /api/medias/:slug/favorite":                            user.ScopeLibraryWrite,
+	"DELETE /api/medias/:slug/favorite":                          user.ScopeLibraryWrite,
+	"PUT /api/medias/:slug/episodes/:episode/position":           user.ScopeLibraryWrite,
+	"PUT /api/medias/:slug/progress":                             user.ScopeLibraryWrite,
+	"POST /api/medias":                                           user.ScopeMediaEdit,
+	"PUT /api/medias/:slug":                                      user.ScopeMediaEdit,
+	"DELETE /api/medias/:slug":                                   user.ScopeMediaEdit,
+	"POST /api/medias/:slug/external-ids":                        user.ScopeMediaEdit,
+	"POST /api/medias/:slug/episodes/:episode/files":             user.ScopeMediaEdit,
+	"DELETE /api/medias/:slug/episodes/:episode/files/:id":       user.ScopeMediaEdit,
+	"POST /api/medias/:slug/episodes/:episode/segments":          user.ScopeMediaEdit,
+	"POST /api/medias/:slug/episodes/:episode/segments/:id/vote": user.ScopeMediaEdit,
+	"POST /api/articles/:slug/comments":                          user.ScopeCommentsWrite,
+	"DELETE /api/articles/:slug/comments/:id":                    user.ScopeCommentsWrite,
+	"POST /api/medias/:slug/comments":                            user.ScopeCommentsWrite,
+	"DELETE /api/medias/:slug/comments/:id":                      user.ScopeCommentsWrite,
+	"PUT /api/comments/:id":                                      user.ScopeCommentsWrite,
+	"POST /api/comments/:id/like":                                user.ScopeCommentsWrite,
+	"DELETE /api/comments/:id/like":                              user.ScopeCommentsWrite,
+}
+
+// tokenClosed are the paths, with everything below them, that personal
+// access tokens cannot reach even to read. They show or manage credentials,
+// sessions and other users, which a token must not be able to escalate from.
+var tokenClosed = []string{
+	"/api/admin",
+	"/api/user/tokens",
+	"/api/user/sessions",
+	"/api/user/2fa",
+	"/api/user/webauthn",
+	"/api/user/oidc",
+	"/api/user/scrobble-token",
+	"/api/user/invites",
+}
+
+// requiredScope is the scope a personal access token needs for the route of
+// c. Reads need ScopeRead, unless the route is closed to tokens.
+func requiredScope(c echo.Context) string {
+	p := c.Path()
+	for _, closed := range tokenClosed {
+		if p == closed || strings.HasPrefix(p, closed+"/") {
+			return ""
+		}
+	}
+	m := c.Request().Method
+	if m == http.MethodGet || m == http.MethodHead {
+		return user.ScopeRead
+	}
+	return writeScopes[m+" "+p]
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+func TestAccessTokenCaseClosedRoutes(t *testing.T) {
+	tearDown()
+	setup()
+	r := routes()
+	token := user.AccessTokenPrefix + "readonlytestaccesstoken"
+	assert.NoError(t, us.AddRole(1, user.RoleAdmin))
+	assert.NoError(t, us.CreateAccessToken(&model.AccessToken{
+		UserID: 1,
+		Name:   "read",
+		Hash:   utils.HashToken(token),
+		Scopes: user.ScopeRead,
+	}))
+
+	assert.Equal(t, http.StatusOK, request(r, echo.GET, "/api/user", token).Code)
+	for _, path := range []string{
+		"/api/user/tokens",
+		"/api/user/sessions",
+		"/api/user/2fa/totp/qr.png",
+		"/api/admin/users",
+	} {
+		rec := request(r, echo.GET, path, token)
+		assert.Equal(t, http.StatusForbidden, rec.Code, path)
+		assert.Contains(t, rec.Body.String(), middleware.ErrTokenScope.Message.(string), path)
+	}
+}
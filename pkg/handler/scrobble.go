@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/scrobble"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var errScrobbleToken = errors.New("missing or invalid scrobble token")
+
+// Scrobble godoc
+// @Summary Scrobble a playback
+// @Description Receive a playback webhook of Plex (multipart form with a payload field), Jellyfin (webhook plugin JSON) or the mpv script. A completed playback advances the progress on the media and is added to the watch history. Authenticated with the scrobble token of the user in the token query parameter or the X-Scrobble-Token header
+// @ID scrobble
+// @Tags progress
+// @Accept  json
+// @Accept  mpfd
+// @Param provider path string true "plex, jellyfin or mpv"
+// @Param token query string false "Scrobble token"
+// @Success 204
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /scrobble/{provider} [post]
+func (h *Handler) Scrobble(c echo.Context) error {
+	token := c.Request().Header.Get("X-Scrobble-Token")
+	if token == "" {
+		token = c.QueryParam("token")
+	}
+	if token == "" {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errScrobbleToken))
+	}
+
+	u, err := h.userStore.GetByScrobbleToken(utils.HashToken(token))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errScrobbleToken))
+	}
+
+	provider := c.Param("provider")
+	ev, err := scrobble.Parse(provider, c.Request())
+	if err == scrobble.ErrUnknownProvider {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	if ev == nil || (!ev.Completed && ev.Position == 0) {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	mediaID, episode, err := h.scrobbleResolver.Resolve(ev)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if mediaID == 0 {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	p, err := h.libraryStore.GetPosition(u.ID, mediaID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if p == nil {
+		p = &model.PlaybackPosition{UserID: u.ID, MediaID: mediaID, Episode: episode}
+	}
+	p.ReportedAt = time.Now()
+	p.Position = ev.Position
+	if ev.Duration > 0 {
+		p.Duration = ev.Duration
+	}
+
+	if err := library.Report(h.libraryStore, p, ev.Completed, config.Global.WatchedPercent, provider); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CreateScrobbleToken godoc
+// @Summary Create a scrobble token
+// @Description Create the token external players authenticate scrobbles with. The previous token stops working. Auth is required
+// @ID create-scrobble-token
+// @Tags progress
+// @Produce  json
+// @Success 201 {object} scrobbleTokenResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/scrobble-token [post]
+func (h *Handler) CreateScrobbleToken(c echo.Context) error {
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	token, err := utils.NewToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	hash := utils.HashToken(token)
+	u.ScrobbleToken = &hash
+	if err := h.userStore.Update(u); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newScrobbleTokenResponse(token))
+}
+
+// WatchHistory godoc
+// @Summary Get the watch history
+// @Description Get the episodes the current user finished, most recent first. Auth is required
+// @ID get-watch-history
+// @Tags progress
+// @Produce  json
+// @Param limit query integer false "Limit number of entries returned (default is 20)"
+// @Param offset query integer false "Offset/skip number of entries (default is 0)"
+// @Success 200 {object} watchHistoryListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/history [get]
+func (h *Handler) WatchHistory(c echo.Context) error {
+	offset, err := strconv.Atoi(c.QueryParam("offset"))
+	if err != nil {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(c.QueryParam("limit"))
+	if err != nil {
+		limit = 20
+	}
+
+	history, count, err := h.libraryStore.ListHistory(userIDFromToken(c), offset, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newWatchHistoryListResponse(history, count))
+}
+
+// AddMediaExternalID godoc
+// @Summary Link an external ID to a media
+// @Description Link the ID of a media in another database or media server, used to match scrobbles. Auth is required
+// @ID add-media-external-id
+// @Tags progress
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param externalId body externalIDRequest true "Provider and ID"
+// @Success 201 {object} singleExternalIDResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/external-ids [post]
+func (h *Handler) AddMediaExternalID(c echo.Context) error {
+	m, err := h.editableMedia(c, c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	e := model.MediaExternalID{MediaID: m.ID}
+
+	req := &externalIDRequest{}
+	if err := req.bind(c, &e); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	linked, err := h.libraryStore.GetMediaIDByExternalID(e.Provider, e.ExternalID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if linked != 0 {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("external id is already linked")))
+	}
+
+	if err := h.libraryStore.AddExternalID(&e); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newSingleExternalIDResponse(&e))
+}
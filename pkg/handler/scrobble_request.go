@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type externalIDRequest struct {
+	ExternalID struct {
+		Provider string `json:"provider" validate:"required"`
+		ID       string `json:"id" validate:"required"`
+	} `json:"externalId"`
+}
+
+func (r *externalIDRequest) bind(c echo.Context, e *model.MediaExternalID) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	e.Provider = strings.ToLower(r.ExternalID.Provider)
+	e.ExternalID = r.ExternalID.ID
+	return nil
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type scrobbleTokenResponse struct {
+	ScrobbleToken struct {
+		Token string `json:"token"`
+	} `json:"scrobbleToken"`
+}
+
+func newScrobbleTokenResponse(token string) *scrobbleTokenResponse {
+	r := new(scrobbleTokenResponse)
+	r.ScrobbleToken.Token = token
+	return r
+}
+
+type watchHistoryResponse struct {
+	Media struct {
+		Slug   string  `json:"slug"`
+		Title  string  `json:"title"`
+		Poster *string `json:"poster"`
+	} `json:"media"`
+	Episode   int       `json:"episode"`
+	Source    string    `json:"source"`
+	WatchedAt time.Time `json:"watchedAt"`
+}
+
+type watchHistoryListResponse struct {
+	History      []*watchHistoryResponse `json:"history"`
+	HistoryCount int                     `json:"historyCount"`
+}
+
+func newWatchHistoryListResponse(history []model.WatchHistory, count int) *watchHistoryListResponse {
+	r := new(watchHistoryListResponse)
+	r.History = make([]*watchHistoryResponse, 0, len(history))
+	for _, h := range history {
+		hr := new(watchHistoryResponse)
+		hr.Media.Slug = h.Media.Slug
+		hr.Media.Title = h.Media.Title
+		hr.Media.Poster = h.Media.Poster
+		hr.Episode = h.Episode
+		hr.Source = h.Source
+		hr.WatchedAt = h.WatchedAt
+		r.History = append(r.History, hr)
+	}
+	r.HistoryCount = count
+	return r
+}
+
+type externalIDResponse struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+}
+
+type singleExternalIDResponse struct {
+	ExternalID *externalIDResponse `json:"externalId"`
+}
+
+func newSingleExternalIDResponse(e *model.MediaExternalID) *singleExternalIDResponse {
+	return &singleExternalIDResponse{&externalIDResponse{Provider: e.Provider, ID: e.ExternalID}}
+}
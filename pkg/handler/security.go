@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"log"
+
+	"github.com/labstack/echo/v4"
+)
+
+// securityEvent logs what matters to spot attacks on accounts, in one
+// format that is easy to grep and alert on.
+func securityEvent(c echo.Context, event string, userID uint, detail string) {
+	log.Printf("security: event=%s user=%d ip=%s %s", event, userID, c.RealIP(), detail)
+}
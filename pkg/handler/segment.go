@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// EpisodeSegments godoc
+// @Summary Get the skip segments submitted for an episode
+// @Description Get every intro, outro, recap and preview range submitted for an episode with its score. Auth not required
+// @ID get-episode-segments
+// @Tags segment
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Success 200 {object} segmentListResponse
+// @Failure 400 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /medias/{slug}/episodes/{episode}/segments [get]
+func (h *Handler) EpisodeSegments(c echo.Context) error {
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil || episode < 0 {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errors.New("invalid episode number")))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	segments, err := h.libraryStore.ListSegments(m.ID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newSegmentListResponse(segments))
+}
+
+// EpisodeSkipRanges godoc
+// @Summary Get the skip ranges of an episode
+// @Description Get the consensus range of each kind of segment, clustered from the submissions and weighted by votes and submitter reputation. Auth not required
+// @ID get-episode-skip-ranges
+// @Tags segment
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Success 200 {object} skipRangeListResponse
+// @Failure 400 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /medias/{slug}/episodes/{episode}/skip [get]
+func (h *Handler) EpisodeSkipRanges(c echo.Context) error {
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil || episode < 0 {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errors.New("invalid episode number")))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	segments, err := h.libraryStore.ListSegments(m.ID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	userIDs := make([]uint, 0, len(segments))
+	for _, s := range segments {
+		userIDs = append(userIDs, s.UserID)
+	}
+
+	reputations, err := h.libraryStore.ListReputations(userIDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newSkipRangeListResponse(library.Consensus(segments, reputations)))
+}
+
+// SubmitSegment godoc
+// @Summary Submit a skip segment
+// @Description Submit an intro, outro, recap or preview range of an episode in seconds. A new submission of the same kind replaces the previous one of the user and, if the range changed, its votes. The range must fit into the probed duration of the episode. Auth is required
+// @ID submit-segment
+// @Tags segment
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Param segment body segmentRequest true "Segment to submit"
+// @Success 201 {object} singleSegmentResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/episodes/{episode}/segments [post]
+func (h *Handler) SubmitSegment(c echo.Context) error {
+	userID := userIDFromToken(c)
+
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil || episode < 0 {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errors.New("invalid episode number")))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	files, err := h.libraryStore.ListEpisodeFiles(m.ID, episode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	duration := 0.0
+	for _, f := range files {
+		if f.Duration > duration {
+			duration = f.Duration
+		}
+	}
+
+	if duration == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errors.New("episode has no probed duration")))
+	}
+
+	req := &segmentRequest{}
+	s := model.SkipSegment{UserID: userID, MediaID: m.ID, Episode: episode}
+	if err := req.bind(c, &s, duration); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	prev, err := h.libraryStore.GetUserSegment(userID, m.ID, episode, s.Kind)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	switch {
+	case prev == nil:
+		err = h.libraryStore.SaveSegment(&s)
+	case prev.Start == s.Start && prev.End == s.End:
+		s.Model = prev.Model
+		err = h.libraryStore.SaveSegment(&s)
+	default:
+		// The votes were cast on the old range.
+		s.Model = prev.Model
+		err = h.libraryStore.ReplaceSegment(&s)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	saved, err := h.libraryStore.GetSegment(s.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newSingleSegmentResponse(saved))
+}
+
+// VoteSegment godoc
+// @Summary Vote on a skip segment
+// @Description Up- or downvote a segment submitted by another user. Voting again replaces the previous vote. Auth is required
+// @ID vote-segment
+// @Tags segment
+// @Accept  json
+// @Produce  json
+// @Param slug path string true "Slug of the media"
+// @Param episode path integer true "Episode number"
+// @Param id path integer true "ID of the segment"
+// @Param vote body segmentVoteRequest true "1 or -1"
+// @Success 200 {object} singleSegmentResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /medias/{slug}/episodes/{episode}/segments/{id}/vote [post]
+func (h *Handler) VoteSegment(c echo.Context) error {
+	userID := userIDFromToken(c)
+
+	episode, err := strconv.Atoi(c.Param("episode"))
+	if err != nil || episode < 0 {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errors.New("invalid episode number")))
+	}
+
+	m, err := h.mediaStore.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	s, err := h.libraryStore.GetSegment(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if s == nil || s.MediaID != m.ID || s.Episode != episode {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if s.UserID == userID {
+		return c.JSON(http.StatusForbidden, utils.AccessForbidden())
+	}
+
+	v := model.SkipVote{SkipSegmentID: s.ID, UserID: userID}
+	req := &segmentVoteRequest{}
+	if err := req.bind(c, &v); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	if err := h.libraryStore.SaveVote(&v); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	s, err = h.libraryStore.GetSegment(s.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newSingleSegmentResponse(s))
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type segmentRequest struct {
+	Segment struct {
+		Kind  string  `json:"kind" validate:"required,oneof=intro outro recap preview"`
+		Start float64 `json:"start" validate:"min=0"`
+		End   float64 `json:"end" validate:"gtfield=Start"`
+	} `json:"segment"`
+}
+
+// bind fills s from the request. The range has to fit into an episode of
+// the given duration.
+func (r *segmentRequest) bind(c echo.Context, s *model.SkipSegment, duration float64) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	if r.Segment.End > duration {
+		return errors.New("segment ends after the episode")
+	}
+	s.Kind = r.Segment.Kind
+	s.Start = r.Segment.Start
+	s.End = r.Segment.End
+	return nil
+}
+
+type segmentVoteRequest struct {
+	Vote struct {
+		Value int `json:"value" validate:"oneof=-1 1"`
+	} `json:"vote"`
+}
+
+func (r *segmentVoteRequest) bind(c echo.Context, v *model.SkipVote) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	v.Value = r.Vote.Value
+	return nil
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type segmentResponse struct {
+	ID        uint      `json:"id"`
+	Kind      string    `json:"kind"`
+	Start     float64   `json:"start"`
+	End       float64   `json:"end"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Author    struct {
+		Username string  `json:"username"`
+		Image    *string `json:"image"`
+	} `json:"author"`
+}
+
+type singleSegmentResponse struct {
+	Segment *segmentResponse `json:"segment"`
+}
+
+type segmentListResponse struct {
+	Segments      []*segmentResponse `json:"segments"`
+	SegmentsCount int                `json:"segmentsCount"`
+}
+
+func newSegmentResponse(s *model.SkipSegment) *segmentResponse {
+	r := new(segmentResponse)
+	r.ID = s.ID
+	r.Kind = s.Kind
+	r.Start = s.Start
+	r.End = s.End
+	r.Score = s.Score()
+	r.CreatedAt = s.CreatedAt
+	r.UpdatedAt = s.UpdatedAt
+	r.Author.Username = s.User.Username
+	r.Author.Image = s.User.Image
+	return r
+}
+
+func newSingleSegmentResponse(s *model.SkipSegment) *singleSegmentResponse {
+	return &singleSegmentResponse{newSegmentResponse(s)}
+}
+
+func newSegmentListResponse(segments []model.SkipSegment) *segmentListResponse {
+	r := new(segmentListResponse)
+	r.Segments = make([]*segmentResponse, 0, len(segments))
+	for i := range segments {
+		r.Segments = append(r.Segments, newSegmentResponse(&segments[i]))
+	}
+	r.SegmentsCount = len(segments)
+	return r
+}
+
+type skipRangeResponse struct {
+	Kind        string  `json:"kind"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Confidence  float64 `json:"confidence"`
+	Submissions int     `json:"submissions"`
+}
+
+type skipRangeListResponse struct {
+	Ranges []skipRangeResponse `json:"ranges"`
+}
+
+func newSkipRangeListResponse(ranges []library.Range) *skipRangeListResponse {
+	r := new(skipRangeListResponse)
+	r.Ranges = make([]skipRangeResponse, 0, len(ranges))
+	for _, rg := range ranges {
+		r.Ranges = append(r.Ranges, skipRangeResponse{
+			Kind:        rg.Kind,
+			Start:       rg.Start,
+			End:         rg.End,
+			Confidence:  rg.Confidence,
+			Submissions: rg.Submissions,
+		})
+	}
+	return r
+}
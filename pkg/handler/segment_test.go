@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/router/middleware"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+func submitSegment(t *testing.T, userID uint, reqJSON string) *segmentResponse {
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
+	req := httptest.NewRequest(echo.POST, "/api/medias/:slug/episodes/:episode/segments", strings.NewReader(reqJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(userID, 0)))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/api/medias/:slug/episodes/:episode/segments")
+	c.SetParamNames("slug", "episode")
+	c.SetParamValues("media1-slug", "1")
+	err := jwtMiddleware(func(context echo.Context) error {
+		return h.SubmitSegment(c)
+	})(c)
+	assert.NoError(t, err)
+	if !assert.Equal(t, http.StatusCreated, rec.Code) {
+		t.FailNow()
+	}
+	var s singleSegmentResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+	return s.Segment
+}
+
+func TestSubmitSegmentCaseReplace(t *testing.T) {
+	tearDown()
+	setup()
+	m := model.Media{Content: model.Content{Slug: "media1-slug", Title: "media1 title", AuthorID: 1}, Episodes: 1}
+	assert.NoError(t, ms.CreateMedia(&m))
+	assert.NoError(t, ls.CreateFile(&model.MediaFile{MediaID: m.ID, Episode: 1, Path: "/library/media1 - 01.mkv", Duration: 1400}))
+
+	s := submitSegment(t, 1, `{"segment":{"kind":"intro","start":0,"end":90}}`)
+	assert.NoError(t, ls.SaveVote(&model.SkipVote{SkipSegmentID: s.ID, UserID: 2, Value: 1}))
+
+	// The same range keeps its votes.
+	again := submitSegment(t, 1, `{"segment":{"kind":"intro","start":0,"end":90}}`)
+	assert.Equal(t, s.ID, again.ID)
+	assert.Equal(t, 1, again.Score)
+
+	// A new range has to earn them again.
+	moved := submitSegment(t, 1, `{"segment":{"kind":"intro","start":10,"end":100}}`)
+	assert.Equal(t, s.ID, moved.ID)
+	assert.Equal(t, 0, moved.Score)
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var errRefreshToken = errors.New("invalid or expired refresh token")
+
+// startSession opens a session for u and responds with its tokens.
+// twoFactor tells whether the login passed the second factor.
+func (h *Handler) startSession(c echo.Context, status int, u *model.User, twoFactor bool) error {
+	roles, err := h.tokenRoles(u, twoFactor)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	s := &model.Session{
+		UserID:     u.ID,
+		UserAgent:  c.Request().UserAgent(),
+		IP:         c.RealIP(),
+		LastSeenAt: time.Now(),
+		TwoFactor:  twoFactor,
+	}
+	if err := h.userStore.CreateSession(s); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	refresh, err := h.newRefreshToken(s.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(status, newUserTokenResponse(u, roles, s.ID, refresh))
+}
+
+// tokenRoles are the roles of u its tokens carry. Roles an admin made
+// require a second factor are left out of sessions without one.
+func (h *Handler) tokenRoles(u *model.User, twoFactor bool) ([]string, error) {
+	roles := u.RoleNames()
+	if twoFactor || len(roles) == 0 {
+		return roles, nil
+	}
+
+	settings, err := h.userStore.ListRoleSettings()
+	if err != nil {
+		return nil, err
+	}
+	required := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		required[s.Role] = s.RequireTwoFactor
+	}
+	return user.WithoutTwoFactor(roles, required), nil
+}
+
+func (h *Handler) newRefreshToken(sessionID uint) (string, error) {
+	token, err := utils.NewToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	t := &model.RefreshToken{
+		SessionID: sessionID,
+		Hash:      utils.HashToken(token),
+		ExpiresAt: time.Now().Add(config.Global.RefreshTTL),
+	}
+	if err := h.userStore.CreateRefreshToken(t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Refresh godoc
+// @Summary Refresh the access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token works once; using one again revokes the whole session
+// @ID refresh
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param refreshToken body refreshRequest true "Refresh token"
+// @Success 200 {object} userResponse
+// @Failure 401 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /refresh [post]
+func (h *Handler) Refresh(c echo.Context) error {
+	req := &refreshRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	t, err := h.userStore.GetRefreshToken(utils.HashToken(req.RefreshToken))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if t == nil || t.Session.RevokedAt != nil || time.Now().After(t.ExpiresAt) {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errRefreshToken))
+	}
+
+	fresh, err := h.userStore.UseRefreshToken(t)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if !fresh {
+		// Somebody else holds a copy of the token, end the session for both.
+		if err := h.userStore.RevokeSession(t.SessionID); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errRefreshToken))
+	}
+
+	u, err := h.userStore.GetByID(t.Session.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errRefreshToken))
+	}
+
+	refresh, err := h.newRefreshToken(t.SessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	roles, err := h.tokenRoles(u, t.Session.TwoFactor)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newUserTokenResponse(u, roles, t.SessionID, refresh))
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the current session with its access and refresh tokens. Auth is required
+// @ID logout
+// @Tags user
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /logout [post]
+func (h *Handler) Logout(c echo.Context) error {
+	if jti, ok := c.Get("jti").(string); ok && jti != "" {
+		if err := h.userStore.RevokeToken(jti, time.Now().Add(config.Global.AccessTTL)); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+	}
+
+	if sessionID, ok := c.Get("session").(uint); ok {
+		if err := h.userStore.RevokeSession(sessionID); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Revoke every session of the current user. Auth is required
+// @ID logout-all
+// @Tags user
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /logout/all [post]
+func (h *Handler) LogoutAll(c echo.Context) error {
+	if err := h.userStore.RevokeUserSessions(userIDFromToken(c)); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
+
+// Sessions godoc
+// @Summary List sessions
+// @Description List the devices the current user is logged in on, the most recently used first. Auth is required
+// @ID sessions
+// @Tags user
+// @Produce  json
+// @Success 200 {object} sessionListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/sessions [get]
+func (h *Handler) Sessions(c echo.Context) error {
+	sessions, err := h.userStore.ListSessions(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	current, _ := c.Get("session").(uint)
+	return c.JSON(http.StatusOK, newSessionListResponse(sessions, current, h.seen))
+}
+
+// DeleteSession godoc
+// @Summary Revoke a session
+// @Description Log the current user out of one device. Auth is required
+// @ID delete-session
+// @Tags user
+// @Produce  json
+// @Param id path integer true "ID of the session"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/sessions/{id} [delete]
+func (h *Handler) DeleteSession(c echo.Context) error {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	s, err := h.userStore.GetSession(uint(id64))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if s == nil || s.UserID != userIDFromToken(c) || s.RevokedAt != nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if err := h.userStore.RevokeSession(s.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
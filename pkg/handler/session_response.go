@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+)
+
+type sessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+}
+
+type sessionListResponse struct {
+	Sessions      []*sessionResponse `json:"sessions"`
+	SessionsCount int                `json:"sessionsCount"`
+}
+
+// newSessionListResponse takes the last seen times not written yet from seen.
+func newSessionListResponse(sessions []model.Session, current uint, seen *user.Seen) *sessionListResponse {
+	r := new(sessionListResponse)
+	r.Sessions = make([]*sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		sr := &sessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			Current:    s.ID == current,
+		}
+		if t, ok := seen.Get(s.ID); ok && t.After(sr.LastSeenAt) {
+			sr.LastSeenAt = t
+		}
+		r.Sessions = append(r.Sessions, sr)
+	}
+	r.SessionsCount = len(sessions)
+	return r
+}
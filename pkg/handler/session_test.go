@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+func TestLogoutRevokesToken(t *testing.T) {
+	tearDown()
+	setup()
+	r := routes()
+	token := sessionToken(1)
+	other := sessionToken(1)
+
+	assert.Equal(t, http.StatusOK, request(r, echo.GET, "/api/user", token).Code)
+	assert.Equal(t, http.StatusOK, request(r, echo.POST, "/api/logout", token).Code)
+	assert.Equal(t, http.StatusUnauthorized, request(r, echo.GET, "/api/user", token).Code)
+	assert.Equal(t, http.StatusOK, request(r, echo.GET, "/api/user", other).Code, "other sessions stay")
+}
+
+func TestRevokedSessionAndToken(t *testing.T) {
+	tearDown()
+	setup()
+	r := routes()
+
+	token := sessionToken(1)
+	parsed, err := jwt.Parse(token, config.Global.JWTKeys.Keyfunc)
+	if assert.NoError(t, err) {
+		jti := parsed.Claims.(jwt.MapClaims)["jti"].(string)
+		assert.NoError(t, us.RevokeToken(jti, time.Now().Add(time.Hour)))
+		assert.Equal(t, http.StatusUnauthorized, request(r, echo.GET, "/api/user", token).Code)
+	}
+
+	revoked := sessionToken(2)
+	assert.Equal(t, http.StatusOK, request(r, echo.GET, "/api/user", revoked).Code)
+	assert.NoError(t, us.RevokeUserSessions(2))
+	assert.Equal(t, http.StatusUnauthorized, request(r, echo.GET, "/api/user", revoked).Code)
+}
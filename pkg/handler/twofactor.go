@@ -0,0 +1,409 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/twofactor"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// challengeTTL is how long the second login step may take.
+const challengeTTL = 5 * time.Minute
+
+const qrSize = 256
+
+var (
+	errTwoFactorEnabled     = errors.New("two-factor authentication is enabled already")
+	errTwoFactorDisabled    = errors.New("two-factor authentication is not enabled")
+	errTwoFactorCode        = errors.New("invalid two-factor code")
+	errTwoFactorRequired    = errors.New("two-factor authentication is required for your roles")
+	errTwoFactorNotEnrolled = errors.New("start the enrollment first")
+)
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code of u.
+// Either works once.
+func (h *Handler) checkSecondFactor(u *model.User, code string) (bool, error) {
+	if u.TOTPSecret == nil {
+		return false, nil
+	}
+	if !isTOTPCode(code) {
+		return h.userStore.UseRecoveryCode(u.ID, twofactor.HashRecoveryCode(code))
+	}
+	return h.checkTOTP(u, code)
+}
+
+func (h *Handler) checkTOTP(u *model.User, code string) (bool, error) {
+	step, ok := twofactor.Check(*u.TOTPSecret, code, u.TOTPLastStep, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return h.userStore.UseTOTPStep(u.ID, step)
+}
+
+func isTOTPCode(code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// requiresTwoFactor reports whether one of the roles of u needs a second
+// factor.
+func (h *Handler) requiresTwoFactor(u *model.User) (bool, error) {
+	roles := u.RoleNames()
+	all, err := h.tokenRoles(u, false)
+	if err != nil {
+		return false, err
+	}
+	return len(all) < len(roles), nil
+}
+
+func (h *Handler) newRecoveryCodes(userID uint) ([]string, error) {
+	codes, err := twofactor.NewRecoveryCodes(twofactor.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, twofactor.HashRecoveryCode(c))
+	}
+	if err := h.userStore.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// LoginTwoFactor godoc
+// @Summary Second login step
+// @Description Finish a login with the challenge from /login and a TOTP code or a recovery code
+// @ID login-two-factor
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param login body twoFactorLoginRequest true "Challenge and code"
+// @Success 200 {object} userResponse
+// @Failure 401 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 429 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /login/2fa [post]
+func (h *Handler) LoginTwoFactor(c echo.Context) error {
+	req := &twoFactorLoginRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	t, err := utils.ParseActionToken(utils.ActionTwoFactor, req.Challenge)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByID(t.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(utils.ErrActionInvalid))
+	}
+
+	// The challenge is signed over the password hash, a password change
+	// ends the pending logins.
+	if err := t.Verify(u.Password); err != nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(err))
+	}
+
+	if !u.TwoFactorEnabled() {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errTwoFactorDisabled))
+	}
+
+	// Codes are short, guessing them is throttled like passwords.
+	keys := loginKeys(c, u, u.Email)
+	wait, err := h.loginWait(keys)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if wait > 0 {
+		securityEvent(c, "login_throttled", u.ID, "key="+keys[0].key)
+		return tooManyLogins(c, wait)
+	}
+
+	ok, err := h.checkSecondFactor(u, req.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if !ok {
+		if err := h.loginFailed(c, u, keys, "second factor"); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errTwoFactorCode))
+	}
+
+	if err := h.loginSucceeded(keys); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return h.startSession(c, http.StatusOK, u, true)
+}
+
+// EnrollTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret for the current user. Add it to an authenticator app with the URI or the QR code, then confirm it with a code. Auth is required
+// @ID enroll-totp
+// @Tags user
+// @Produce  json
+// @Success 201 {object} totpEnrollResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/2fa/totp [post]
+func (h *Handler) EnrollTOTP(c echo.Context) error {
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if u.TwoFactorEnabled() {
+		return c.JSON(http.StatusConflict, utils.NewError(errTwoFactorEnabled))
+	}
+
+	secret, err := twofactor.NewSecret()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if err := h.userStore.SetTOTP(u.ID, &secret, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newTOTPEnrollResponse(secret, twofactor.URI(secret, u.Email)))
+}
+
+// TOTPQRCode godoc
+// @Summary TOTP QR code
+// @Description The QR code of the TOTP secret being enrolled, as PNG. Auth is required
+// @ID totp-qr-code
+// @Tags user
+// @Produce  png
+// @Success 200 {file} file
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/2fa/totp/qr.png [get]
+func (h *Handler) TOTPQRCode(c echo.Context) error {
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	// Only shown during enrollment, the secret of an enabled one stays put.
+	if u == nil || u.TOTPSecret == nil || u.TwoFactorEnabled() {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	png, err := twofactor.QR(twofactor.URI(*u.TOTPSecret, u.Email), qrSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, "image/png", png)
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with a code from the authenticator app. The response holds the recovery codes, they are not shown again. Auth is required
+// @ID confirm-totp
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param code body twoFactorCodeRequest true "Code from the app"
+// @Success 200 {object} recoveryCodesResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/2fa/totp/confirm [post]
+func (h *Handler) ConfirmTOTP(c echo.Context) error {
+	req := &twoFactorCodeRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if u.TwoFactorEnabled() {
+		return c.JSON(http.StatusConflict, utils.NewError(errTwoFactorEnabled))
+	}
+
+	if u.TOTPSecret == nil {
+		return c.JSON(http.StatusConflict, utils.NewError(errTwoFactorNotEnrolled))
+	}
+
+	ok, err := h.checkTOTP(u, req.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if !ok {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errTwoFactorCode))
+	}
+
+	now := time.Now()
+	if err := h.userStore.SetTOTP(u.ID, u.TOTPSecret, &now); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	codes, err := h.newRecoveryCodes(u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newRecoveryCodesResponse(codes))
+}
+
+// DisableTOTP godoc
+// @Summary Disable two-factor authentication
+// @Description Remove the TOTP secret and the recovery codes of the current user, confirmed with a code. Not allowed while a role of the user requires it. Auth is required
+// @ID disable-totp
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param code body twoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} utils.Error
+// @Failure 403 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/2fa/totp [delete]
+func (h *Handler) DisableTOTP(c echo.Context) error {
+	req := &twoFactorCodeRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if !u.TwoFactorEnabled() {
+		return c.JSON(http.StatusConflict, utils.NewError(errTwoFactorDisabled))
+	}
+
+	required, err := h.requiresTwoFactor(u)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if required {
+		return c.JSON(http.StatusForbidden, utils.NewError(errTwoFactorRequired))
+	}
+
+	ok, err := h.checkSecondFactor(u, req.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if !ok {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errTwoFactorCode))
+	}
+
+	if err := h.userStore.SetTOTP(u.ID, nil, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if err := h.userStore.ReplaceRecoveryCodes(u.ID, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary New recovery codes
+// @Description Replace the recovery codes of the current user, confirmed with a TOTP code. Auth is required
+// @ID regenerate-recovery-codes
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param code body twoFactorCodeRequest true "Code from the app"
+// @Success 200 {object} recoveryCodesResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/2fa/recovery-codes [post]
+func (h *Handler) RegenerateRecoveryCodes(c echo.Context) error {
+	req := &twoFactorCodeRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	if !u.TwoFactorEnabled() {
+		return c.JSON(http.StatusConflict, utils.NewError(errTwoFactorDisabled))
+	}
+
+	ok, err := h.checkTOTP(u, req.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if !ok {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(errTwoFactorCode))
+	}
+
+	codes, err := h.newRecoveryCodes(u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newRecoveryCodesResponse(codes))
+}
@@ -0,0 +1,33 @@
+package handler
+
+import "github.com/labstack/echo/v4"
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+func (r *twoFactorCodeRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge" validate:"required"`
+	// Code is a TOTP code or a recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+func (r *twoFactorLoginRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+type twoFactorChallengeResponse struct {
+	TwoFactor struct {
+		Challenge string    `json:"challenge"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	} `json:"twoFactor"`
+}
+
+func newTwoFactorChallengeResponse(u *model.User) *twoFactorChallengeResponse {
+	r := new(twoFactorChallengeResponse)
+	r.TwoFactor.ExpiresAt = time.Now().Add(challengeTTL)
+	r.TwoFactor.Challenge = utils.NewActionToken(utils.ActionTwoFactor, u.ID, u.Password, r.TwoFactor.ExpiresAt)
+	return r
+}
+
+type totpEnrollResponse struct {
+	TOTP struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+		QRCode string `json:"qrCode"`
+	} `json:"totp"`
+}
+
+func newTOTPEnrollResponse(secret, uri string) *totpEnrollResponse {
+	r := new(totpEnrollResponse)
+	r.TOTP.Secret = secret
+	r.TOTP.URI = uri
+	r.TOTP.QRCode = "/api/user/2fa/totp/qr.png"
+	return r
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func newRecoveryCodesResponse(codes []string) *recoveryCodesResponse {
+	return &recoveryCodesResponse{RecoveryCodes: codes}
+}
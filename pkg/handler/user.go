@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"log"
+
 	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/config"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 	"github.com/xenking/kitsu-media-server/pkg/utils"
 	"net/http"
@@ -10,7 +13,7 @@ import (
 
 // SignUp godoc
 // @Summary Register a new user
-// @Description Register a new user
+// @Description Register a new user. Depending on the registration mode an invite code is needed, or nobody can register
 // @ID sign-up
 // @ArticleTags user
 // @Accept  json
@@ -18,24 +21,50 @@ import (
 // @Param user body userRegisterRequest true "User info for registration"
 // @Success 201 {object} userResponse
 // @Failure 400 {object} utils.Error
+// @Failure 403 {object} utils.Error
 // @Failure 404 {object} utils.Error
 // @Failure 500 {object} utils.Error
 // @Router /users [post]
 func (h *Handler) SignUp(c echo.Context) error {
+	if config.Global.Registration == config.RegistrationClosed {
+		return c.JSON(http.StatusForbidden, utils.NewError(errRegistrationClosed))
+	}
 	var u model.User
 	req := &userRegisterRequest{}
 	if err := req.bind(c, &u); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
 	}
+	if req.User.Invite == "" && config.Global.Registration == config.RegistrationInviteOnly {
+		return c.JSON(http.StatusForbidden, utils.NewError(errInviteRequired))
+	}
+	var invite *model.Invite
+	if req.User.Invite != "" {
+		var err error
+		invite, err = h.useInvite(req.User.Invite)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		if invite == nil {
+			return c.JSON(http.StatusForbidden, utils.NewError(errInviteInvalid))
+		}
+		u.InvitedByID = &invite.CreatorID
+		u.InviteID = &invite.ID
+	}
 	if err := h.userStore.Create(&u); err != nil {
+		if invite != nil {
+			if err := h.userStore.ReleaseInvite(invite.ID); err != nil {
+				log.Println("invite:", err)
+			}
+		}
 		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
 	}
-	return c.JSON(http.StatusCreated, newUserResponse(&u))
+	h.sendVerification(&u)
+	return h.startSession(c, http.StatusCreated, &u, false)
 }
 
 // Login godoc
 // @Summary Login for existing user
-// @Description Login for existing user
+// @Description Login for existing user. Users with two-factor authentication get a challenge for /login/2fa instead of tokens. Repeated failures of an account or network are delayed and then locked for a while
 // @ID login
 // @ArticleTags user
 // @Accept  json
@@ -46,6 +75,7 @@ func (h *Handler) SignUp(c echo.Context) error {
 // @Failure 401 {object} utils.Error
 // @Failure 422 {object} utils.Error
 // @Failure 404 {object} utils.Error
+// @Failure 429 {object} utils.Error
 // @Failure 500 {object} utils.Error
 // @Router /users/login [post]
 func (h *Handler) Login(c echo.Context) error {
@@ -57,13 +87,40 @@ func (h *Handler) Login(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
-	if u == nil {
-		return c.JSON(http.StatusForbidden, utils.AccessForbidden())
+	keys := loginKeys(c, u, req.User.Email)
+	wait, err := h.loginWait(keys)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
-	if !u.CheckPassword(req.User.Password) {
+	if wait > 0 {
+		securityEvent(c, "login_throttled", keys[0].userID, "key="+keys[0].key)
+		return tooManyLogins(c, wait)
+	}
+	if u == nil || !u.CheckPassword(req.User.Password) {
+		if err := h.loginFailed(c, u, keys, "password"); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
 		return c.JSON(http.StatusForbidden, utils.AccessForbidden())
 	}
-	return c.JSON(http.StatusOK, newUserResponse(u))
+	if u.PasswordNeedsRehash() {
+		// Upgrade the hash while the plain password is at hand. The login
+		// goes on with the old hash if that fails.
+		hash, err := u.HashPassword(req.User.Password)
+		if err == nil {
+			u.Password = hash
+			err = h.userStore.Update(u)
+		}
+		if err != nil {
+			log.Println("rehash:", err)
+		}
+	}
+	if u.TwoFactorEnabled() {
+		return c.JSON(http.StatusOK, newTwoFactorChallengeResponse(u))
+	}
+	if err := h.loginSucceeded(keys); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+	return h.startSession(c, http.StatusOK, u, false)
 }
 
 // CurrentUser godoc
@@ -118,12 +175,21 @@ func (h *Handler) UpdateUser(c echo.Context) error {
 	}
 	req := newUserUpdateRequest()
 	req.populate(u)
+	email := u.Email
 	if err := req.bind(c, u); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
 	}
 	if err := h.userStore.Update(u); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
 	}
+	if u.Email != email {
+		// The new address has to be verified again.
+		if err := h.userStore.SetEmailVerified(u.ID, nil); err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		u.EmailVerifiedAt = nil
+		h.sendVerification(u)
+	}
 	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
 }
 
@@ -155,6 +221,9 @@ func (h *Handler) DeleteUser(c echo.Context) error {
 	if err := h.userStore.Delete(u); err != nil {
 		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
 	}
+	if err := h.userStore.RevokeUserSessions(u.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
 	return c.JSON(http.StatusOK, newUserResponse(u))
 }
 
@@ -295,3 +364,8 @@ func userIDFromToken(c echo.Context) uint {
 	}
 	return id
 }
+
+func rolesFromToken(c echo.Context) []string {
+	roles, _ := c.Get("roles").([]string)
+	return roles
+}
@@ -42,6 +42,9 @@ func (r *userUpdateRequest) bind(c echo.Context, u *model.User) error {
 	u.Username = r.User.Username
 	u.Email = r.User.Email
 	if r.User.Password != u.Password {
+		if err := config.Global.PasswordPolicy.Check(r.User.Password, u.Username, u.Email); err != nil {
+			return err
+		}
 		h, err := u.HashPassword(r.User.Password)
 		if err != nil {
 			return err
@@ -58,6 +61,8 @@ type userRegisterRequest struct {
 		Username string `json:"username" validate:"required"`
 		Email    string `json:"email" validate:"required,email"`
 		Password string `json:"password" validate:"required"`
+		// Invite is required while registration is invite-only.
+		Invite string `json:"invite"`
 	} `json:"user"`
 }
 
@@ -68,6 +73,9 @@ func (r *userRegisterRequest) bind(c echo.Context, u *model.User) error {
 	if err := c.Validate(r); err != nil {
 		return err
 	}
+	if err := config.Global.PasswordPolicy.Check(r.User.Password, r.User.Username, r.User.Email); err != nil {
+		return err
+	}
 	u.Username = r.User.Username
 	u.Email = r.User.Email
 	h, err := u.HashPassword(r.User.Password)
@@ -99,6 +107,8 @@ func (r *userLoginRequest) bind(c echo.Context) error {
 type createCommentRequest struct {
 	Comment struct {
 		Body string `json:"body" validate:"required"`
+		// ParentID is the comment this one replies to.
+		ParentID *uint `json:"parentId"`
 	} `json:"comment"`
 }
 
@@ -5,6 +5,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/xenking/kitsu-media-server/pkg/comment"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 	"github.com/xenking/kitsu-media-server/pkg/user"
 	"github.com/xenking/kitsu-media-server/pkg/utils"
@@ -12,11 +13,16 @@ import (
 
 type userResponse struct {
 	User struct {
-		Username string  `json:"username"`
-		Email    string  `json:"email"`
-		Bio      *string `json:"bio"`
-		Image    *string `json:"image"`
-		Token    string  `json:"token"`
+		Username      string   `json:"username"`
+		Email         string   `json:"email"`
+		EmailVerified bool     `json:"emailVerified"`
+		TwoFactor     bool     `json:"twoFactor"`
+		Bio           *string  `json:"bio"`
+		Image         *string  `json:"image"`
+		Roles         []string `json:"roles"`
+		// Token and RefreshToken are only set on login.
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refreshToken,omitempty"`
 	} `json:"user"`
 }
 
@@ -24,9 +30,21 @@ func newUserResponse(u *model.User) *userResponse {
 	r := new(userResponse)
 	r.User.Username = u.Username
 	r.User.Email = u.Email
+	r.User.EmailVerified = u.EmailVerified()
+	r.User.TwoFactor = u.TwoFactorEnabled()
 	r.User.Bio = u.Bio
 	r.User.Image = u.Image
-	r.User.Token = utils.GenerateJWT(u.ID)
+	r.User.Roles = u.RoleNames()
+	return r
+}
+
+// newUserTokenResponse lists the roles the token grants, which leaves out
+// those that need a second factor the login did not pass.
+func newUserTokenResponse(u *model.User, roles []string, sessionID uint, refreshToken string) *userResponse {
+	r := newUserResponse(u)
+	r.User.Roles = roles
+	r.User.Token = utils.GenerateJWT(u.ID, sessionID, roles...)
+	r.User.RefreshToken = refreshToken
 	return r
 }
 
@@ -68,16 +86,28 @@ func newProfileResponse(us user.Store, userID uint, u *model.User) *profileRespo
 }
 
 type commentResponse struct {
-	ID        uint      `json:"id"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	Author    struct {
-		Username  string  `json:"username"`
-		Bio       *string `json:"bio"`
-		Image     *string `json:"image"`
-		Following bool    `json:"following"`
-	} `json:"author"`
+	ID        uint       `json:"id"`
+	Body      string     `json:"body"`
+	ParentID  *uint      `json:"parentId"`
+	Depth     int        `json:"depth"`
+	Deleted   bool       `json:"deleted"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	EditedAt  *time.Time `json:"editedAt"`
+	Likes     int        `json:"likesCount"`
+	Liked     bool       `json:"liked"`
+	// MoreReplies is set on top level comments whose replies did not all
+	// fit in the page.
+	MoreReplies bool `json:"moreReplies,omitempty"`
+	// Author is null for removed comments.
+	Author *commentAuthor `json:"author"`
+}
+
+type commentAuthor struct {
+	Username  string  `json:"username"`
+	Bio       *string `json:"bio"`
+	Image     *string `json:"image"`
+	Following bool    `json:"following"`
 }
 
 type singleCommentResponse struct {
@@ -85,37 +115,67 @@ type singleCommentResponse struct {
 }
 
 type commentListResponse struct {
-	Comments []commentResponse `json:"comments"`
+	Comments      []commentResponse `json:"comments"`
+	CommentsCount int               `json:"commentsCount"`
+	ThreadsCount  int               `json:"threadsCount"`
+	// NextCursor and PrevCursor page on with after and before, they are
+	// null at the ends.
+	NextCursor *string `json:"nextCursor"`
+	PrevCursor *string `json:"prevCursor"`
 }
 
-func newCommentResponse(c echo.Context, cm *model.Comment) *singleCommentResponse {
-	comment := new(commentResponse)
-	comment.ID = cm.ID
-	comment.Body = cm.Body
-	comment.CreatedAt = cm.CreatedAt
-	comment.UpdatedAt = cm.UpdatedAt
-	comment.Author.Username = cm.User.Username
-	comment.Author.Image = cm.User.Image
-	comment.Author.Bio = cm.User.Bio
-	comment.Author.Following = cm.User.FollowedBy(userIDFromToken(c))
-	return &singleCommentResponse{comment}
+// newComment hides the body and author of removed comments, which are
+// only kept for their replies.
+func newComment(c echo.Context, cm *model.Comment, liked bool) commentResponse {
+	r := commentResponse{
+		ID:        cm.ID,
+		Body:      cm.Body,
+		ParentID:  cm.ParentID,
+		Depth:     cm.Depth,
+		CreatedAt: cm.CreatedAt,
+		UpdatedAt: cm.UpdatedAt,
+		EditedAt:  cm.EditedAt,
+		Likes:     cm.LikesCount,
+		Liked:     liked,
+	}
+	if cm.Removed() {
+		r.Body = comment.DeletedBody
+		r.Deleted = true
+		return r
+	}
+	r.Author = &commentAuthor{
+		Username:  cm.User.Username,
+		Bio:       cm.User.Bio,
+		Image:     cm.User.Image,
+		Following: cm.User.FollowedBy(userIDFromToken(c)),
+	}
+	return r
 }
 
-func newCommentListResponse(c echo.Context, comments []model.Comment) *commentListResponse {
+func newCommentResponse(c echo.Context, cm *model.Comment, liked bool) *singleCommentResponse {
+	comment := newComment(c, cm, liked)
+	return &singleCommentResponse{&comment}
+}
+
+// newCommentListResponse keeps the order of the page, replies come right
+// after their parent.
+func newCommentListResponse(c echo.Context, p *comment.Page, liked map[uint]bool) *commentListResponse {
 	r := new(commentListResponse)
-	cr := commentResponse{}
-	r.Comments = make([]commentResponse, 0)
-	for _, i := range comments {
-		cr.ID = i.ID
-		cr.Body = i.Body
-		cr.CreatedAt = i.CreatedAt
-		cr.UpdatedAt = i.UpdatedAt
-		cr.Author.Username = i.User.Username
-		cr.Author.Image = i.User.Image
-		cr.Author.Bio = i.User.Bio
-		cr.Author.Following = i.User.FollowedBy(userIDFromToken(c))
-
-		r.Comments = append(r.Comments, cr)
+	r.Comments = make([]commentResponse, 0, len(p.Comments))
+	for i := range p.Comments {
+		cm := newComment(c, &p.Comments[i], liked[p.Comments[i].ID])
+		cm.MoreReplies = p.Cut[cm.ID]
+		r.Comments = append(r.Comments, cm)
+	}
+	r.CommentsCount = p.Count
+	r.ThreadsCount = p.Threads
+	if p.Next != nil {
+		next := p.Next.String()
+		r.NextCursor = &next
+	}
+	if p.Prev != nil {
+		prev := p.Prev.String()
+		r.PrevCursor = &prev
 	}
 	return r
 }
@@ -29,7 +29,7 @@ func TestSignUpCaseSuccess(t *testing.T) {
 		assert.Equal(t, "alice", m["username"])
 		assert.Equal(t, "alice@realworld.io", m["email"])
 		assert.Nil(t, m["bio"])
-		assert.Nil(t, m["image"])
+		assert.Equal(t, config.Global.UserImg, m["image"])
 		assert.NotEmpty(t, m["token"])
 	}
 }
@@ -70,10 +70,10 @@ func TestLoginCaseFailed(t *testing.T) {
 func TestCurrentUserCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.GET, "/api/users/login", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	err := jwtMiddleware(func(context echo.Context) error {
@@ -84,17 +84,17 @@ func TestCurrentUserCaseSuccess(t *testing.T) {
 		m := responseMap(rec.Body.Bytes(), "user")
 		assert.Equal(t, "user1", m["username"])
 		assert.Equal(t, "user1@realworld.io", m["email"])
-		assert.NotEmpty(t, m["token"])
+		assert.Nil(t, m["token"])
 	}
 }
 
 func TestCurrentUserCaseInvalid(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.GET, "/api/users/login", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(100)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(100, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	err := jwtMiddleware(func(context echo.Context) error {
@@ -110,10 +110,10 @@ func TestUpdateUserEmail(t *testing.T) {
 	var (
 		user1UpdateReq = `{"user":{"email":"user1@user1.me"}}`
 	)
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.PUT, "/api/user", strings.NewReader(user1UpdateReq))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	err := jwtMiddleware(func(context echo.Context) error {
@@ -121,10 +121,11 @@ func TestUpdateUserEmail(t *testing.T) {
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusOK, rec.Code) {
-		m := responseMap(rec.Body.Bytes(), "user")
-		assert.Equal(t, "user1", m["username"])
-		assert.Equal(t, "user1@user1.me", m["email"])
-		assert.NotEmpty(t, m["token"])
+		u, err := us.GetByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "user1", u.Username)
+		assert.Equal(t, "user1@user1.me", u.Email)
+		assert.False(t, u.EmailVerified())
 	}
 }
 
@@ -134,10 +135,10 @@ func TestUpdateUserMultipleFields(t *testing.T) {
 	var (
 		user1UpdateReq = `{"user":{"username":"user11","email":"user11@user11.me","bio":"user11 bio"}}`
 	)
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.PUT, "/api/user", strings.NewReader(user1UpdateReq))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	err := jwtMiddleware(func(context echo.Context) error {
@@ -145,21 +146,21 @@ func TestUpdateUserMultipleFields(t *testing.T) {
 	})(c)
 	assert.NoError(t, err)
 	if assert.Equal(t, http.StatusOK, rec.Code) {
-		m := responseMap(rec.Body.Bytes(), "user")
-		assert.Equal(t, "user11", m["username"])
-		assert.Equal(t, "user11@user11.me", m["email"])
-		assert.Equal(t, "user11 bio", m["bio"])
-		assert.NotEmpty(t, m["token"])
+		u, err := us.GetByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "user11", u.Username)
+		assert.Equal(t, "user11@user11.me", u.Email)
+		assert.Equal(t, "user11 bio", *u.Bio)
 	}
 }
 
 func TestGetProfileCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.GET, "/api/users/:username", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/users/:username")
@@ -181,10 +182,10 @@ func TestGetProfileCaseSuccess(t *testing.T) {
 func TestGetProfileCaseNotFound(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.GET, "/api/users/:username", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/users/:username")
@@ -200,10 +201,10 @@ func TestGetProfileCaseNotFound(t *testing.T) {
 func TestFollowCaseSuccess(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.POST, "/", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/users/:username/follow")
@@ -225,10 +226,10 @@ func TestFollowCaseSuccess(t *testing.T) {
 func TestFollowCaseInvalidUser(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.POST, "/", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/users/:username/follow")
@@ -244,10 +245,10 @@ func TestFollowCaseInvalidUser(t *testing.T) {
 func TestUnfollow(t *testing.T) {
 	tearDown()
 	setup()
-	jwtMiddleware := middleware.JWT(config.Global.JWTSecret)
+	jwtMiddleware := middleware.JWT(config.Global.JWTKeys)
 	req := httptest.NewRequest(echo.DELETE, "/api/users/:username/follow", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1)))
+	req.Header.Set(echo.HeaderAuthorization, authHeader(utils.GenerateJWT(1, 0)))
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 	c.SetPath("/api/users/:username/follow")
@@ -0,0 +1,411 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn"
+)
+
+var (
+	errWebAuthnChallenge  = errors.New("invalid or expired passkey challenge")
+	errWebAuthnCredential = errors.New("unknown passkey")
+	errWebAuthnRegistered = errors.New("the passkey is registered already")
+)
+
+// webAuthnUserHandle is the user ID as the authenticator stores it. It
+// comes back on login with discoverable credentials.
+func webAuthnUserHandle(userID uint) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+func encodeCredentialID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// newWebAuthnChallenge starts a ceremony. Its challenge is stored hashed
+// until the ceremony finishes or times out.
+func (h *Handler) newWebAuthnChallenge(ceremony string, userID uint) ([]byte, error) {
+	token, err := utils.NewToken(32)
+	if err != nil {
+		return nil, err
+	}
+	ch := &model.WebAuthnChallenge{
+		Hash:      utils.HashToken(token),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(h.relyingParty.Timeout()),
+	}
+	if err := h.userStore.SaveWebAuthnChallenge(ch); err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(token)
+}
+
+// takeWebAuthnChallenge finds the ceremony clientDataJSON answers and ends
+// it. It returns nil for unknown, expired and used challenges.
+func (h *Handler) takeWebAuthnChallenge(clientDataJSON []byte, ceremony string) (*model.WebAuthnChallenge, []byte, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return nil, nil, nil
+	}
+	ch, err := h.userStore.TakeWebAuthnChallenge(utils.HashToken(base64.RawURLEncoding.EncodeToString(challenge)))
+	if err != nil || ch == nil || ch.Ceremony != ceremony {
+		return nil, nil, err
+	}
+	return ch, challenge, nil
+}
+
+// BeginWebAuthnRegistration godoc
+// @Summary Start passkey registration
+// @Description Get the options for navigator.credentials.create to add a passkey to the current user. Auth is required
+// @ID begin-webauthn-registration
+// @Tags user
+// @Produce  json
+// @Success 200 {object} webAuthnOptionsResponse
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/webauthn/register [post]
+func (h *Handler) BeginWebAuthnRegistration(c echo.Context) error {
+	u, err := h.userStore.GetByID(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+
+	credentials, err := h.userStore.ListWebAuthnCredentials(u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+	exclude := make([][]byte, 0, len(credentials))
+	for _, cr := range credentials {
+		if id, err := base64.RawURLEncoding.DecodeString(cr.CredentialID); err == nil {
+			exclude = append(exclude, id)
+		}
+	}
+
+	challenge, err := h.newWebAuthnChallenge(model.CeremonyRegister, u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	o := h.relyingParty.CreationOptions(challenge, webAuthnUserHandle(u.ID), u.Email, u.Username, exclude)
+	return c.JSON(http.StatusOK, &webAuthnOptionsResponse{PublicKey: o})
+}
+
+// FinishWebAuthnRegistration godoc
+// @Summary Finish passkey registration
+// @Description Store the passkey navigator.credentials.create returned. Auth is required
+// @ID finish-webauthn-registration
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param credential body webAuthnRegisterRequest true "Name and credential"
+// @Success 201 {object} singleWebAuthnCredentialResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 409 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/webauthn/register/finish [post]
+func (h *Handler) FinishWebAuthnRegistration(c echo.Context) error {
+	req := &webAuthnRegisterRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	userID := userIDFromToken(c)
+	ch, challenge, err := h.takeWebAuthnChallenge(req.Credential.Response.ClientDataJSON, model.CeremonyRegister)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if ch == nil || ch.UserID != userID {
+		return c.JSON(http.StatusBadRequest, utils.NewError(errWebAuthnChallenge))
+	}
+
+	cred, err := h.relyingParty.VerifyRegistration(req.Credential, challenge)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	id := encodeCredentialID(cred.ID)
+	existing, err := h.userStore.GetWebAuthnCredentialByCredentialID(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if existing != nil {
+		return c.JSON(http.StatusConflict, utils.NewError(errWebAuthnRegistered))
+	}
+
+	name := req.Name
+	if name == "" {
+		credentials, err := h.userStore.ListWebAuthnCredentials(userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		name = fmt.Sprintf("Passkey %d", len(credentials)+1)
+	}
+
+	m := &model.WebAuthnCredential{
+		UserID:       userID,
+		Name:         name,
+		CredentialID: id,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+	}
+	if err := h.userStore.CreateWebAuthnCredential(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusCreated, newSingleWebAuthnCredentialResponse(m))
+}
+
+// WebAuthnCredentials godoc
+// @Summary List passkeys
+// @Description List the passkeys of the current user. Auth is required
+// @ID webauthn-credentials
+// @Tags user
+// @Produce  json
+// @Success 200 {object} webAuthnCredentialListResponse
+// @Failure 401 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/webauthn/credentials [get]
+func (h *Handler) WebAuthnCredentials(c echo.Context) error {
+	credentials, err := h.userStore.ListWebAuthnCredentials(userIDFromToken(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newWebAuthnCredentialListResponse(credentials))
+}
+
+// ownWebAuthnCredential returns the credential of the path if it belongs to
+// the current user, or responds.
+func (h *Handler) ownWebAuthnCredential(c echo.Context) (*model.WebAuthnCredential, error) {
+	id64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, c.JSON(http.StatusBadRequest, utils.NewError(err))
+	}
+
+	cred, err := h.userStore.GetWebAuthnCredential(uint(id64))
+	if err != nil {
+		return nil, c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if cred == nil || cred.UserID != userIDFromToken(c) {
+		return nil, c.JSON(http.StatusNotFound, utils.NotFound())
+	}
+	return cred, nil
+}
+
+// UpdateWebAuthnCredential godoc
+// @Summary Rename a passkey
+// @Description Rename a passkey of the current user. Auth is required
+// @ID update-webauthn-credential
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param id path integer true "ID of the passkey"
+// @Param credential body webAuthnCredentialUpdateRequest true "New name"
+// @Success 200 {object} singleWebAuthnCredentialResponse
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/webauthn/credentials/{id} [put]
+func (h *Handler) UpdateWebAuthnCredential(c echo.Context) error {
+	cred, err := h.ownWebAuthnCredential(c)
+	if cred == nil {
+		return err
+	}
+
+	req := &webAuthnCredentialUpdateRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	cred.Name = req.Name
+	if err := h.userStore.UpdateWebAuthnCredential(cred); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, newSingleWebAuthnCredentialResponse(cred))
+}
+
+// DeleteWebAuthnCredential godoc
+// @Summary Remove a passkey
+// @Description Remove a passkey of the current user, it cannot log in anymore. Auth is required
+// @ID delete-webauthn-credential
+// @Tags user
+// @Produce  json
+// @Param id path integer true "ID of the passkey"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.Error
+// @Failure 401 {object} utils.Error
+// @Failure 404 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Security ApiKeyAuth
+// @Router /user/webauthn/credentials/{id} [delete]
+func (h *Handler) DeleteWebAuthnCredential(c echo.Context) error {
+	cred, err := h.ownWebAuthnCredential(c)
+	if cred == nil {
+		return err
+	}
+
+	if err := h.userStore.DeleteWebAuthnCredential(cred); err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"result": "ok"})
+}
+
+// BeginWebAuthnLogin godoc
+// @Summary Start passkey login
+// @Description Get the options for navigator.credentials.get. With a username only its passkeys are allowed, without one the authenticator offers what it has for the site
+// @ID begin-webauthn-login
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param login body webAuthnLoginStartRequest false "Username"
+// @Success 200 {object} webAuthnOptionsResponse
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /login/webauthn [post]
+func (h *Handler) BeginWebAuthnLogin(c echo.Context) error {
+	req := &webAuthnLoginStartRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	var (
+		userID uint
+		allow  [][]byte
+	)
+	if req.Username != "" {
+		u, err := h.userStore.GetByUsername(req.Username)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+		}
+		// Unknown users get the same answer as users without passkeys.
+		if u != nil {
+			userID = u.ID
+			credentials, err := h.userStore.ListWebAuthnCredentials(u.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+			}
+			for _, cr := range credentials {
+				if id, err := base64.RawURLEncoding.DecodeString(cr.CredentialID); err == nil {
+					allow = append(allow, id)
+				}
+			}
+		}
+	}
+
+	challenge, err := h.newWebAuthnChallenge(model.CeremonyLogin, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	return c.JSON(http.StatusOK, &webAuthnOptionsResponse{PublicKey: h.relyingParty.RequestOptions(challenge, allow)})
+}
+
+// FinishWebAuthnLogin godoc
+// @Summary Finish passkey login
+// @Description Log in with the assertion navigator.credentials.get returned. A passkey that verified the user counts as two factors; otherwise users with TOTP get a challenge for /login/2fa as with a password
+// @ID finish-webauthn-login
+// @Tags user
+// @Accept  json
+// @Produce  json
+// @Param login body webAuthnLoginRequest true "Credential"
+// @Success 200 {object} userResponse
+// @Failure 401 {object} utils.Error
+// @Failure 422 {object} utils.Error
+// @Failure 500 {object} utils.Error
+// @Router /login/webauthn/finish [post]
+func (h *Handler) FinishWebAuthnLogin(c echo.Context) error {
+	req := &webAuthnLoginRequest{}
+	if err := req.bind(c); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, utils.NewError(err))
+	}
+
+	ch, challenge, err := h.takeWebAuthnChallenge(req.Credential.Response.ClientDataJSON, model.CeremonyLogin)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if ch == nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errWebAuthnChallenge))
+	}
+
+	m, err := h.userStore.GetWebAuthnCredentialByCredentialID(encodeCredentialID(req.Credential.RawID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if m == nil || (ch.UserID != 0 && ch.UserID != m.UserID) {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errWebAuthnCredential))
+	}
+
+	handle := req.Credential.Response.UserHandle
+	if len(handle) > 0 && string(handle) != string(webAuthnUserHandle(m.UserID)) {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errWebAuthnCredential))
+	}
+
+	cred, err := h.relyingParty.VerifyAssertion(req.Credential, challenge, &webauthn.Credential{
+		ID:        req.Credential.RawID,
+		PublicKey: m.PublicKey,
+		SignCount: m.SignCount,
+	})
+	if err != nil {
+		if err == webauthn.ErrSignCount {
+			log.Printf("webauthn: credential %d of user %d: %v", m.ID, m.UserID, err)
+		}
+		return c.JSON(http.StatusUnauthorized, utils.NewError(err))
+	}
+
+	ok, err := h.userStore.UseWebAuthnCredential(m, cred.SignCount)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	// Another login with the same count got in first.
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(webauthn.ErrSignCount))
+	}
+
+	u, err := h.userStore.GetByID(m.UserID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+
+	if u == nil {
+		return c.JSON(http.StatusUnauthorized, utils.NewError(errWebAuthnCredential))
+	}
+
+	if !cred.UserVerified && u.TwoFactorEnabled() {
+		return c.JSON(http.StatusOK, newTwoFactorChallengeResponse(u))
+	}
+	return h.startSession(c, http.StatusOK, u, cred.UserVerified)
+}
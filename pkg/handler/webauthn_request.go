@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn"
+)
+
+type webAuthnRegisterRequest struct {
+	Name       string                        `json:"name" validate:"max=64"`
+	Credential *webauthn.AttestationResponse `json:"credential" validate:"required"`
+}
+
+func (r *webAuthnRegisterRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type webAuthnLoginStartRequest struct {
+	// Username is optional, without it the authenticator offers its
+	// passkeys for the site.
+	Username string `json:"username"`
+}
+
+func (r *webAuthnLoginStartRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type webAuthnLoginRequest struct {
+	Credential *webauthn.AssertionResponse `json:"credential" validate:"required"`
+}
+
+func (r *webAuthnLoginRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type webAuthnCredentialUpdateRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+func (r *webAuthnCredentialUpdateRequest) bind(c echo.Context) error {
+	if err := c.Bind(r); err != nil {
+		return err
+	}
+	if err := c.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type webAuthnCredentialResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+func newWebAuthnCredentialResponse(c *model.WebAuthnCredential) *webAuthnCredentialResponse {
+	return &webAuthnCredentialResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+type singleWebAuthnCredentialResponse struct {
+	Credential *webAuthnCredentialResponse `json:"credential"`
+}
+
+func newSingleWebAuthnCredentialResponse(c *model.WebAuthnCredential) *singleWebAuthnCredentialResponse {
+	return &singleWebAuthnCredentialResponse{Credential: newWebAuthnCredentialResponse(c)}
+}
+
+type webAuthnCredentialListResponse struct {
+	Credentials      []*webAuthnCredentialResponse `json:"credentials"`
+	CredentialsCount int                           `json:"credentialsCount"`
+}
+
+func newWebAuthnCredentialListResponse(credentials []model.WebAuthnCredential) *webAuthnCredentialListResponse {
+	r := new(webAuthnCredentialListResponse)
+	r.Credentials = make([]*webAuthnCredentialResponse, 0, len(credentials))
+	for i := range credentials {
+		r.Credentials = append(r.Credentials, newWebAuthnCredentialResponse(&credentials[i]))
+	}
+	r.CredentialsCount = len(credentials)
+	return r
+}
+
+type webAuthnOptionsResponse struct {
+	PublicKey interface{} `json:"publicKey"`
+}
@@ -0,0 +1,285 @@
+// Package keyset holds the keys access tokens are signed and verified with.
+// Tokens name their key in the kid header, so the key that signs can change
+// while the tokens signed with the others are still valid. With rotation,
+// each key is next, active, retiring and finally retired on a schedule
+// that all instances with the same configuration agree on.
+package keyset
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// MinSecretLength is the shortest HMAC secret accepted, as long as the
+// SHA-256 output.
+const MinSecretLength = 32
+
+const rsaBits = 2048
+
+var (
+	ErrWeakSecret   = fmt.Errorf("the JWT secret must be at least %d bytes long", MinSecretLength)
+	ErrNoKeys       = errors.New("no JWT signing keys configured")
+	ErrUnknownKey   = errors.New("unknown JWT signing key")
+	ErrUnknownAlg   = errors.New("unknown JWT algorithm")
+	ErrKeyAlgorithm = errors.New("JWT algorithm does not match its key")
+	ErrRotateKeys   = errors.New("JWT key rotation needs at least two keys, the time the first one started signing and an overlap")
+	ErrRetiredKey   = errors.New("JWT signing key is retired")
+	ErrNoActiveKey  = errors.New("no JWT signing key is active")
+)
+
+// States of a key.
+const (
+	// StateNext keys are published but do not sign or verify yet.
+	StateNext = "next"
+	// StateActive keys sign new tokens.
+	StateActive = "active"
+	// StateRetiring keys no longer sign but still verify the tokens they
+	// signed.
+	StateRetiring = "retiring"
+	// StateRetired keys are of no use any more and can be removed.
+	StateRetired = "retired"
+)
+
+// Key is one signing key. HMAC keys are their own public key.
+type Key struct {
+	ID      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+	// NotBefore is when the key starts signing, SignUntil when it stops and
+	// VerifyUntil when the tokens it signed stop verifying. Zero times are
+	// open ended.
+	NotBefore   time.Time
+	SignUntil   time.Time
+	VerifyUntil time.Time
+}
+
+// State is what the key is used for at now.
+func (k *Key) State(now time.Time) string {
+	switch {
+	case now.Before(k.NotBefore):
+		return StateNext
+	case k.SignUntil.IsZero() || now.Before(k.SignUntil):
+		return StateActive
+	case k.VerifyUntil.IsZero() || now.Before(k.VerifyUntil):
+		return StateRetiring
+	}
+	return StateRetired
+}
+
+// Options configure a Set.
+type Options struct {
+	Alg string
+	// Secret is the HS256 key when Keys is empty.
+	Secret []byte
+	// Keys are HS256 keys from NewHMACKey or RS256 and EdDSA keys from
+	// ParsePEM. Without Rotate the first one signs and all of them verify.
+	Keys []*Key
+	// Rotate moves signing on to the next of Keys that often, counted from
+	// From, when the first one started signing. The last key keeps signing
+	// once it is reached, so keys are added before that. A key that stops
+	// signing verifies its tokens for Overlap more, which has to cover the
+	// lifetime of the tokens, and is retired then.
+	Rotate  time.Duration
+	From    time.Time
+	Overlap time.Duration
+}
+
+type Set struct {
+	alg  string
+	keys []*Key
+	now  func() time.Time
+}
+
+// New checks the options and returns the key set.
+func New(o Options) (*Set, error) {
+	method := jwt.GetSigningMethod(o.Alg)
+	if method == nil || (o.Alg != HS256 && o.Alg != RS256 && o.Alg != EdDSA) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAlg, o.Alg)
+	}
+
+	s := &Set{alg: o.Alg, keys: o.Keys, now: time.Now}
+	if len(s.keys) == 0 && o.Alg == HS256 {
+		// Derive the ID from the secret, so that changing it doesn't leave
+		// tokens claiming a key they were not signed with.
+		sum := sha256.Sum256(o.Secret)
+		k, err := NewHMACKey("hs-"+hex.EncodeToString(sum[:4]), o.Secret)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = []*Key{k}
+	}
+	if len(s.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	for _, k := range s.keys {
+		if k.method != method {
+			return nil, fmt.Errorf("%w: key %s is not for %s", ErrKeyAlgorithm, k.ID, o.Alg)
+		}
+	}
+
+	if o.Rotate > 0 {
+		if len(s.keys) < 2 || o.From.IsZero() || o.Overlap <= 0 {
+			return nil, ErrRotateKeys
+		}
+		for i, k := range s.keys {
+			if i > 0 {
+				k.NotBefore = o.From.Add(time.Duration(i) * o.Rotate)
+			}
+			if i < len(s.keys)-1 {
+				k.SignUntil = o.From.Add(time.Duration(i+1) * o.Rotate)
+				k.VerifyUntil = k.SignUntil.Add(o.Overlap)
+			}
+		}
+	}
+	return s, nil
+}
+
+// NewHMACKey returns an HS256 key.
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < MinSecretLength {
+		return nil, ErrWeakSecret
+	}
+	return &Key{
+		ID:      id,
+		method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}, nil
+}
+
+// ParsePEM reads a PKCS #8 RSA or Ed25519 private key, or a PKCS #1 RSA one.
+func ParsePEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data", id)
+	}
+
+	var (
+		private interface{}
+		err     error
+	)
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < rsaBits {
+			return nil, fmt.Errorf("key %s: RSA keys must have at least %d bits", id, rsaBits)
+		}
+		return &Key{ID: id, method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, method: SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %T", id, private)
+}
+
+// signer is the key that signs at now, the first active one.
+func (s *Set) signer(now time.Time) *Key {
+	for _, k := range s.keys {
+		if k.State(now) == StateActive {
+			return k
+		}
+	}
+	return nil
+}
+
+// Sign signs the claims with the active key.
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	k := s.signer(s.now())
+	if k == nil {
+		return "", ErrNoActiveKey
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.private)
+}
+
+// Keyfunc finds the key a token was signed with, for jwt.Parse. Only active
+// and retiring keys verify.
+func (s *Set) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	now := s.now()
+	for _, k := range s.keys {
+		if k.ID != kid {
+			continue
+		}
+		switch k.State(now) {
+		case StateNext:
+			return nil, ErrUnknownKey
+		case StateRetired:
+			return nil, ErrRetiredKey
+		}
+		// The algorithm comes from the token, never let it pick another
+		// one than the key's.
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, ErrKeyAlgorithm
+		}
+		return k.public, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS lists the public keys tokens can currently be verified with, and the
+// next ones so that verifiers know them before they sign. HMAC keys are
+// secret and never listed.
+func (s *Set) JWKS() []JWK {
+	now := s.now()
+	keys := make([]JWK, 0, len(s.keys))
+	for _, k := range s.keys {
+		if k.State(now) == StateRetired {
+			continue
+		}
+		jwk := JWK{Kid: k.ID, Alg: k.method.Alg(), Use: "sig"}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
@@ -0,0 +1,195 @@
+package keyset
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(s *Set, token string) error {
+	_, err := jwt.Parse(token, s.Keyfunc)
+	return err
+}
+
+func TestWeakSecret(t *testing.T) {
+	_, err := New(Options{Alg: HS256})
+	assert.Equal(t, ErrWeakSecret, err)
+	_, err = New(Options{Alg: HS256, Secret: []byte("secret")})
+	assert.Equal(t, ErrWeakSecret, err)
+	_, err = New(Options{Alg: "none", Secret: []byte(strings.Repeat("s", 32))})
+	assert.Error(t, err)
+	_, err = New(Options{Alg: EdDSA})
+	assert.Equal(t, ErrNoKeys, err)
+}
+
+// newKey generates a key the way ParsePEM would read it.
+func newKey(t *testing.T, alg, id string) *Key {
+	var private interface{}
+	switch alg {
+	case RS256:
+		private, _ = rsa.GenerateKey(rand.Reader, rsaBits)
+	case EdDSA:
+		_, private, _ = ed25519.GenerateKey(rand.Reader)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ParsePEM(id, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func newSet(t *testing.T, alg string) *Set {
+	o := Options{Alg: alg}
+	if alg == HS256 {
+		o.Secret = make([]byte, MinSecretLength)
+		rand.Read(o.Secret)
+	} else {
+		o.Keys = []*Key{newKey(t, alg, "k1")}
+	}
+	s, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{HS256, RS256, EdDSA} {
+		s := newSet(t, alg)
+		token, err := s.Sign(jwt.MapClaims{"id": 1})
+		assert.NoError(t, err, alg)
+		assert.NoError(t, parse(s, token), alg)
+
+		other := newSet(t, alg)
+		assert.Error(t, parse(other, token), "%s: signed by a key of another set", alg)
+	}
+}
+
+func TestAlgorithmMismatch(t *testing.T) {
+	s := newSet(t, EdDSA)
+
+	// An HMAC token naming the EdDSA key, keyed with its public key.
+	kid := s.keys[0].ID
+	pub := s.keys[0].public.(ed25519.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 1})
+	forged.Header["kid"] = kid
+	token, err := forged.SignedString([]byte(pub))
+	assert.NoError(t, err)
+	assert.Error(t, parse(s, token))
+}
+
+// at moves the clock of the set.
+func at(s *Set, now time.Time) {
+	s.now = func() time.Time { return now }
+}
+
+func TestRotate(t *testing.T) {
+	a, b, c := newKey(t, EdDSA, "a"), newKey(t, EdDSA, "b"), newKey(t, EdDSA, "c")
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := New(Options{Alg: EdDSA, Keys: []*Key{a}, Rotate: time.Hour, From: from, Overlap: time.Minute})
+	assert.Equal(t, ErrRotateKeys, err)
+	_, err = New(Options{Alg: EdDSA, Keys: []*Key{a, b}, Rotate: time.Hour, Overlap: time.Minute})
+	assert.Equal(t, ErrRotateKeys, err)
+	_, err = New(Options{Alg: EdDSA, Keys: []*Key{a, b}, Rotate: time.Hour, From: from})
+	assert.Equal(t, ErrRotateKeys, err)
+
+	o := Options{Alg: EdDSA, Keys: []*Key{a, b, c}, Rotate: time.Hour, From: from, Overlap: 10 * time.Minute}
+	s, err := New(o)
+	assert.NoError(t, err)
+	assert.Equal(t, StateActive, a.State(from))
+	assert.Equal(t, StateNext, b.State(from))
+	assert.Equal(t, "a", s.signer(from).ID)
+	assert.Equal(t, "b", s.signer(from.Add(time.Hour)).ID)
+	assert.Equal(t, "c", s.signer(from.Add(2*time.Hour)).ID)
+	// The last key keeps signing, the retired ones never come back.
+	assert.Equal(t, "c", s.signer(from.Add(5*time.Hour)).ID)
+
+	// Other instances and restarts with the same keys sign with the same
+	// one and verify the tokens of each other.
+	other, err := New(o)
+	assert.NoError(t, err)
+	at(s, from.Add(30*time.Minute))
+	at(other, from.Add(30*time.Minute))
+	assert.Equal(t, s.signer(s.now()).ID, other.signer(other.now()).ID)
+	token, _ := s.Sign(jwt.MapClaims{"id": 1})
+	assert.NoError(t, parse(other, token))
+	assert.Len(t, s.JWKS(), 3)
+
+	// Tokens of the old key verify during the overlap and not after it.
+	at(s, from.Add(time.Hour+5*time.Minute))
+	assert.Equal(t, StateRetiring, a.State(s.now()))
+	assert.NoError(t, parse(s, token))
+	at(s, from.Add(time.Hour+10*time.Minute))
+	assert.Equal(t, StateRetired, a.State(s.now()))
+	err = parse(s, token)
+	assert.Error(t, err)
+	assert.Equal(t, ErrRetiredKey, err.(*jwt.ValidationError).Inner)
+	assert.Len(t, s.JWKS(), 2)
+
+	// A key that has not started signing does not verify yet.
+	at(s, from)
+	forged := jwt.NewWithClaims(c.method, jwt.MapClaims{"id": 1})
+	forged.Header["kid"] = "c"
+	signed, _ := forged.SignedString(c.private)
+	assert.Error(t, parse(s, signed))
+}
+
+func TestRotateHMAC(t *testing.T) {
+	_, err := NewHMACKey("a", []byte("secret"))
+	assert.Equal(t, ErrWeakSecret, err)
+	a, _ := NewHMACKey("a", []byte(strings.Repeat("a", 32)))
+	b, _ := NewHMACKey("b", []byte(strings.Repeat("b", 32)))
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := New(Options{Alg: HS256, Keys: []*Key{a, b}, Rotate: time.Hour, From: from, Overlap: time.Minute})
+	assert.NoError(t, err)
+
+	at(s, from)
+	token, _ := s.Sign(jwt.MapClaims{"id": 1})
+	at(s, from.Add(time.Hour))
+	assert.NoError(t, parse(s, token))
+	next, _ := s.Sign(jwt.MapClaims{"id": 1})
+	assert.NotEqual(t, token, next)
+	at(s, from.Add(2*time.Hour))
+	assert.Error(t, parse(s, token))
+	assert.NoError(t, parse(s, next))
+	assert.Empty(t, s.JWKS())
+}
+
+func TestParsePEM(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	k, err := ParsePEM("ed1", data)
+	assert.NoError(t, err)
+	_, err = New(Options{Alg: RS256, Keys: []*Key{k}})
+	assert.Error(t, err, "an EdDSA key cannot sign RS256")
+
+	s, err := New(Options{Alg: EdDSA, Keys: []*Key{k}})
+	assert.NoError(t, err)
+	if jwks := s.JWKS(); assert.Len(t, jwks, 1) {
+		assert.Equal(t, "ed1", jwks[0].Kid)
+		assert.Equal(t, "OKP", jwks[0].Kty)
+	}
+
+	_, err = ParsePEM("bad", []byte("nope"))
+	assert.Error(t, err)
+}
+
+func TestHMACNotListed(t *testing.T) {
+	s, err := New(Options{Alg: HS256, Secret: []byte(strings.Repeat("s", 32))})
+	assert.NoError(t, err)
+	assert.Empty(t, s.JWKS())
+}
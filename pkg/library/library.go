@@ -0,0 +1,107 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/probe"
+)
+
+var ErrOutsideLibrary = errors.New("file is outside of the configured library roots")
+
+type Store interface {
+	GetFileByID(uint) (*model.MediaFile, error)
+	GetFileByPath(string) (*model.MediaFile, error)
+	CreateFile(*model.MediaFile) error
+	UpdateFile(*model.MediaFile) error
+	DeleteFile(*model.MediaFile) error
+	ListFiles(mediaID uint) ([]model.MediaFile, error)
+	ListEpisodeFiles(mediaID uint, episode int) ([]model.MediaFile, error)
+	ListFilesUnder(dir string) ([]model.MediaFile, error)
+
+	ListPendingFiles(limit int, now time.Time) ([]model.MediaFile, error)
+	ListCorruptedFiles(offset, limit int) ([]model.MediaFile, int, error)
+	SaveChecksum(*model.MediaFile) error
+	SaveChecksumRetry(*model.MediaFile) error
+
+	GetProgress(userID, mediaID uint) (*model.MediaProgress, error)
+	SaveProgress(*model.MediaProgress) error
+	GetPosition(userID, mediaID uint, episode int) (*model.PlaybackPosition, error)
+	SavePosition(*model.PlaybackPosition) error
+	ListInProgress(userID uint, offset, limit int) ([]model.PlaybackPosition, int, error)
+	AddHistory(*model.WatchHistory) error
+	ListHistory(userID uint, offset, limit int) ([]model.WatchHistory, int, error)
+
+	GetMediaIDByExternalID(provider, id string) (uint, error)
+	AddExternalID(*model.MediaExternalID) error
+
+	GetSegment(id uint) (*model.SkipSegment, error)
+	GetUserSegment(userID, mediaID uint, episode int, kind string) (*model.SkipSegment, error)
+	SaveSegment(*model.SkipSegment) error
+	ReplaceSegment(*model.SkipSegment) error
+	ListSegments(mediaID uint, episode int) ([]model.SkipSegment, error)
+	SaveVote(*model.SkipVote) error
+	ListReputations(userIDs []uint) (map[uint]int, error)
+}
+
+// Resolve cleans path and makes sure it points inside one of the roots.
+func Resolve(path string, roots []string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if abs == root || strings.HasPrefix(abs, root+string(filepath.Separator)) {
+			return abs, nil
+		}
+	}
+	return "", ErrOutsideLibrary
+}
+
+// Probe reads the container headers of f.Path and stores the results on f.
+func Probe(f *model.MediaFile) error {
+	st, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	info, err := probe.File(f.Path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	f.Size = st.Size()
+	f.Format = info.Format
+	f.Duration = info.Duration.Seconds()
+	f.Width = info.Width
+	f.Height = info.Height
+	f.VideoCodec = info.VideoCodec
+	f.ProbedAt = &now
+	f.Tracks = make([]model.MediaTrack, 0, len(info.Audio)+len(info.Subtitles))
+	for _, t := range info.Audio {
+		f.Tracks = append(f.Tracks, newTrack(model.TrackAudio, t))
+	}
+	for _, t := range info.Subtitles {
+		f.Tracks = append(f.Tracks, newTrack(model.TrackSubtitle, t))
+	}
+	return nil
+}
+
+func newTrack(kind string, t probe.Track) model.MediaTrack {
+	return model.MediaTrack{
+		Kind:     kind,
+		Number:   t.Number,
+		Codec:    t.Codec,
+		Language: t.Language,
+		Name:     t.Name,
+		Default:  t.Default,
+		Forced:   t.Forced,
+	}
+}
@@ -0,0 +1,64 @@
+package library
+
+import (
+	"strconv"
+
+	"github.com/gosimple/slug"
+	"github.com/xenking/kitsu-media-server/pkg/media"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/release"
+)
+
+// Matcher finds the media a parsed release belongs to.
+type Matcher struct {
+	medias media.Store
+}
+
+func NewMatcher(ms media.Store) *Matcher {
+	return &Matcher{
+		medias: ms,
+	}
+}
+
+// Match looks the release up by the slug of its title, the same way media
+// slugs are made on creation. Later seasons are usually separate entries,
+// so their common title suffixes are tried first.
+func (m *Matcher) Match(r release.Release) (*model.Media, error) {
+	if r.Title == "" || r.Episode <= 0 {
+		return nil, nil
+	}
+	var candidates []string
+	if r.Season > 1 {
+		s := strconv.Itoa(r.Season)
+		candidates = append(candidates,
+			r.Title+" Season "+s,
+			r.Title+" "+s+ordinal(r.Season)+" Season",
+			r.Title+" "+s,
+		)
+	}
+	candidates = append(candidates, r.Title)
+	for _, title := range candidates {
+		med, err := m.medias.GetBySlug(slug.Make(title))
+		if err != nil {
+			return nil, err
+		}
+		if med != nil {
+			return med, nil
+		}
+	}
+	return nil, nil
+}
+
+func ordinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return "th"
+	case n%10 == 1:
+		return "st"
+	case n%10 == 2:
+		return "nd"
+	case n%10 == 3:
+		return "rd"
+	}
+	return "th"
+}
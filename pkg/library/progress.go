@@ -0,0 +1,63 @@
+package library
+
+import "github.com/xenking/kitsu-media-server/pkg/model"
+
+// Watched reports whether position is far enough into an episode of the
+// given duration for it to count as watched. percent is in the 0-100 range.
+func Watched(position, duration, percent float64) bool {
+	return duration > 0 && position >= duration*percent/100
+}
+
+// Advance records episode as the last one the user watched of a media,
+// unless they are already further along.
+func Advance(s Store, userID, mediaID uint, episode int) error {
+	p, err := s.GetProgress(userID, mediaID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		p = &model.MediaProgress{UserID: userID, MediaID: mediaID}
+	} else if p.Episode >= episode {
+		return nil
+	}
+	p.Episode = episode
+	return s.SaveProgress(p)
+}
+
+// Report saves a playback position. The episode counts as watched once the
+// position crosses percent of its duration, or when the player says it was
+// completed. Becoming watched advances the progress on the media and adds
+// the playback to the watch history under source.
+func Report(s Store, p *model.PlaybackPosition, completed bool, percent float64, source string) error {
+	if p.Duration == 0 {
+		files, err := s.ListEpisodeFiles(p.MediaID, p.Episode)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.Duration > p.Duration {
+				p.Duration = f.Duration
+			}
+		}
+	}
+
+	watched := completed || Watched(p.Position, p.Duration, percent)
+	if watched && !p.Watched {
+		if err := Advance(s, p.UserID, p.MediaID, p.Episode); err != nil {
+			return err
+		}
+		h := &model.WatchHistory{
+			UserID:    p.UserID,
+			MediaID:   p.MediaID,
+			Episode:   p.Episode,
+			Source:    source,
+			WatchedAt: p.ReportedAt,
+		}
+		if err := s.AddHistory(h); err != nil {
+			return err
+		}
+	}
+	p.Watched = watched
+
+	return s.SavePosition(p)
+}
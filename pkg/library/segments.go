@@ -0,0 +1,115 @@
+package library
+
+import (
+	"math"
+	"sort"
+
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// Range is the agreed time range of one kind of segment of an episode.
+type Range struct {
+	Kind  string
+	Start float64
+	End   float64
+	// Confidence is the share of the weight of all submissions of the kind
+	// that agrees with the range.
+	Confidence  float64
+	Submissions int
+}
+
+// minOverlap is the intersection over union two submissions need to be
+// counted as the same range.
+const minOverlap = 0.5
+
+type cluster struct {
+	start, end  float64
+	weight      float64
+	submissions int
+}
+
+func (c *cluster) add(s *model.SkipSegment, w float64) {
+	c.start = (c.start*c.weight + s.Start*w) / (c.weight + w)
+	c.end = (c.end*c.weight + s.End*w) / (c.weight + w)
+	c.weight += w
+	c.submissions++
+}
+
+// Consensus clusters overlapping submissions of the same kind and returns
+// the heaviest cluster of each kind, ordered by start. Votes should be pre
+// loaded on the segments; reputations are keyed by submitter.
+func Consensus(segments []model.SkipSegment, reputations map[uint]int) []Range {
+	sorted := make([]*model.SkipSegment, 0, len(segments))
+	for i := range segments {
+		sorted = append(sorted, &segments[i])
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	clusters := make(map[string][]*cluster)
+	totals := make(map[string]float64)
+	for _, s := range sorted {
+		w := segmentWeight(s, reputations[s.UserID])
+		if w <= 0 {
+			continue
+		}
+		totals[s.Kind] += w
+
+		var best *cluster
+		bestOverlap := minOverlap
+		for _, c := range clusters[s.Kind] {
+			if o := overlap(c.start, c.end, s.Start, s.End); o >= bestOverlap {
+				best, bestOverlap = c, o
+			}
+		}
+		if best == nil {
+			best = new(cluster)
+			clusters[s.Kind] = append(clusters[s.Kind], best)
+		}
+		best.add(s, w)
+	}
+
+	ranges := make([]Range, 0, len(clusters))
+	for kind, cs := range clusters {
+		best := cs[0]
+		for _, c := range cs[1:] {
+			if c.weight > best.weight {
+				best = c
+			}
+		}
+		ranges = append(ranges, Range{
+			Kind:        kind,
+			Start:       best.start,
+			End:         best.end,
+			Confidence:  best.weight / totals[kind],
+			Submissions: best.submissions,
+		})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+	return ranges
+}
+
+// segmentWeight starts every submission at 1, moves it by the votes it got
+// and scales it by the reputation of the submitter on a log scale so that a
+// few prolific users cannot outweigh everybody else.
+func segmentWeight(s *model.SkipSegment, reputation int) float64 {
+	w := float64(1 + s.Score())
+	if w <= 0 {
+		return 0
+	}
+	if reputation >= 0 {
+		return w * (1 + math.Log1p(float64(reputation)))
+	}
+	return w / (1 + math.Log1p(float64(-reputation)))
+}
+
+func overlap(aStart, aEnd, bStart, bEnd float64) float64 {
+	inter := math.Min(aEnd, bEnd) - math.Max(aStart, bStart)
+	if inter <= 0 {
+		return 0
+	}
+	return inter / (math.Max(aEnd, bEnd) - math.Min(aStart, bStart))
+}
@@ -0,0 +1,38 @@
+package library
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+func TestConsensus(t *testing.T) {
+	segments := []model.SkipSegment{
+		{UserID: 1, Kind: model.SegmentIntro, Start: 90, End: 180},
+		{UserID: 2, Kind: model.SegmentIntro, Start: 92, End: 182},
+		// A troll far off, downvoted into irrelevance.
+		{UserID: 3, Kind: model.SegmentIntro, Start: 0, End: 60, Votes: []model.SkipVote{{UserID: 1, Value: -1}}},
+		// A lone submission from a trusted user beats two from untrusted ones.
+		{UserID: 4, Kind: model.SegmentOutro, Start: 1300, End: 1390},
+		{UserID: 5, Kind: model.SegmentOutro, Start: 1200, End: 1290},
+		{UserID: 6, Kind: model.SegmentOutro, Start: 1202, End: 1290},
+	}
+	reputations := map[uint]int{1: 10, 2: 0, 4: 50, 5: -5, 6: -5}
+
+	ranges := Consensus(segments, reputations)
+	if assert.Len(t, ranges, 2) {
+		intro := ranges[0]
+		assert.Equal(t, model.SegmentIntro, intro.Kind)
+		assert.InDelta(t, 90.5, intro.Start, 0.5)
+		assert.InDelta(t, 180.5, intro.End, 0.5)
+		assert.Equal(t, 2, intro.Submissions)
+		assert.Equal(t, 1.0, intro.Confidence)
+
+		outro := ranges[1]
+		assert.Equal(t, model.SegmentOutro, outro.Kind)
+		assert.Equal(t, 1300.0, outro.Start)
+		assert.Equal(t, 1, outro.Submissions)
+		assert.True(t, outro.Confidence > 0.5)
+	}
+}
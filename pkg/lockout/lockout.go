@@ -0,0 +1,114 @@
+// Package lockout slows down and locks out repeated failed logins.
+//
+// Failures are counted per key, an account or a network. Past a few free
+// attempts each further one has to wait for a delay that doubles, and
+// enough of them lock the key for a while.
+package lockout
+
+import (
+	"net"
+	"time"
+)
+
+// Policy of a kind of key.
+type Policy struct {
+	// FreeAttempts may fail without any delay.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past the free ones. It
+	// doubles with each further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter failures lock the key for LockDuration, 0 never locks.
+	LockAfter    int
+	LockDuration time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// State is what is stored per key.
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// Locked reports whether the key is locked at now.
+func (s *State) Locked(now time.Time) bool {
+	return s.LockedUntil != nil && now.Before(*s.LockedUntil)
+}
+
+// Delay is the wait after failures failed attempts.
+func (p Policy) Delay(failures int) time.Duration {
+	n := failures - p.FreeAttempts
+	if n <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < n; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// Wait returns how long the next attempt has to wait, 0 if it may go ahead.
+func (p Policy) Wait(s *State, now time.Time) time.Duration {
+	if s.Locked(now) {
+		return s.LockedUntil.Sub(now)
+	}
+	if p.expired(s, now) {
+		return 0
+	}
+	if wait := s.LastFailureAt.Add(p.Delay(s.Failures)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// expired reports whether the failures of s are forgotten, because their
+// lock ended or they are older than the window.
+func (p Policy) expired(s *State, now time.Time) bool {
+	if s.LockedUntil != nil {
+		return !s.Locked(now)
+	}
+	return p.Window > 0 && now.Sub(s.LastFailureAt) > p.Window
+}
+
+// Fail records a failed attempt in s. It returns true when the failure
+// locked the key.
+func (p Policy) Fail(s *State, now time.Time) bool {
+	if s.Failures > 0 && p.expired(s, now) {
+		s.Failures = 0
+		s.LockedUntil = nil
+	}
+	s.Failures++
+	s.LastFailureAt = now
+	if p.LockAfter > 0 && s.Failures >= p.LockAfter && s.LockedUntil == nil {
+		until := now.Add(p.LockDuration)
+		s.LockedUntil = &until
+		return true
+	}
+	return false
+}
+
+// Subnet returns the network of ip that failures are counted for: the
+// first v4Bits of IPv4 addresses, the first v6Bits of IPv6 ones, as one
+// client often holds a whole IPv6 prefix. Unparsable addresses are returned
+// as they are.
+func Subnet(ip string, v4Bits, v6Bits int) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		n := net.IPNet{IP: v4.Mask(net.CIDRMask(v4Bits, 32)), Mask: net.CIDRMask(v4Bits, 32)}
+		return n.String()
+	}
+	n := net.IPNet{IP: parsed.Mask(net.CIDRMask(v6Bits, 128)), Mask: net.CIDRMask(v6Bits, 128)}
+	return n.String()
+}
@@ -0,0 +1,71 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var policy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	LockAfter:    10,
+	LockDuration: 15 * time.Minute,
+	Window:       time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), policy.Delay(3))
+	assert.Equal(t, time.Second, policy.Delay(4))
+	assert.Equal(t, 2*time.Second, policy.Delay(5))
+	assert.Equal(t, 8*time.Second, policy.Delay(7))
+	assert.Equal(t, 10*time.Second, policy.Delay(8))
+	assert.Equal(t, 10*time.Second, policy.Delay(100))
+}
+
+func TestWait(t *testing.T) {
+	now := time.Now()
+	s := &State{}
+	for i := 0; i < 3; i++ {
+		assert.False(t, policy.Fail(s, now))
+	}
+	assert.Zero(t, policy.Wait(s, now), "free attempts do not wait")
+
+	policy.Fail(s, now)
+	assert.Equal(t, time.Second, policy.Wait(s, now))
+	assert.Zero(t, policy.Wait(s, now.Add(time.Second)))
+
+	assert.Zero(t, policy.Wait(s, now.Add(2*time.Hour)), "old failures are forgotten")
+	policy.Fail(s, now.Add(2*time.Hour))
+	assert.Equal(t, 1, s.Failures)
+}
+
+func TestLock(t *testing.T) {
+	now := time.Now()
+	s := &State{}
+	locked := 0
+	for i := 0; i < 12; i++ {
+		if policy.Fail(s, now) {
+			locked++
+		}
+	}
+	assert.Equal(t, 1, locked, "only the failure that locks reports it")
+	assert.True(t, s.Locked(now))
+	assert.Equal(t, 15*time.Minute, policy.Wait(s, now))
+
+	later := now.Add(16 * time.Minute)
+	assert.False(t, s.Locked(later))
+	assert.Zero(t, policy.Wait(s, later), "the lock ending forgets the failures")
+	assert.False(t, policy.Fail(s, later))
+	assert.Equal(t, 1, s.Failures)
+	assert.Nil(t, s.LockedUntil)
+}
+
+func TestSubnet(t *testing.T) {
+	assert.Equal(t, "203.0.113.7/32", Subnet("203.0.113.7", 32, 64))
+	assert.Equal(t, "203.0.113.0/24", Subnet("203.0.113.7", 24, 64))
+	assert.Equal(t, "2001:db8:1:2::/64", Subnet("2001:db8:1:2:3:4:5:6", 32, 64))
+	assert.Equal(t, "unknown", Subnet("unknown", 32, 64))
+}
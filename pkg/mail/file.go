@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File writes each message to a .eml file in a directory, or logs it when
+// there is no directory, so that the links in them can be followed without
+// a mail server.
+type File struct {
+	from string
+	dir  string
+}
+
+func NewFile(from, dir string) *File {
+	if from == "" {
+		from = "kitsu.media <noreply@localhost>"
+	}
+	return &File{from: from, dir: dir}
+}
+
+func (f *File) Send(m *Message) error {
+	if f.dir == "" {
+		log.Printf("mail to %s: %s\n%s", m.To, m.Subject, m.Text)
+		return nil
+	}
+
+	msg, err := m.Bytes(f.from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + sanitize(m.To) + ".eml"
+	return ioutil.WriteFile(filepath.Join(f.dir, name), msg, 0600)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
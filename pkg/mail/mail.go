@@ -0,0 +1,98 @@
+// Package mail sends the emails of the server, over SMTP or into files for
+// development and tests.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML version of its body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(m *Message) error
+}
+
+// Config selects the SMTP mailer when Host is set, and the file mailer
+// otherwise.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// Dir is where the file mailer writes messages, it logs them when empty.
+	Dir string
+}
+
+func New(cfg Config) Mailer {
+	if cfg.Host != "" {
+		return NewSMTP(cfg)
+	}
+	return NewFile(cfg.From, cfg.Dir)
+}
+
+// Bytes encodes the message as a multipart/alternative email from from.
+func (m *Message) Bytes(from string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	domain := "localhost"
+	if i := strings.LastIndexByte(from, '@'); i >= 0 {
+		domain = strings.TrimSuffix(from[i+1:], ">")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+
+	// Clients show the last part they understand, so HTML goes last.
+	for _, p := range []struct{ typ, body string }{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	} {
+		if p.body == "" {
+			continue
+		}
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
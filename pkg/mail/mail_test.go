@@ -0,0 +1,63 @@
+package mail
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	m, err := Render(TemplateReset, "a@example.com", Data{
+		Username: "<b>ann</b>",
+		Link:     "https://example.com/reset?token=x&y=1",
+		Expires:  time.Now(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Reset your password", m.Subject)
+	assert.Contains(t, m.Text, "https://example.com/reset?token=x&y=1")
+	assert.Contains(t, m.HTML, "&lt;b&gt;ann&lt;/b&gt;", "HTML is escaped")
+	assert.Contains(t, m.HTML, `href="https://example.com/reset?token=x&amp;y=1"`)
+
+	_, err = Render("nope", "a@example.com", Data{})
+	assert.Error(t, err)
+}
+
+func TestFileMultipart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, _ := Render(TemplateVerify, "a@example.com", Data{Username: "ann", Link: "https://example.com/v"})
+	assert.NoError(t, NewFile("", dir).Send(m))
+
+	files, _ := ioutil.ReadDir(dir)
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	raw, _ := ioutil.ReadFile(dir + "/" + files[0].Name())
+	msg, err := netmail.ReadMessage(strings.NewReader(string(raw)))
+	assert.NoError(t, err)
+	assert.Equal(t, "a@example.com", msg.Header.Get("To"))
+
+	typ, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", typ)
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		types = append(types, p.Header.Get("Content-Type"))
+	}
+	assert.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, types)
+}
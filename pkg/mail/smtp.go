@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTP sends messages through a relay. The connection is upgraded with
+// STARTTLS when the server offers it.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTP(cfg Config) *SMTP {
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	s := &SMTP{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		from: cfg.From,
+	}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return s
+}
+
+func (s *SMTP) Send(m *Message) error {
+	msg, err := m.Bytes(s.from)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, from.Address, []string{to.Address}, msg)
+}
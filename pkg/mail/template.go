@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+)
+
+const (
+	TemplateVerify  = "verify"
+	TemplateReset   = "reset"
+	TemplateLockout = "lockout"
+)
+
+// Data fills in the templates.
+type Data struct {
+	Username string
+	Link     string
+	Expires  time.Time
+	// IP is the address the mail is about, if any.
+	IP string
+}
+
+type mailTemplate struct {
+	subject string
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+const layout = `<!DOCTYPE html>
+<html><body style="font-family: sans-serif; line-height: 1.5">
+{{template "body" .}}
+<p style="color: #888; font-size: small">kitsu.media</p>
+</body></html>`
+
+var templates = map[string]*mailTemplate{
+	TemplateVerify: newTemplate(
+		"Confirm your email address",
+		`Hi {{.Username}},
+
+please confirm your email address by opening this link:
+
+{{.Link}}
+
+The link works until {{.Expires.Format "Jan 2, 2006 15:04 MST"}}. If you did not sign up, ignore this email.
+`,
+		`<p>Hi {{.Username}},</p>
+<p>please confirm your email address.</p>
+<p><a href="{{.Link}}">Confirm email address</a></p>
+<p>The link works until {{.Expires.Format "Jan 2, 2006 15:04 MST"}}. If you did not sign up, ignore this email.</p>`,
+	),
+	TemplateReset: newTemplate(
+		"Reset your password",
+		`Hi {{.Username}},
+
+somebody asked to reset the password of your account. Choose a new one here:
+
+{{.Link}}
+
+The link works once, until {{.Expires.Format "Jan 2, 2006 15:04 MST"}}. If it wasn't you, ignore this email and your password stays the same.
+`,
+		`<p>Hi {{.Username}},</p>
+<p>somebody asked to reset the password of your account.</p>
+<p><a href="{{.Link}}">Choose a new password</a></p>
+<p>The link works once, until {{.Expires.Format "Jan 2, 2006 15:04 MST"}}. If it wasn't you, ignore this email and your password stays the same.</p>`,
+	),
+	TemplateLockout: newTemplate(
+		"Your account was locked",
+		`Hi {{.Username}},
+
+there were too many failed logins to your account, the last one from {{.IP}}. Logging in is blocked until {{.Expires.Format "Jan 2, 2006 15:04 MST"}}.
+
+If it wasn't you, somebody may be guessing your password. Choose a new one here:
+
+{{.Link}}
+`,
+		`<p>Hi {{.Username}},</p>
+<p>there were too many failed logins to your account, the last one from {{.IP}}. Logging in is blocked until {{.Expires.Format "Jan 2, 2006 15:04 MST"}}.</p>
+<p>If it wasn't you, somebody may be guessing your password.</p>
+<p><a href="{{.Link}}">Choose a new password</a></p>`,
+	),
+}
+
+func newTemplate(subject, text, html string) *mailTemplate {
+	h := htmltemplate.Must(htmltemplate.New("layout").Parse(layout))
+	htmltemplate.Must(h.New("body").Parse(html))
+	return &mailTemplate{
+		subject: subject,
+		text:    template.Must(template.New("text").Parse(text)),
+		html:    h,
+	}
+}
+
+// Render fills in the template name for a message to to.
+func Render(name, to string, data Data) (*Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail template %q", name)
+	}
+
+	var text, html bytes.Buffer
+	if err := t.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, err
+	}
+	return &Message{To: to, Subject: t.subject, Text: text.String(), HTML: html.String()}, nil
+}
@@ -1,6 +1,7 @@
 package media
 
 import (
+	"github.com/xenking/kitsu-media-server/pkg/comment"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 )
 
@@ -17,9 +18,9 @@ type Store interface {
 	ListFeed(userID uint, offset, limit int) ([]model.Media, int, error)
 
 	AddComment(*model.Media, *model.Comment) error
-	GetCommentsBySlug(string) ([]model.Comment, error)
-	GetCommentByID(uint) (*model.Comment, error)
-	DeleteComment(*model.Comment) error
+	GetCommentsBySlug(slug string, q comment.Query) (*comment.Page, error)
+	GetComment(*model.Media, uint) (*model.Comment, error)
+	DeleteComment(*model.Media, *model.Comment) error
 
 	AddFavorite(*model.Media, uint) error
 	RemoveFavorite(*model.Media, uint) error
@@ -1,14 +1,56 @@
 package model
 
-import "github.com/jinzhu/gorm"
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Commentable types, the tables of what comments can be on.
+const (
+	CommentableArticle = "articles"
+	CommentableMedia   = "media"
+)
 
 type Comment struct {
 	gorm.Model
-	Content   Content
-	ContentID uint
-	User      User
-	UserID    uint
+	// CommentableType and CommentableID tell the article or media the
+	// comment is on. Their IDs overlap, so both are needed.
+	CommentableType string `gorm:"index:idx_comment_commentable"`
+	CommentableID   uint   `gorm:"index:idx_comment_commentable"`
+	User            User
+	UserID          uint
+	Body            string
+	// ParentID is the comment this one replies to, Depth counts its
+	// ancestors.
+	ParentID *uint `gorm:"index"`
+	Depth    int
+	EditedAt *time.Time
+	// RemovedAt is set instead of deleting a comment with replies, so that
+	// the thread keeps its shape. The body is cleared.
+	RemovedAt  *time.Time
+	LikesCount int `gorm:"not null;default:0"`
+}
+
+// Removed reports whether the comment was deleted but kept for its replies.
+func (c *Comment) Removed() bool {
+	return c.RemovedAt != nil
+}
+
+// CommentRevision is a body a comment had before it was edited.
+type CommentRevision struct {
+	ID        uint `gorm:"primary_key"`
+	CommentID uint `gorm:"index;not null"`
 	Body      string
+	// CreatedAt is when the comment got this body.
+	CreatedAt time.Time
+}
+
+// CommentLike is a like of a user for a comment.
+type CommentLike struct {
+	CommentID uint `gorm:"primary_key" sql:"type:int not null"`
+	UserID    uint `gorm:"primary_key" sql:"type:int not null"`
+	CreatedAt time.Time
 }
 
 type Tag struct {
@@ -11,7 +11,8 @@ type Content struct {
 	Title    string `gorm:"not null"`
 	Author   User
 	AuthorID uint
-	Comments []Comment
+	// CommentsCount is filled in by lists.
+	CommentsCount int `gorm:"-"`
 }
 
 type Article struct {
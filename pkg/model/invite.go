@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Invite lets people register while registration is invite-only.
+type Invite struct {
+	gorm.Model
+	Creator   User   `gorm:"foreignkey:CreatorID"`
+	CreatorID uint   `gorm:"index;not null"`
+	Hash      string `gorm:"unique_index;not null"`
+	Note      string
+	MaxUses   int
+	Uses      int
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	// Invitees registered with the invite.
+	Invitees []User `gorm:"foreignkey:InviteID"`
+}
+
+// Usable reports whether somebody can register with the invite at now.
+func (i *Invite) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && i.Uses < i.MaxUses && (i.ExpiresAt == nil || now.Before(*i.ExpiresAt))
+}
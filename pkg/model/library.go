@@ -0,0 +1,87 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	TrackAudio    = "audio"
+	TrackSubtitle = "subtitle"
+
+	CRCPending  = "pending"
+	CRCVerified = "verified"
+	CRCMismatch = "mismatch"
+	// CRCUnknown is used for files without a checksum in their name.
+	CRCUnknown = "unknown"
+)
+
+// MediaFile is a video file on disk linked to an episode of a media.
+type MediaFile struct {
+	gorm.Model
+	Media      Media
+	MediaID    uint   `gorm:"index"`
+	Episode    int    `gorm:"index"`
+	Path       string `gorm:"unique_index;not null"`
+	Size       int64
+	Format     string
+	Duration   float64
+	Width      int
+	Height     int
+	VideoCodec string
+	Tracks     []MediaTrack
+	ProbedAt   *time.Time
+	// OrphanedAt is set when the file disappears from the library.
+	OrphanedAt *time.Time `gorm:"index"`
+
+	CRCState     string `gorm:"index;default:'pending'"`
+	CRCExpected  string
+	CRCActual    string
+	CRCOffset    int64
+	CRCPartial   int64
+	CRCCheckedAt *time.Time
+	// CRCFailures counts the runs in a row that could not read the file,
+	// CRCRetryAt is when the next one may start.
+	CRCFailures int        `gorm:"not null;default:0"`
+	CRCRetryAt  *time.Time `gorm:"index"`
+}
+
+// MediaExternalID links a media to its ID in another database or media server,
+// e.g. provider "anidb" or "jellyfin".
+type MediaExternalID struct {
+	gorm.Model
+	MediaID    uint   `gorm:"index;not null"`
+	Provider   string `gorm:"unique_index:idx_external_id;not null"`
+	ExternalID string `gorm:"unique_index:idx_external_id;not null"`
+}
+
+type MediaTrack struct {
+	gorm.Model
+	MediaFileID uint `gorm:"index"`
+	Kind        string
+	Number      int
+	Codec       string
+	Language    string
+	Name        string
+	Default     bool
+	Forced      bool
+}
+
+func (f *MediaFile) AudioTracks() []MediaTrack {
+	return f.tracks(TrackAudio)
+}
+
+func (f *MediaFile) SubtitleTracks() []MediaTrack {
+	return f.tracks(TrackSubtitle)
+}
+
+func (f *MediaFile) tracks(kind string) []MediaTrack {
+	tracks := make([]MediaTrack, 0)
+	for _, t := range f.Tracks {
+		if t.Kind == kind {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks
+}
@@ -0,0 +1,13 @@
+package model
+
+import "github.com/xenking/kitsu-media-server/pkg/lockout"
+
+// LoginThrottle counts the failed logins of an account or a network.
+type LoginThrottle struct {
+	// Key is "user:<id>", "email:<address>" for unknown accounts, or
+	// "ip:<network>".
+	Key string `gorm:"primary_key"`
+	// UserID is set for the keys of known accounts.
+	UserID uint `gorm:"index"`
+	lockout.State
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// OIDCIdentity links a user to their account at an OpenID Connect provider.
+type OIDCIdentity struct {
+	gorm.Model
+	User       User   `gorm:"foreignkey:UserID"`
+	UserID     uint   `gorm:"index;not null"`
+	Provider   string `gorm:"unique_index:idx_oidc_identity;not null"`
+	Subject    string `gorm:"unique_index:idx_oidc_identity;not null"`
+	Email      string
+	LastUsedAt *time.Time
+}
+
+// OIDCState is a pending login with a provider. It is deleted when used.
+type OIDCState struct {
+	Hash      string `gorm:"primary_key"`
+	Provider  string
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time `gorm:"index"`
+}
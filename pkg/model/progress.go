@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MediaProgress is the last episode of a media a user has watched.
+type MediaProgress struct {
+	gorm.Model
+	User    User
+	UserID  uint `gorm:"unique_index:idx_progress_user_media;not null"`
+	Media   Media
+	MediaID uint `gorm:"unique_index:idx_progress_user_media;not null"`
+	Episode int
+}
+
+// PlaybackPosition is where a user stopped playing an episode.
+type PlaybackPosition struct {
+	gorm.Model
+	User     User
+	UserID   uint `gorm:"unique_index:idx_position_user_episode;not null"`
+	Media    Media
+	MediaID  uint `gorm:"unique_index:idx_position_user_episode;not null"`
+	Episode  int  `gorm:"unique_index:idx_position_user_episode"`
+	Position float64
+	Duration float64
+	Watched  bool
+	// ReportedAt is the client time of the report, the newest one wins.
+	ReportedAt time.Time `gorm:"index"`
+}
+
+const (
+	SourceAPI      = "api"
+	SourcePlex     = "plex"
+	SourceJellyfin = "jellyfin"
+	SourceMPV      = "mpv"
+)
+
+// WatchHistory is an episode a user finished watching.
+type WatchHistory struct {
+	gorm.Model
+	User      User
+	UserID    uint `gorm:"index;not null"`
+	Media     Media
+	MediaID   uint `gorm:"not null"`
+	Episode   int
+	Source    string
+	WatchedAt time.Time `gorm:"index"`
+}
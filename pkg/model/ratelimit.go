@@ -0,0 +1,13 @@
+package model
+
+// RateLimitBucket is a token bucket shared by the instances of the server.
+type RateLimitBucket struct {
+	Key    string `gorm:"primary_key"`
+	Tokens float64
+	// Stamp is the unix time in nanoseconds of the last take. Updates
+	// compare it to detect concurrent takes.
+	Stamp int64
+	// FullAt is the unix time in nanoseconds the bucket is full again and
+	// can be forgotten.
+	FullAt int64 `gorm:"index"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "github.com/jinzhu/gorm"
+
+const (
+	SegmentIntro   = "intro"
+	SegmentOutro   = "outro"
+	SegmentRecap   = "recap"
+	SegmentPreview = "preview"
+)
+
+// SkipSegment is a time range of an episode submitted by a user, in seconds.
+type SkipSegment struct {
+	gorm.Model
+	User    User
+	UserID  uint   `gorm:"unique_index:idx_segment_user_episode;not null"`
+	MediaID uint   `gorm:"unique_index:idx_segment_user_episode;index:idx_segment_episode;not null"`
+	Episode int    `gorm:"unique_index:idx_segment_user_episode;index:idx_segment_episode"`
+	Kind    string `gorm:"unique_index:idx_segment_user_episode;not null"`
+	Start   float64
+	End     float64
+	Votes   []SkipVote
+}
+
+type SkipVote struct {
+	SkipSegmentID uint `gorm:"primary_key" sql:"type:int not null"`
+	UserID        uint `gorm:"primary_key" sql:"type:int not null"`
+	// Value is 1 for an upvote and -1 for a downvote.
+	Value int
+}
+
+// Score is the sum of the votes, Votes should be pre loaded.
+func (s *SkipSegment) Score() int {
+	score := 0
+	for _, v := range s.Votes {
+		score += v.Value
+	}
+	return score
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Session is a login of a user. Its refresh tokens and the access tokens
+// issued from them stop working once it is revoked.
+type Session struct {
+	gorm.Model
+	User      User
+	UserID    uint `gorm:"index;not null"`
+	UserAgent string
+	IP        string
+	// LastSeenAt is updated in batches, so it lags behind by up to
+	// SRV_SEEN_INTERVAL.
+	LastSeenAt time.Time
+	// TwoFactor is set when the login passed the second factor.
+	TwoFactor bool
+	RevokedAt *time.Time
+}
+
+// RefreshToken is single use. Using it again means it was stolen, and the
+// whole session gets revoked.
+type RefreshToken struct {
+	gorm.Model
+	Session   Session
+	SessionID uint   `gorm:"index;not null"`
+	Hash      string `gorm:"unique_index;not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// RevokedToken is an access token revoked before it expired.
+type RevokedToken struct {
+	JTI       string    `gorm:"primary_key"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// AccessToken is a personal access token scripts authenticate with instead
+// of a password.
+type AccessToken struct {
+	gorm.Model
+	User   User
+	UserID uint   `gorm:"index;not null"`
+	Name   string `gorm:"not null"`
+	Hash   string `gorm:"unique_index;not null"`
+	// Scopes are separated by spaces.
+	Scopes    string
+	ExpiresAt *time.Time
+	// LastUsedAt is updated in batches like Session.LastSeenAt.
+	LastUsedAt *time.Time
+}
+
+func (t *AccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
@@ -1,16 +1,18 @@
 package model
 
 import (
-	"errors"
+	"time"
 
 	"github.com/jinzhu/gorm"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+	"github.com/xenking/kitsu-media-server/pkg/password"
 )
 
 type User struct {
 	gorm.Model
 	Username         string `gorm:"unique_index;not null"`
 	Email            string `gorm:"unique_index;not null"`
+	EmailVerifiedAt  *time.Time
 	Password         string `gorm:"not null"`
 	Bio              *string
 	Image            *string
@@ -18,6 +20,40 @@ type User struct {
 	Followings       []Follow  `gorm:"foreignkey:FollowerID"`
 	ArticleFavorites []Article `gorm:"many2many:article_favorites;"`
 	MediaFavorites   []Media   `gorm:"many2many:media_favorites;"`
+	// ScrobbleToken is the hash of the token external players authenticate with.
+	ScrobbleToken *string    `gorm:"unique_index"`
+	Roles         []UserRole `gorm:"foreignkey:UserID"`
+	// TOTPSecret is set on enrollment, TOTPEnabledAt once a code confirmed it.
+	TOTPSecret    *string
+	TOTPEnabledAt *time.Time
+	// TOTPLastStep is the time step of the last accepted code, older ones
+	// are refused so that codes cannot be replayed.
+	TOTPLastStep int64
+	// InvitedByID and InviteID are set for users who registered with an
+	// invite.
+	InvitedByID *uint `gorm:"index"`
+	InviteID    *uint `gorm:"index"`
+}
+
+type UserRole struct {
+	UserID uint   `gorm:"primary_key" sql:"type:int not null"`
+	Role   string `gorm:"primary_key"`
+}
+
+// RoleSetting holds what an admin configured for a role.
+type RoleSetting struct {
+	Role string `gorm:"primary_key"`
+	// RequireTwoFactor withholds the role from sessions that did not log in
+	// with a second factor.
+	RequireTwoFactor bool
+}
+
+// RecoveryCode is a hashed one-time code that replaces a TOTP code.
+type RecoveryCode struct {
+	gorm.Model
+	UserID uint   `gorm:"index;not null"`
+	Hash   string `gorm:"not null"`
+	UsedAt *time.Time
 }
 
 type Follow struct {
@@ -28,16 +64,34 @@ type Follow struct {
 }
 
 func (u *User) HashPassword(plain string) (string, error) {
-	if len(plain) == 0 {
-		return "", errors.New("password should not be empty")
-	}
-	h, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
-	return string(h), err
+	return password.Hash(plain, config.Global.PasswordParams)
 }
 
 func (u *User) CheckPassword(plain string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(plain))
-	return err == nil
+	return password.Verify(u.Password, plain)
+}
+
+// PasswordNeedsRehash reports whether the password hash is bcrypt or uses
+// other argon2id params than configured.
+func (u *User) PasswordNeedsRehash() bool {
+	return password.NeedsRehash(u.Password, config.Global.PasswordParams)
+}
+
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// RoleNames Roles should be pre loaded
+func (u *User) RoleNames() []string {
+	names := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		names = append(names, r.Role)
+	}
+	return names
 }
 
 // FollowedBy Followings should be pre loaded
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// WebAuthnCredential is a passkey a user can log in with.
+type WebAuthnCredential struct {
+	gorm.Model
+	User   User
+	UserID uint `gorm:"index;not null"`
+	Name   string
+	// CredentialID is base64url encoded.
+	CredentialID string `gorm:"unique_index;not null"`
+	// PublicKey is COSE encoded.
+	PublicKey  []byte `gorm:"not null"`
+	SignCount  uint32
+	LastUsedAt *time.Time
+}
+
+const (
+	CeremonyRegister = "register"
+	CeremonyLogin    = "login"
+)
+
+// WebAuthnChallenge is a pending ceremony. It is deleted when used.
+type WebAuthnChallenge struct {
+	Hash      string `gorm:"primary_key"`
+	Ceremony  string
+	UserID    uint
+	ExpiresAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,92 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// parse returns the signing keys by kid. Key types other than RSA and
+// P-256 are skipped.
+func (s jwks) parse() (map[string]interface{}, error) {
+	keys := make(map[string]interface{}, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeInt(k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeInt(k.E)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, err := decodeInt(k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeInt(k.Y)
+			if err != nil {
+				return nil, err
+			}
+			if !elliptic.P256().IsOnCurve(x, y) {
+				return nil, fmt.Errorf("jwks: key %q is not on the curve", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+	return keys, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("jwks: invalid key")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// checkKey makes sure the token algorithm fits the key, so that a token
+// cannot pick how its key is used.
+func checkKey(k interface{}, alg string) (interface{}, error) {
+	switch k.(type) {
+	case *rsa.PublicKey:
+		if alg == jwt.SigningMethodRS256.Alg() {
+			return k, nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == jwt.SigningMethodES256.Alg() {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("key does not fit algorithm %s", alg)
+}
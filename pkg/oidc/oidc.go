@@ -0,0 +1,297 @@
+// Package oidc logs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE.
+//
+// The provider is discovered from its issuer on first use. ID tokens must be
+// signed with RS256 or ES256 by a key of the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrDiscovery = errors.New("oidc: provider discovery failed")
+	ErrExchange  = errors.New("oidc: code exchange failed")
+	ErrIDToken   = errors.New("oidc: invalid id token")
+	ErrNonce     = errors.New("oidc: nonce mismatch")
+)
+
+// Config of a provider.
+type Config struct {
+	// Name identifies the provider in URLs and linked accounts.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the page of the web app the provider sends the code to.
+	RedirectURL string
+	// Scopes are requested on top of openid.
+	Scopes []string
+	// GroupsClaim is the ID token claim listing the groups of the user.
+	GroupsClaim string
+	// Roles maps groups to local roles.
+	Roles map[string]string
+}
+
+// Claims of an ID token the login needs.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Groups            []string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OIDC provider. It is safe for concurrent use.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *discovery
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// keysRefresh is the least time between JWKS fetches for unknown key IDs.
+const keysRefresh = time.Minute
+
+func New(cfg Config) *Provider {
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) Config() Config {
+	return p.cfg
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// discover fetches the endpoints of the provider once.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var d discovery
+	u := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, u, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, d.Issuer, p.cfg.Issuer)
+	}
+	p.meta = &d
+	return p.meta, nil
+}
+
+// AuthURL is where the user logs in with the provider. state and nonce are
+// random per login, challenge comes from Challenge.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Challenge is the PKCE S256 challenge of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+// Exchange trades the code for an ID token and returns its claims, after
+// checking it was issued for this login.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	var t tokenResponse
+	if err := json.Unmarshal(body, &t); err != nil || resp.StatusCode != http.StatusOK || t.IDToken == "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, resp.Status, t.Error)
+	}
+	return p.Verify(ctx, t.IDToken, nonce)
+}
+
+// Verify checks an ID token of the provider and its nonce.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.Alg() {
+		case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg():
+		default:
+			return nil, fmt.Errorf("unexpected algorithm %s", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, d, kid, t.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDToken, err)
+	}
+
+	if !claims.VerifyIssuer(p.cfg.Issuer, true) || !audience(claims, p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: wrong issuer or audience", ErrIDToken)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: no expiry", ErrIDToken)
+	}
+	got, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, ErrNonce
+	}
+
+	c := &Claims{}
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	c.EmailVerified, _ = claims["email_verified"].(bool)
+	c.Name, _ = claims["name"].(string)
+	c.PreferredUsername, _ = claims["preferred_username"].(string)
+	if list, ok := claims[p.cfg.GroupsClaim].([]interface{}); ok {
+		for _, g := range list {
+			if s, ok := g.(string); ok {
+				c.Groups = append(c.Groups, s)
+			}
+		}
+	}
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrIDToken)
+	}
+	return c, nil
+}
+
+// audience reports whether clientID is an audience of the token. aud may
+// be a string or a list.
+func audience(claims jwt.MapClaims, clientID string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the key kid of the provider, fetching the JWKS again when it
+// is unknown, as the provider may have rotated.
+func (p *Provider) key(ctx context.Context, d *discovery, kid, alg string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return checkKey(k, alg)
+	}
+	if time.Since(p.keysFetched) < keysRefresh {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	var set jwks
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys, err := set.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	if k, ok := p.keys[kid]; ok {
+		return checkKey(k, alg)
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
@@ -0,0 +1,102 @@
+package oidc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/oidc"
+	"github.com/xenking/kitsu-media-server/pkg/oidc/oidctest"
+)
+
+const redirectURL = "https://kitsu.test/oidc/callback"
+
+var ann = oidctest.User{
+	Subject:       "ann-1",
+	Email:         "ann@kitsu.test",
+	EmailVerified: true,
+	Name:          "Ann",
+	Username:      "ann",
+	Groups:        []string{"staff", "editors"},
+}
+
+func login(t *testing.T, mock *oidctest.Provider, p *oidc.Provider, verifier, nonce string) string {
+	u, err := p.AuthURL(context.Background(), "the state", nonce, oidc.Challenge(verifier))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	code, state, err := mock.Authorize(u)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "the state", state)
+	return code
+}
+
+func TestExchange(t *testing.T) {
+	mock := oidctest.NewProvider("kitsu", "secret")
+	defer mock.Close()
+	mock.SetUser(ann)
+	p := oidc.New(mock.Config("mock", redirectURL))
+
+	code := login(t, mock, p, "verifier", "nonce")
+	c, err := p.Exchange(context.Background(), code, "verifier", "nonce")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ann-1", c.Subject)
+		assert.Equal(t, "ann@kitsu.test", c.Email)
+		assert.True(t, c.EmailVerified)
+		assert.Equal(t, "ann", c.PreferredUsername)
+		assert.Equal(t, []string{"staff", "editors"}, c.Groups)
+	}
+
+	// Codes are single use.
+	_, err = p.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.Error(t, err)
+}
+
+func TestExchangeRejects(t *testing.T) {
+	mock := oidctest.NewProvider("kitsu", "secret")
+	defer mock.Close()
+	mock.SetUser(ann)
+
+	p := oidc.New(mock.Config("mock", redirectURL))
+	code := login(t, mock, p, "verifier", "nonce")
+	_, err := p.Exchange(context.Background(), code, "another verifier", "nonce")
+	assert.Error(t, err, "verifier")
+
+	code = login(t, mock, p, "verifier", "nonce")
+	_, err = p.Exchange(context.Background(), code, "verifier", "another nonce")
+	assert.Equal(t, oidc.ErrNonce, err)
+
+	cfg := mock.Config("mock", redirectURL)
+	cfg.ClientSecret = "wrong"
+	p = oidc.New(cfg)
+	code = login(t, mock, p, "verifier", "nonce")
+	_, err = p.Exchange(context.Background(), code, "verifier", "nonce")
+	assert.Error(t, err, "client secret")
+
+	cfg = mock.Config("mock", redirectURL)
+	cfg.Issuer += "/"
+	_, err = oidc.New(cfg).AuthURL(context.Background(), "s", "n", "c")
+	assert.Error(t, err, "issuer")
+}
+
+func TestVerifyRejectsForeignToken(t *testing.T) {
+	mock := oidctest.NewProvider("kitsu", "secret")
+	defer mock.Close()
+	other := oidctest.NewProvider("kitsu", "secret")
+	defer other.Close()
+	mock.SetUser(ann)
+	other.SetUser(ann)
+
+	p := oidc.New(mock.Config("mock", redirectURL))
+	_, err := p.Verify(context.Background(), "not.a.token", "nonce")
+	assert.Error(t, err)
+
+	_, err = p.Verify(context.Background(), mock.IDToken("nonce"), "nonce")
+	assert.NoError(t, err)
+
+	// A token of another provider has another issuer and key.
+	_, err = p.Verify(context.Background(), other.IDToken("nonce"), "nonce")
+	assert.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package password
+
+// common are frequent passwords from public breach corpora, lower case.
+var common = []string{
+	"123456", "123456789", "12345678", "password", "qwerty", "qwerty123",
+	"1234567", "111111", "12345", "1234567890", "123123", "000000",
+	"abc123", "password1", "password123", "iloveyou", "1q2w3e4r", "1q2w3e4r5t",
+	"qwertyuiop", "123321", "654321", "666666", "987654321", "121212",
+	"555555", "7777777", "11111111", "88888888", "1qaz2wsx", "zaq12wsx",
+	"asdfghjkl", "asdfgh", "qazwsx", "zxcvbnm", "zxcvbn", "aa123456",
+	"admin", "admin123", "administrator", "root", "toor", "letmein",
+	"welcome", "welcome1", "monkey", "dragon", "master", "sunshine",
+	"princess", "football", "baseball", "soccer", "hockey", "superman",
+	"batman", "trustno1", "shadow", "michael", "jennifer", "jordan23",
+	"hunter2", "freedom", "whatever", "starwars", "pokemon", "naruto",
+	"anime", "animelover", "otaku", "kitsune", "kitsu", "kitsumedia",
+	"passw0rd", "p@ssw0rd", "p@ssword", "secret", "secret123", "changeme",
+	"default", "guest", "login", "access", "flower", "lovely",
+	"cheese", "computer", "internet", "samsung", "google", "chocolate",
+	"summer", "winter", "spring", "autumn", "qwerty1", "qwert",
+	"abcdef", "abcd1234", "a1b2c3d4", "11223344", "123qwe", "qwe123",
+	"1234qwer", "q1w2e3r4", "q1w2e3r4t5", "mypassword", "yourpassword", "nopassword",
+}
@@ -0,0 +1,130 @@
+// Package password hashes passwords and checks them against a policy.
+//
+// Hashes are stored in the PHC string format, which names the algorithm and
+// its parameters, so that older hashes keep verifying and can be told apart
+// for rehashing:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//
+// Hashes from before argon2id are bcrypt ones, $2a$ and friends.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmpty       = errors.New("password should not be empty")
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// Params of argon2id. Memory is in KiB.
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams take 64 MiB of memory per hash.
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func (p Params) orDefault() Params {
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return DefaultParams
+	}
+	if p.SaltLength == 0 {
+		p.SaltLength = DefaultParams.SaltLength
+	}
+	if p.KeyLength == 0 {
+		p.KeyLength = DefaultParams.KeyLength
+	}
+	return p
+}
+
+// Hash hashes plain with argon2id. Zero params mean DefaultParams.
+func Hash(plain string, p Params) (string, error) {
+	if plain == "" {
+		return "", ErrEmpty
+	}
+	p = p.orDefault()
+
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return encode(p, salt, key), nil
+}
+
+func encode(p Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decode(hash string) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Verify reports whether plain matches hash, of either format.
+func Verify(hash, plain string) bool {
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil
+	}
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or
+// other params than p, and should be replaced at the next login.
+func NeedsRehash(hash string, p Params) bool {
+	old, _, _, err := decode(hash)
+	if err != nil {
+		return true
+	}
+	return old != p.orDefault()
+}
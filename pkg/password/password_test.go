@@ -0,0 +1,47 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestHashVerify(t *testing.T) {
+	h, err := Hash("correct horse", testParams)
+	assert.NoError(t, err)
+	assert.Contains(t, h, "$argon2id$v=19$m=1024,t=1,p=1$")
+	assert.True(t, Verify(h, "correct horse"))
+	assert.False(t, Verify(h, "correct horsE"))
+	assert.False(t, NeedsRehash(h, testParams))
+	assert.True(t, NeedsRehash(h, Params{Memory: 2048, Iterations: 1, Parallelism: 1}))
+
+	_, err = Hash("", testParams)
+	assert.Equal(t, ErrEmpty, err)
+	assert.False(t, Verify("$argon2id$garbage", "x"))
+}
+
+func TestBcryptUpgrade(t *testing.T) {
+	b, _ := bcrypt.GenerateFromPassword([]byte("old secret"), bcrypt.MinCost)
+	assert.True(t, Verify(string(b), "old secret"))
+	assert.False(t, Verify(string(b), "new secret"))
+	assert.True(t, NeedsRehash(string(b), testParams))
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := NewPolicy(8, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.Check("tangerine-otter", "ann", "ann@example.com"))
+	assert.Error(t, p.Check("short", "ann", "ann@example.com"))
+	assert.Equal(t, ErrCommon, p.Check("Password123", "ann", "ann@example.com"))
+	assert.Equal(t, ErrContainsUser, p.Check("my-annabelle-99", "annabelle", "x@example.com"))
+	assert.Equal(t, ErrContainsUser, p.Check("zz-bob.smith-zz", "bobby", "bob.smith@example.com"))
+	assert.NoError(t, p.Check("ab-tangerine", "ab", "ab@example.com"), "short names are not looked for")
+
+	var none *Policy
+	assert.NoError(t, none.Check("x", "", ""))
+	assert.Equal(t, ErrEmpty, none.Check("", "", ""))
+}
@@ -0,0 +1,84 @@
+package password
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrCommon       = errors.New("password is too common")
+	ErrContainsUser = errors.New("password must not contain the username or email address")
+)
+
+// minPartLength is the shortest username or email part looked for in
+// passwords, shorter ones would reject too much.
+const minPartLength = 3
+
+// Policy is what a new password must meet.
+type Policy struct {
+	MinLength int
+	blocklist map[string]struct{}
+}
+
+// NewPolicy returns a policy blocking the common passwords of this package
+// and those listed one per line in the file blocklist, if not empty.
+func NewPolicy(minLength int, blocklist string) (*Policy, error) {
+	p := &Policy{MinLength: minLength, blocklist: make(map[string]struct{}, len(common))}
+	for _, pw := range common {
+		p.blocklist[pw] = struct{}{}
+	}
+	if blocklist == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(blocklist)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			p.blocklist[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check returns why plain is not allowed as the password of the user, or
+// nil. A nil policy only refuses empty passwords.
+func (p *Policy) Check(plain, username, email string) error {
+	if plain == "" {
+		return ErrEmpty
+	}
+	if p == nil {
+		return nil
+	}
+	if utf8.RuneCountInString(plain) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+
+	lower := strings.ToLower(plain)
+	if _, ok := p.blocklist[lower]; ok {
+		return ErrCommon
+	}
+
+	parts := []string{username, email}
+	if i := strings.IndexByte(email, '@'); i > 0 {
+		parts = append(parts, email[:i])
+	}
+	for _, part := range parts {
+		part = strings.ToLower(part)
+		if len(part) >= minPartLength && strings.Contains(lower, part) {
+			return ErrContainsUser
+		}
+	}
+	return nil
+}
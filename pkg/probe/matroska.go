@@ -0,0 +1,417 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Matroska element IDs, see https://www.matroska.org/technical/elements.html
+const (
+	idEBML          = 0x1A45DFA3
+	idSegment       = 0x18538067
+	idSeekHead      = 0x114D9B74
+	idSeek          = 0x4DBB
+	idSeekID        = 0x53AB
+	idSeekPosition  = 0x53AC
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+	idTracks        = 0x1654AE6B
+	idTrackEntry    = 0xAE
+	idTrackNumber   = 0xD7
+	idTrackType     = 0x83
+	idCodecID       = 0x86
+	idName          = 0x536E
+	idLanguage      = 0x22B59C
+	idLanguageIETF  = 0x22B59D
+	idFlagDefault   = 0x88
+	idFlagForced    = 0x55AA
+	idVideo         = 0xE0
+	idPixelWidth    = 0xB0
+	idPixelHeight   = 0xBA
+	idCluster       = 0x1F43B675
+
+	trackTypeVideo    = 1
+	trackTypeAudio    = 2
+	trackTypeSubtitle = 17
+
+	// maxMasterSize caps the amount of header data read into memory.
+	maxMasterSize = 16 << 20
+)
+
+type ebmlElement struct {
+	id   uint32
+	size int64 // -1 when unknown
+	data int64 // offset of the element payload
+}
+
+type matroskaReader struct {
+	r   io.ReadSeeker
+	pos int64
+}
+
+func probeMatroska(r io.ReadSeeker) (*Info, error) {
+	mr := &matroskaReader{r: r}
+	hdr, err := mr.next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.id != idEBML || hdr.size < 0 {
+		return nil, ErrMalformed
+	}
+	if err := mr.skip(hdr); err != nil {
+		return nil, err
+	}
+
+	var seg ebmlElement
+	for {
+		seg, err = mr.next()
+		if err != nil {
+			return nil, err
+		}
+		if seg.id == idSegment {
+			break
+		}
+		if err := mr.skip(seg); err != nil {
+			return nil, err
+		}
+	}
+
+	info := &Info{Format: FormatMatroska}
+	var (
+		seeks              = map[uint32]int64{}
+		haveInfo, haveTrks bool
+	)
+	for !(haveInfo && haveTrks) {
+		if seg.size >= 0 && mr.pos >= seg.data+seg.size {
+			break
+		}
+		el, err := mr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch el.id {
+		case idSeekHead:
+			b, err := mr.payload(el)
+			if err != nil {
+				return nil, err
+			}
+			parseSeekHead(b, seeks)
+			continue
+		case idInfo:
+			b, err := mr.payload(el)
+			if err != nil {
+				return nil, err
+			}
+			parseSegmentInfo(b, info)
+			haveInfo = true
+			continue
+		case idTracks:
+			b, err := mr.payload(el)
+			if err != nil {
+				return nil, err
+			}
+			parseTracks(b, info)
+			haveTrks = true
+			continue
+		}
+		if el.size < 0 || el.id == idCluster {
+			// Clusters hold the actual media; everything we still
+			// need has to be reached through the seek head.
+			break
+		}
+		if err := mr.skip(el); err != nil {
+			return nil, err
+		}
+	}
+
+	if !haveInfo {
+		if off, ok := seeks[idInfo]; ok {
+			b, err := mr.at(seg.data+off, idInfo)
+			if err != nil {
+				return nil, err
+			}
+			parseSegmentInfo(b, info)
+		}
+	}
+	if !haveTrks {
+		if off, ok := seeks[idTracks]; ok {
+			b, err := mr.at(seg.data+off, idTracks)
+			if err != nil {
+				return nil, err
+			}
+			parseTracks(b, info)
+		}
+	}
+	return info, nil
+}
+
+// next reads the header of the element at the current position.
+func (mr *matroskaReader) next() (ebmlElement, error) {
+	var el ebmlElement
+	id, n, err := mr.readVint(true)
+	if err != nil {
+		return el, err
+	}
+	if n > 4 {
+		return el, ErrMalformed
+	}
+	size, n, err := mr.readVint(false)
+	if err != nil {
+		if err == io.EOF {
+			err = ErrMalformed
+		}
+		return el, err
+	}
+	el.id = uint32(id)
+	el.size = int64(size)
+	if size == 1<<(7*uint(n))-1 {
+		el.size = -1
+	}
+	el.data = mr.pos
+	return el, nil
+}
+
+func (mr *matroskaReader) readVint(keepMarker bool) (uint64, int, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(mr.r, b[:1]); err != nil {
+		return 0, 0, err
+	}
+	n := 1
+	mask := byte(0x80)
+	for n <= 8 && b[0]&mask == 0 {
+		mask >>= 1
+		n++
+	}
+	if n > 8 {
+		return 0, 0, ErrMalformed
+	}
+	if n > 1 {
+		if _, err := io.ReadFull(mr.r, b[1:n]); err != nil {
+			return 0, 0, ErrMalformed
+		}
+	}
+	mr.pos += int64(n)
+	v, _ := vint(b[:n], keepMarker)
+	return v, n, nil
+}
+
+func (mr *matroskaReader) skip(el ebmlElement) error {
+	if el.size < 0 {
+		return ErrMalformed
+	}
+	return mr.seek(el.data + el.size)
+}
+
+func (mr *matroskaReader) seek(off int64) error {
+	if _, err := mr.r.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	mr.pos = off
+	return nil
+}
+
+func (mr *matroskaReader) payload(el ebmlElement) ([]byte, error) {
+	if el.size < 0 || el.size > maxMasterSize {
+		return nil, ErrMalformed
+	}
+	b := make([]byte, el.size)
+	if _, err := io.ReadFull(mr.r, b); err != nil {
+		return nil, ErrMalformed
+	}
+	mr.pos += el.size
+	return b, nil
+}
+
+// at reads the payload of the element with the given id found at off.
+func (mr *matroskaReader) at(off int64, id uint32) ([]byte, error) {
+	if err := mr.seek(off); err != nil {
+		return nil, err
+	}
+	el, err := mr.next()
+	if err != nil {
+		return nil, err
+	}
+	if el.id != id {
+		return nil, ErrMalformed
+	}
+	return mr.payload(el)
+}
+
+// vint decodes an EBML variable length integer, returning its length.
+func vint(b []byte, keepMarker bool) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1
+	mask := byte(0x80)
+	for n <= 8 && b[0]&mask == 0 {
+		mask >>= 1
+		n++
+	}
+	if n > 8 || len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & (mask - 1))
+	if keepMarker {
+		v = uint64(b[0])
+	}
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// children calls fn for every child element stored in the payload b.
+func children(b []byte, fn func(id uint32, data []byte)) {
+	for len(b) > 0 {
+		id, n := vint(b, true)
+		if n == 0 || n > 4 {
+			return
+		}
+		b = b[n:]
+		size, m := vint(b, false)
+		if m == 0 {
+			return
+		}
+		b = b[m:]
+		if size > uint64(len(b)) {
+			// Truncated or unknown-sized child: hand over what we have.
+			size = uint64(len(b))
+		}
+		fn(uint32(id), b[:size])
+		b = b[size:]
+	}
+}
+
+func ebmlUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func ebmlFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func parseSeekHead(b []byte, seeks map[uint32]int64) {
+	children(b, func(id uint32, data []byte) {
+		if id != idSeek {
+			return
+		}
+		var (
+			target uint32
+			pos    int64 = -1
+		)
+		children(data, func(id uint32, data []byte) {
+			switch id {
+			case idSeekID:
+				target = uint32(ebmlUint(data))
+			case idSeekPosition:
+				pos = int64(ebmlUint(data))
+			}
+		})
+		if target != 0 && pos >= 0 {
+			seeks[target] = pos
+		}
+	})
+}
+
+func parseSegmentInfo(b []byte, info *Info) {
+	scale := uint64(1000000)
+	var duration float64
+	children(b, func(id uint32, data []byte) {
+		switch id {
+		case idTimecodeScale:
+			scale = ebmlUint(data)
+		case idDuration:
+			duration = ebmlFloat(data)
+		}
+	})
+	info.Duration = time.Duration(duration * float64(scale))
+}
+
+func parseTracks(b []byte, info *Info) {
+	children(b, func(id uint32, data []byte) {
+		if id != idTrackEntry {
+			return
+		}
+		var (
+			typ           uint64
+			codec         string
+			lang, ietf    string
+			width, height int
+		)
+		t := Track{Default: true, Language: "eng"}
+		children(data, func(id uint32, data []byte) {
+			switch id {
+			case idTrackNumber:
+				t.Number = int(ebmlUint(data))
+			case idTrackType:
+				typ = ebmlUint(data)
+			case idCodecID:
+				codec = cString(data)
+			case idName:
+				t.Name = cString(data)
+			case idLanguage:
+				lang = cString(data)
+			case idLanguageIETF:
+				ietf = cString(data)
+			case idFlagDefault:
+				t.Default = ebmlUint(data) != 0
+			case idFlagForced:
+				t.Forced = ebmlUint(data) != 0
+			case idVideo:
+				children(data, func(id uint32, data []byte) {
+					switch id {
+					case idPixelWidth:
+						width = int(ebmlUint(data))
+					case idPixelHeight:
+						height = int(ebmlUint(data))
+					}
+				})
+			}
+		})
+		t.Codec = codecName(codec)
+		switch {
+		case ietf != "":
+			t.Language = ietf
+		case lang != "":
+			t.Language = lang
+		}
+		switch typ {
+		case trackTypeVideo:
+			if info.VideoCodec == "" {
+				info.VideoCodec = t.Codec
+				info.Width = width
+				info.Height = height
+			}
+		case trackTypeAudio:
+			info.Audio = append(info.Audio, t)
+		case trackTypeSubtitle:
+			info.Subtitles = append(info.Subtitles, t)
+		}
+	})
+}
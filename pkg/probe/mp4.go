@@ -0,0 +1,265 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	// maxMoovSize caps the size of the movie header read into memory.
+	maxMoovSize = 64 << 20
+)
+
+func isMP4Box(typ string) bool {
+	switch typ {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "pdin":
+		return true
+	}
+	return false
+}
+
+func probeMP4(r io.ReadSeeker) (*Info, error) {
+	var (
+		hdr [16]byte
+		pos int64
+	)
+	for {
+		if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+			if err == io.EOF {
+				return nil, ErrMalformed
+			}
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		hdrLen := int64(8)
+		if size == 1 {
+			if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+				return nil, ErrMalformed
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			hdrLen = 16
+		}
+		if typ == "moov" {
+			if size == 0 || size-hdrLen > maxMoovSize || size < hdrLen {
+				return nil, ErrMalformed
+			}
+			b := make([]byte, size-hdrLen)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, ErrMalformed
+			}
+			return parseMoov(b), nil
+		}
+		if size == 0 || size < hdrLen {
+			// The box extends to the end of the file and no moov was found.
+			return nil, ErrMalformed
+		}
+		pos += size
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// boxes calls fn for every box stored in b.
+func boxes(b []byte, fn func(typ string, data []byte)) {
+	for len(b) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(b[:4]))
+		typ := string(b[4:8])
+		hdrLen := uint64(8)
+		if size == 1 {
+			if len(b) < 16 {
+				return
+			}
+			size = binary.BigEndian.Uint64(b[8:16])
+			hdrLen = 16
+		}
+		if size == 0 || size > uint64(len(b)) {
+			size = uint64(len(b))
+		}
+		if size < hdrLen {
+			return
+		}
+		fn(typ, b[hdrLen:size])
+		b = b[size:]
+	}
+}
+
+type mp4Track struct {
+	handler  string
+	codec    string
+	language string
+	name     string
+	width    int
+	height   int
+	duration time.Duration
+	enabled  bool
+	number   int
+}
+
+func parseMoov(b []byte) *Info {
+	info := &Info{Format: FormatMP4}
+	var longest time.Duration
+	boxes(b, func(typ string, data []byte) {
+		switch typ {
+		case "mvhd":
+			info.Duration = parseMvhd(data)
+		case "trak":
+			t := parseTrak(data)
+			if t.duration > longest {
+				longest = t.duration
+			}
+			track := Track{
+				Number:   t.number,
+				Codec:    codecName(t.codec),
+				Language: t.language,
+				Name:     t.name,
+				Default:  t.enabled,
+			}
+			switch t.handler {
+			case "vide":
+				if info.VideoCodec == "" {
+					info.VideoCodec = track.Codec
+					info.Width = t.width
+					info.Height = t.height
+				}
+			case "soun":
+				info.Audio = append(info.Audio, track)
+			case "sbtl", "subt", "text", "clcp":
+				info.Subtitles = append(info.Subtitles, track)
+			}
+		}
+	})
+	if info.Duration == 0 {
+		info.Duration = longest
+	}
+	return info
+}
+
+func parseMvhd(b []byte) time.Duration {
+	if len(b) < 4 {
+		return 0
+	}
+	var timescale, duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		if len(b) < 20 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	return scaleDuration(duration, timescale)
+}
+
+func scaleDuration(duration, timescale uint64) time.Duration {
+	if timescale == 0 || duration == 0xFFFFFFFF || duration == 0xFFFFFFFFFFFFFFFF {
+		return 0
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+}
+
+func parseTrak(b []byte) mp4Track {
+	t := mp4Track{language: "und"}
+	boxes(b, func(typ string, data []byte) {
+		switch typ {
+		case "tkhd":
+			parseTkhd(data, &t)
+		case "mdia":
+			boxes(data, func(typ string, data []byte) {
+				switch typ {
+				case "mdhd":
+					parseMdhd(data, &t)
+				case "elng":
+					if len(data) > 4 {
+						t.language = cString(data[4:])
+					}
+				case "hdlr":
+					if len(data) >= 12 {
+						t.handler = string(data[8:12])
+					}
+				case "minf":
+					boxes(data, func(typ string, data []byte) {
+						if typ != "stbl" {
+							return
+						}
+						boxes(data, func(typ string, data []byte) {
+							if typ == "stsd" && len(data) >= 16 {
+								t.codec = string(data[12:16])
+							}
+						})
+					})
+				}
+			})
+		case "udta":
+			boxes(data, func(typ string, data []byte) {
+				if typ == "name" {
+					t.name = cString(data)
+				}
+			})
+		}
+	})
+	return t
+}
+
+func parseTkhd(b []byte, t *mp4Track) {
+	if len(b) < 4 {
+		return
+	}
+	t.enabled = b[3]&0x1 != 0
+	// Offset of the width field depends on the box version.
+	off := 76
+	idOff := 12
+	if b[0] == 1 {
+		off = 88
+		idOff = 20
+	}
+	if len(b) >= idOff+4 {
+		t.number = int(binary.BigEndian.Uint32(b[idOff : idOff+4]))
+	}
+	if len(b) >= off+8 {
+		t.width = int(binary.BigEndian.Uint32(b[off:off+4]) >> 16)
+		t.height = int(binary.BigEndian.Uint32(b[off+4:off+8]) >> 16)
+	}
+}
+
+func parseMdhd(b []byte, t *mp4Track) {
+	if len(b) < 4 {
+		return
+	}
+	var (
+		timescale, duration uint64
+		lang                []byte
+	)
+	if b[0] == 1 {
+		if len(b) < 34 {
+			return
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+		lang = b[32:34]
+	} else {
+		if len(b) < 22 {
+			return
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+		lang = b[20:22]
+	}
+	t.duration = scaleDuration(duration, timescale)
+	// ISO 639-2/T code packed as three 5 bit characters.
+	packed := binary.BigEndian.Uint16(lang)
+	if packed != 0 && t.language == "und" {
+		t.language = string([]byte{
+			byte(packed>>10&0x1F) + 0x60,
+			byte(packed>>5&0x1F) + 0x60,
+			byte(packed&0x1F) + 0x60,
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package probe reads stream information from Matroska and MP4 containers
+// without decoding any media or shelling out to external tools.
+package probe
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	FormatMatroska = "matroska"
+	FormatMP4      = "mp4"
+)
+
+var (
+	ErrUnknownFormat = errors.New("probe: unknown container format")
+	ErrMalformed     = errors.New("probe: malformed container")
+)
+
+// Info describes the streams found in a container.
+type Info struct {
+	Format     string
+	Duration   time.Duration
+	Width      int
+	Height     int
+	VideoCodec string
+	Audio      []Track
+	Subtitles  []Track
+}
+
+// Track is a single audio or subtitle stream.
+type Track struct {
+	Number   int
+	Codec    string
+	Language string
+	Name     string
+	Default  bool
+	Forced   bool
+}
+
+// File probes the container stored at path.
+func File(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Probe(f)
+}
+
+// Probe detects the container format of r and reads its headers.
+func Probe(r io.ReadSeeker) (*Info, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	switch {
+	case magic[0] == 0x1A && magic[1] == 0x45 && magic[2] == 0xDF && magic[3] == 0xA3:
+		return probeMatroska(r)
+	case isMP4Box(string(magic[4:8])):
+		return probeMP4(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+var codecNames = map[string]string{
+	// Matroska codec IDs
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_MPEG2":          "mpeg2video",
+	"A_AAC":            "aac",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_DTS":            "dts",
+	"A_FLAC":           "flac",
+	"A_OPUS":           "opus",
+	"A_VORBIS":         "vorbis",
+	"A_MPEG/L3":        "mp3",
+	"A_TRUEHD":         "truehd",
+	"S_TEXT/ASS":       "ass",
+	"S_TEXT/SSA":       "ssa",
+	"S_ASS":            "ass",
+	"S_SSA":            "ssa",
+	"S_TEXT/UTF8":      "subrip",
+	"S_TEXT/WEBVTT":    "webvtt",
+	"S_HDMV/PGS":       "pgs",
+	"S_VOBSUB":         "dvdsub",
+	// MP4 sample entry types
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+	"tx3g": "mov_text",
+	"wvtt": "webvtt",
+	"stpp": "ttml",
+}
+
+func codecName(id string) string {
+	if n, ok := codecNames[id]; ok {
+		return n
+	}
+	if len(id) > 2 && id[1] == '_' {
+		// Matroska IDs we don't know, such as A_AAC/MPEG4/LC.
+		for k, n := range codecNames {
+			if len(k) > 2 && k[1] == '_' && len(id) > len(k) && id[:len(k)+1] == k+"/" {
+				return n
+			}
+		}
+	}
+	return id
+}
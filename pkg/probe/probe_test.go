@@ -0,0 +1,210 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ebml encodes an element with a fixed 8 byte size field.
+func ebml(id uint32, payload ...[]byte) []byte {
+	var b bytes.Buffer
+	switch {
+	case id > 0xFFFFFF:
+		b.Write([]byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)})
+	case id > 0xFFFF:
+		b.Write([]byte{byte(id >> 16), byte(id >> 8), byte(id)})
+	case id > 0xFF:
+		b.Write([]byte{byte(id >> 8), byte(id)})
+	default:
+		b.WriteByte(byte(id))
+	}
+	data := bytes.Join(payload, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	b.Write(size)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func ebmlU(id uint32, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return ebml(id, b)
+}
+
+func ebmlS(id uint32, s string) []byte {
+	return ebml(id, []byte(s))
+}
+
+func ebmlF(id uint32, f float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	return ebml(id, b)
+}
+
+func TestProbeMatroska(t *testing.T) {
+	file := bytes.Join([][]byte{
+		ebml(idEBML, ebmlS(0x4282, "matroska")),
+		ebml(idSegment,
+			ebml(idInfo, ebmlU(idTimecodeScale, 1000000), ebmlF(idDuration, 1420500)),
+			ebml(idTracks,
+				ebml(idTrackEntry,
+					ebmlU(idTrackNumber, 1),
+					ebmlU(idTrackType, trackTypeVideo),
+					ebmlS(idCodecID, "V_MPEGH/ISO/HEVC"),
+					ebml(idVideo, ebmlU(idPixelWidth, 1920), ebmlU(idPixelHeight, 1080)),
+				),
+				ebml(idTrackEntry,
+					ebmlU(idTrackNumber, 2),
+					ebmlU(idTrackType, trackTypeAudio),
+					ebmlS(idCodecID, "A_OPUS"),
+					ebmlS(idLanguage, "jpn"),
+				),
+				ebml(idTrackEntry,
+					ebmlU(idTrackNumber, 3),
+					ebmlU(idTrackType, trackTypeAudio),
+					ebmlS(idCodecID, "A_AAC/MPEG4/LC"),
+					ebmlU(idFlagDefault, 0),
+				),
+				ebml(idTrackEntry,
+					ebmlU(idTrackNumber, 4),
+					ebmlU(idTrackType, trackTypeSubtitle),
+					ebmlS(idCodecID, "S_TEXT/ASS"),
+					ebmlS(idLanguage, "eng"),
+					ebmlS(idLanguageIETF, "en-US"),
+					ebmlS(idName, "Full Subtitles"),
+				),
+			),
+			ebml(idCluster, make([]byte, 64)),
+		),
+	}, nil)
+
+	info, err := Probe(bytes.NewReader(file))
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatMatroska, info.Format)
+		assert.Equal(t, 1420500*time.Millisecond, info.Duration)
+		assert.Equal(t, "hevc", info.VideoCodec)
+		assert.Equal(t, 1920, info.Width)
+		assert.Equal(t, 1080, info.Height)
+		if assert.Len(t, info.Audio, 2) {
+			assert.Equal(t, Track{Number: 2, Codec: "opus", Language: "jpn", Default: true}, info.Audio[0])
+			assert.Equal(t, Track{Number: 3, Codec: "aac", Language: "eng"}, info.Audio[1])
+		}
+		if assert.Len(t, info.Subtitles, 1) {
+			assert.Equal(t, "ass", info.Subtitles[0].Codec)
+			assert.Equal(t, "en-US", info.Subtitles[0].Language)
+			assert.Equal(t, "Full Subtitles", info.Subtitles[0].Name)
+		}
+	}
+}
+
+func TestProbeMatroskaSeekHead(t *testing.T) {
+	tracks := ebml(idTracks, ebml(idTrackEntry,
+		ebmlU(idTrackNumber, 1),
+		ebmlU(idTrackType, trackTypeAudio),
+		ebmlS(idCodecID, "A_FLAC"),
+		ebmlS(idLanguage, "jpn"),
+	))
+	info := ebml(idInfo, ebmlF(idDuration, 5000))
+	seekHead := func(infoPos, tracksPos uint64) []byte {
+		return ebml(idSeekHead,
+			ebml(idSeek, ebml(idSeekID, []byte{0x15, 0x49, 0xA9, 0x66}), ebmlU(idSeekPosition, infoPos)),
+			ebml(idSeek, ebml(idSeekID, []byte{0x16, 0x54, 0xAE, 0x6B}), ebmlU(idSeekPosition, tracksPos)),
+		)
+	}
+	cluster := ebml(idCluster, make([]byte, 128))
+	head := seekHead(0, 0)
+	infoPos := uint64(len(head) + len(cluster))
+	tracksPos := infoPos + uint64(len(info))
+	file := bytes.Join([][]byte{
+		ebml(idEBML),
+		ebml(idSegment, seekHead(infoPos, tracksPos), cluster, info, tracks),
+	}, nil)
+
+	i, err := Probe(bytes.NewReader(file))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5*time.Second, i.Duration)
+		if assert.Len(t, i.Audio, 1) {
+			assert.Equal(t, "flac", i.Audio[0].Codec)
+		}
+	}
+}
+
+// box encodes an MP4 box.
+func box(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, uint32(8+len(data)))
+	copy(b[4:], typ)
+	return append(b, data...)
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func mp4Trak(id uint32, handler, codec, lang string, width, height uint32) []byte {
+	tkhd := bytes.Join([][]byte{
+		{0, 0, 0, 1}, u32(0), u32(0), u32(id), u32(0), u32(0),
+		make([]byte, 8), make([]byte, 8), make([]byte, 36),
+		u32(width << 16), u32(height << 16),
+	}, nil)
+	packed := uint16(lang[0]-0x60)<<10 | uint16(lang[1]-0x60)<<5 | uint16(lang[2]-0x60)
+	mdhd := bytes.Join([][]byte{
+		u32(0), u32(0), u32(0), u32(1000), u32(1420500),
+		{byte(packed >> 8), byte(packed)}, {0, 0},
+	}, nil)
+	hdlr := bytes.Join([][]byte{u32(0), u32(0), []byte(handler), make([]byte, 12), {0}}, nil)
+	stsd := bytes.Join([][]byte{u32(0), u32(1), box(codec, make([]byte, 16))}, nil)
+	return box("trak",
+		box("tkhd", tkhd),
+		box("mdia",
+			box("mdhd", mdhd),
+			box("hdlr", hdlr),
+			box("minf", box("stbl", box("stsd", stsd))),
+		),
+	)
+}
+
+func TestProbeMP4(t *testing.T) {
+	mvhd := bytes.Join([][]byte{u32(0), u32(0), u32(0), u32(600), u32(852300), make([]byte, 80)}, nil)
+	file := bytes.Join([][]byte{
+		box("ftyp", []byte("isom"), u32(512), []byte("isomiso2avc1mp41")),
+		box("mdat", make([]byte, 256)),
+		box("moov",
+			box("mvhd", mvhd),
+			mp4Trak(1, "vide", "avc1", "und", 1280, 720),
+			mp4Trak(2, "soun", "mp4a", "jpn", 0, 0),
+			mp4Trak(3, "sbtl", "tx3g", "eng", 0, 0),
+		),
+	}, nil)
+
+	info, err := Probe(bytes.NewReader(file))
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatMP4, info.Format)
+		assert.Equal(t, 1420500*time.Millisecond, info.Duration)
+		assert.Equal(t, "h264", info.VideoCodec)
+		assert.Equal(t, 1280, info.Width)
+		assert.Equal(t, 720, info.Height)
+		if assert.Len(t, info.Audio, 1) {
+			assert.Equal(t, Track{Number: 2, Codec: "aac", Language: "jpn", Default: true}, info.Audio[0])
+		}
+		if assert.Len(t, info.Subtitles, 1) {
+			assert.Equal(t, "mov_text", info.Subtitles[0].Codec)
+			assert.Equal(t, "eng", info.Subtitles[0].Language)
+		}
+	}
+}
+
+func TestProbeUnknownFormat(t *testing.T) {
+	_, err := Probe(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00AVI LIST")))
+	assert.Equal(t, ErrUnknownFormat, err)
+}
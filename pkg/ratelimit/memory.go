@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryBucket struct {
+	Bucket
+	fullAt time.Time
+}
+
+// Memory keeps the buckets of one instance.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*memoryBucket)}
+}
+
+func (m *Memory) Take(key string, rule Rule, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = new(memoryBucket)
+		m.buckets[key] = b
+	}
+	res := rule.Take(&b.Bucket, now)
+	b.fullAt = rule.FullAt(&b.Bucket)
+	return res, nil
+}
+
+func (m *Memory) Sweep(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Package ratelimit limits requests with token buckets kept in a Store.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a token bucket of Limit requests that refills completely in
+// Period. Bursts may use the whole bucket at once.
+type Rule struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Limit of a route group. User counts per authenticated user, IP per client
+// address. A zero rule does not limit.
+type Limit struct {
+	User Rule
+	IP   Rule
+}
+
+// Bucket is the state of a key.
+type Bucket struct {
+	Tokens float64
+	Stamp  time.Time
+}
+
+// Result of taking a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is when the next token is there, set when not allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Take must be atomic per key.
+type Store interface {
+	Take(key string, rule Rule, now time.Time) (Result, error)
+	// Sweep forgets the buckets that are full again at now.
+	Sweep(now time.Time) error
+}
+
+func (r Rule) Zero() bool {
+	return r.Limit <= 0 || r.Period <= 0
+}
+
+// perToken is the time one token takes to come back.
+func (r Rule) perToken() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// Take refills b up to now and takes a token if there is one.
+func (r Rule) Take(b *Bucket, now time.Time) Result {
+	limit := float64(r.Limit)
+	if b.Stamp.IsZero() {
+		b.Tokens = limit
+	} else if elapsed := now.Sub(b.Stamp); elapsed > 0 {
+		b.Tokens = math.Min(limit, b.Tokens+float64(elapsed)/float64(r.perToken()))
+	}
+	b.Stamp = now
+
+	res := Result{Limit: r.Limit}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.Tokens) * float64(r.perToken()))
+	}
+	res.Remaining = int(b.Tokens)
+	res.Reset = r.FullAt(b).Sub(now)
+	return res
+}
+
+// FullAt is when b is full again.
+func (r Rule) FullAt(b *Bucket) time.Time {
+	return b.Stamp.Add(time.Duration((float64(r.Limit) - b.Tokens) * float64(r.perToken())))
+}
+
+// ParseRule parses "<limit>/<period>", e.g. "60/1m".
+func ParseRule(s string) (Rule, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q, expected <limit>/<period>", s)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: bad limit", s)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: bad period", s)
+	}
+	return Rule{Limit: limit, Period: period}, nil
+}
+
+// ParseLimits combines the rules per user and per IP of each group.
+func ParseLimits(user, ip map[string]string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for group, s := range user {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		l := limits[group]
+		l.User = r
+		limits[group] = l
+	}
+	for group, s := range ip {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		l := limits[group]
+		l.IP = r
+		limits[group] = l
+	}
+	return limits, nil
+}
+
+// Run sweeps s every interval until ctx is done.
+func Run(ctx context.Context, s Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.Sweep(now); err != nil {
+				log.Println("ratelimit:", err)
+			}
+		}
+	}
+}
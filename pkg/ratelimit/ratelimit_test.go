@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTake(t *testing.T) {
+	rule := Rule{Limit: 3, Period: 3 * time.Second}
+	now := time.Now()
+	b := &Bucket{}
+
+	for i := 2; i >= 0; i-- {
+		res := rule.Take(b, now)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res := rule.Take(b, now)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	res = rule.Take(b, now.Add(time.Second))
+	assert.True(t, res.Allowed, "a token came back")
+	assert.Equal(t, 0, res.Remaining)
+
+	res = rule.Take(b, now.Add(time.Hour))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining, "the bucket holds no more than the limit")
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits(map[string]string{"write": "60/1m"}, map[string]string{"write": "120/1m", "auth": "10/1m"})
+	require.NoError(t, err)
+	assert.Equal(t, Limit{User: Rule{60, time.Minute}, IP: Rule{120, time.Minute}}, limits["write"])
+	assert.True(t, limits["auth"].User.Zero())
+
+	_, err = ParseLimits(map[string]string{"write": "60"}, nil)
+	assert.Error(t, err)
+	_, err = ParseRule("x/1m")
+	assert.Error(t, err)
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	rule := Rule{Limit: 1, Period: time.Minute}
+	now := time.Now()
+
+	res, _ := m.Take("a", rule, now)
+	assert.True(t, res.Allowed)
+	res, _ = m.Take("a", rule, now)
+	assert.False(t, res.Allowed)
+	res, _ = m.Take("b", rule, now)
+	assert.True(t, res.Allowed, "keys have their own buckets")
+
+	require.NoError(t, m.Sweep(now.Add(30*time.Second)))
+	assert.Len(t, m.buckets, 2)
+	require.NoError(t, m.Sweep(now.Add(time.Minute)))
+	assert.Empty(t, m.buckets)
+}
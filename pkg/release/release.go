@@ -0,0 +1,116 @@
+// Package release parses the file names used by anime release groups, such as
+// "[Group] Title - 01v2 (1080p) [ABCD1234].mkv".
+package release
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Release struct {
+	Group      string
+	Title      string
+	Season     int
+	Episode    int
+	Version    int
+	Resolution string
+	CRC32      string
+	Ext        string
+}
+
+var (
+	bracketRe    = regexp.MustCompile(`[\[(]([^\[\]()]*)[\])]`)
+	crcRe        = regexp.MustCompile(`^[0-9A-Fa-f]{8}$`)
+	resolutionRe = regexp.MustCompile(`(?i)\b(\d{3,4}p|\d{3,4}x(\d{3,4}))\b`)
+	seasonRe     = regexp.MustCompile(`(?i)\bS(\d{1,2})E(\d{1,4})(?:v(\d))?\b`)
+	dashRe       = regexp.MustCompile(`(?i)\s-\s(?:EP?\s?)?(\d{1,4})(?:v(\d))?(?:\s|$)`)
+	episodeRe    = regexp.MustCompile(`(?i)(?:^|\s)(?:EP?|#)?(\d{1,4})(?:v(\d))?(?:\s|$)`)
+	separatorRe  = regexp.MustCompile(`[._]+`)
+	spaceRe      = regexp.MustCompile(`\s+`)
+)
+
+// Parse extracts the release information from the base name of path.
+func Parse(path string) Release {
+	var r Release
+	name := filepath.Base(path)
+	r.Ext = strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	if strings.HasPrefix(name, "[") {
+		if end := strings.Index(name, "]"); end > 0 {
+			r.Group = strings.TrimSpace(name[1:end])
+			name = name[end+1:]
+		}
+	}
+
+	for _, m := range bracketRe.FindAllStringSubmatch(name, -1) {
+		tag := strings.TrimSpace(m[1])
+		if crcRe.MatchString(tag) {
+			r.CRC32 = strings.ToUpper(tag)
+		}
+		if r.Resolution == "" {
+			r.Resolution = resolution(tag)
+		}
+	}
+	name = bracketRe.ReplaceAllString(name, " ")
+
+	if !strings.Contains(name, " ") {
+		name = separatorRe.ReplaceAllString(name, " ")
+	}
+	if r.Resolution == "" {
+		r.Resolution = resolution(name)
+	}
+
+	title := name
+	if m := seasonRe.FindStringSubmatchIndex(name); m != nil {
+		r.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+		r.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		if m[6] > 0 {
+			r.Version, _ = strconv.Atoi(name[m[6]:m[7]])
+		}
+		title = name[:m[0]]
+	} else if m := dashRe.FindStringSubmatchIndex(name + " "); m != nil {
+		r.Episode, _ = strconv.Atoi(name[m[2]:m[3]])
+		if m[4] > 0 {
+			r.Version, _ = strconv.Atoi(name[m[4]:m[5]])
+		}
+		title = name[:m[0]]
+	} else if loc := lastEpisode(name); loc != nil {
+		r.Episode, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		if loc[4] > 0 {
+			r.Version, _ = strconv.Atoi(name[loc[4]:loc[5]])
+		}
+		title = name[:loc[0]]
+	}
+	r.Title = strings.Trim(spaceRe.ReplaceAllString(title, " "), " -")
+	return r
+}
+
+// lastEpisode finds the last bare number that is not a resolution or year.
+func lastEpisode(name string) []int {
+	var found []int
+	for _, m := range episodeRe.FindAllStringSubmatchIndex(name, -1) {
+		if m[0] == 0 && !strings.ContainsAny(name[:m[1]], "eE#") {
+			// A leading number is more likely part of the title.
+			continue
+		}
+		if n, _ := strconv.Atoi(name[m[2]:m[3]]); n >= 1900 && n <= 2100 {
+			continue
+		}
+		found = m
+	}
+	return found
+}
+
+func resolution(s string) string {
+	m := resolutionRe.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	if m[2] != "" {
+		return m[2] + "p"
+	}
+	return strings.ToLower(m[1])
+}
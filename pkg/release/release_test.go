@@ -0,0 +1,38 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name string
+		want Release
+	}{
+		{
+			"[SubsPlease] Sousou no Frieren - 01 (1080p) [F02A9B1C].mkv",
+			Release{Group: "SubsPlease", Title: "Sousou no Frieren", Episode: 1, Resolution: "1080p", CRC32: "F02A9B1C", Ext: "mkv"},
+		},
+		{
+			"/library/Erai/[Erai-raws] Kimetsu no Yaiba - 05v2 [720p][HEVC][abcdef12].mkv",
+			Release{Group: "Erai-raws", Title: "Kimetsu no Yaiba", Episode: 5, Version: 2, Resolution: "720p", CRC32: "ABCDEF12", Ext: "mkv"},
+		},
+		{
+			"Mob.Psycho.100.S02E07.1080p.WEB.x264-GROUP.mp4",
+			Release{Title: "Mob Psycho 100", Season: 2, Episode: 7, Resolution: "1080p", Ext: "mp4"},
+		},
+		{
+			"[Group] Cowboy Bebop 12 [BD 1920x1080 FLAC].mkv",
+			Release{Group: "Group", Title: "Cowboy Bebop", Episode: 12, Resolution: "1080p", Ext: "mkv"},
+		},
+		{
+			"86 - 03.mkv",
+			Release{Title: "86", Episode: 3, Ext: "mkv"},
+		},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, Parse(c.name), c.name)
+	}
+}
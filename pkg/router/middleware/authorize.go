@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// Authorize only lets through users whose roles grant perm. It reads the
+// roles the JWT middleware put in the context, so it must run after it.
+func Authorize(perm string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			roles, _ := c.Get("roles").([]string)
+			if !user.Can(roles, perm) {
+				return c.JSON(http.StatusForbidden, utils.AccessForbidden())
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,18 +1,32 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/keyset"
 	"github.com/xenking/kitsu-media-server/pkg/utils"
 )
 
 type (
 	JWTConfig struct {
-		Skipper    Skipper
-		SigningKey interface{}
+		Skipper Skipper
+		// Keys verify the tokens by their kid header.
+		Keys *keyset.Set
+		// SignedURLs accepts links from utils.SignURL instead of the
+		// Authorization header on GET and HEAD requests.
+		SignedURLs bool
+		// Revoked reports whether the token or its session was revoked.
+		Revoked func(sessionID uint, jti string) (bool, error)
+		// Seen is called with the session of every authenticated request.
+		Seen func(sessionID uint)
+		// Tokens looks up personal access tokens. It returns nil for
+		// unknown and expired ones.
+		Tokens func(token string) (*AccessToken, error)
+		// Scope returns the scope an access token needs for the route, or
+		// "" when tokens may not use it.
+		Scope func(c echo.Context) string
 	}
 	Skipper      func(c echo.Context) bool
 	jwtExtractor func(echo.Context) (string, error)
@@ -21,11 +35,12 @@ type (
 var (
 	ErrJWTMissing = echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt")
 	ErrJWTInvalid = echo.NewHTTPError(http.StatusForbidden, "invalid or expired jwt")
+	ErrJWTRevoked = echo.NewHTTPError(http.StatusUnauthorized, "revoked jwt")
 )
 
-func JWT(key interface{}) echo.MiddlewareFunc {
+func JWT(keys *keyset.Set) echo.MiddlewareFunc {
 	c := JWTConfig{}
-	c.SigningKey = key
+	c.Keys = keys
 	return JWTWithConfig(c)
 }
 
@@ -33,6 +48,9 @@ func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
 	extractor := jwtFromHeader("Authorization", "Token")
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if config.SignedURLs && hasSignedURL(c) {
+				return signedURL(c, next)
+			}
 			auth, err := extractor(c)
 			if err != nil {
 				if config.Skipper != nil {
@@ -42,18 +60,33 @@ func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
 				}
 				return c.JSON(http.StatusUnauthorized, utils.NewError(err))
 			}
-			token, err := jwt.Parse(auth, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return config.SigningKey, nil
-			})
+			if isAccessToken(auth) {
+				return accessToken(c, config, auth, next)
+			}
+			token, err := jwt.Parse(auth, config.Keys.Keyfunc)
 			if err != nil {
 				return c.JSON(http.StatusForbidden, utils.NewError(ErrJWTInvalid))
 			}
 			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 				userID := uint(claims["id"].(float64))
+				sessionID, _ := claims["sid"].(float64)
+				jti, _ := claims["jti"].(string)
+				if config.Revoked != nil {
+					revoked, err := config.Revoked(uint(sessionID), jti)
+					if err != nil {
+						return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+					}
+					if revoked {
+						return c.JSON(http.StatusUnauthorized, utils.NewError(ErrJWTRevoked))
+					}
+				}
+				if config.Seen != nil {
+					config.Seen(uint(sessionID))
+				}
 				c.Set("user", userID)
+				c.Set("session", uint(sessionID))
+				c.Set("jti", jti)
+				c.Set("roles", rolesFromClaims(claims))
 				return next(c)
 			}
 			return c.JSON(http.StatusForbidden, utils.NewError(ErrJWTInvalid))
@@ -61,6 +94,17 @@ func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
 	}
 }
 
+func rolesFromClaims(claims jwt.MapClaims) []string {
+	list, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(list))
+	for _, r := range list {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
 // jwtFromHeader returns a `jwtExtractor` that extracts token from the request header.
 func jwtFromHeader(header string, authScheme string) jwtExtractor {
 	return func(c echo.Context) (string, error) {
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/ratelimit"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var ErrRateLimited = errors.New("too many requests, slow down")
+
+type RateLimitConfig struct {
+	Store ratelimit.Store
+	// Limits by route group.
+	Limits map[string]ratelimit.Limit
+	// Group returns the group of the request, "" is not limited.
+	Group func(c echo.Context) string
+}
+
+// RateLimit limits the requests of group. The user is counted when the JWT
+// middleware ran before, the client address always.
+func RateLimit(store ratelimit.Store, limits map[string]ratelimit.Limit, group string) echo.MiddlewareFunc {
+	return RateLimitWithConfig(RateLimitConfig{
+		Store:  store,
+		Limits: limits,
+		Group:  func(echo.Context) string { return group },
+	})
+}
+
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			group := config.Group(c)
+			limit, ok := config.Limits[group]
+			if !ok {
+				return next(c)
+			}
+
+			now := time.Now()
+			var (
+				shown   *ratelimit.Result
+				limited *ratelimit.Result
+			)
+			take := func(key string, rule ratelimit.Rule) {
+				if rule.Zero() {
+					return
+				}
+				res, err := config.Store.Take(group+":"+key, rule, now)
+				if err != nil {
+					// An unavailable store must not take the API down with it.
+					log.Println("ratelimit:", err)
+					return
+				}
+				if shown == nil || res.Remaining < shown.Remaining {
+					shown = &res
+				}
+				if !res.Allowed && (limited == nil || res.RetryAfter > limited.RetryAfter) {
+					limited = &res
+				}
+			}
+			if userID, ok := c.Get("user").(uint); ok && userID != 0 {
+				take("user:"+strconv.FormatUint(uint64(userID), 10), limit.User)
+			}
+			take("ip:"+c.RealIP(), limit.IP)
+
+			if limited != nil {
+				shown = limited
+			}
+			if shown != nil {
+				h := c.Response().Header()
+				h.Set("RateLimit-Limit", strconv.Itoa(shown.Limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(shown.Remaining))
+				h.Set("RateLimit-Reset", seconds(shown.Reset))
+			}
+			if limited != nil {
+				c.Response().Header().Set("Retry-After", seconds(limited.RetryAfter))
+				return c.JSON(http.StatusTooManyRequests, utils.NewError(ErrRateLimited))
+			}
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds d up, headers count whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
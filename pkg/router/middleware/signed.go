@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// hasSignedURL reports whether the request was made with a link from
+// utils.SignURL. Only reads can be authorized that way.
+func hasSignedURL(c echo.Context) bool {
+	m := c.Request().Method
+	return (m == http.MethodGet || m == http.MethodHead) && c.QueryParam("sig") != ""
+}
+
+// signedURL authorizes the request with its signed link.
+func signedURL(c echo.Context, next echo.HandlerFunc) error {
+	userID, err := utils.VerifyURL(c.Request().URL.Path, c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusForbidden, utils.NewError(err))
+	}
+	c.Set("user", userID)
+	return next(c)
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/user"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+// AccessToken is an authenticated personal access token.
+type AccessToken struct {
+	ID     uint
+	UserID uint
+	Roles  []string
+	Scopes []string
+}
+
+var (
+	ErrTokenInvalid = echo.NewHTTPError(http.StatusForbidden, "invalid or expired access token")
+	ErrTokenScope   = echo.NewHTTPError(http.StatusForbidden, "not allowed with an access token")
+)
+
+func isAccessToken(auth string) bool {
+	return strings.HasPrefix(auth, user.AccessTokenPrefix)
+}
+
+// accessToken authorizes the request with a personal access token. Routes
+// without a scope are closed to tokens.
+func accessToken(c echo.Context, config JWTConfig, auth string, next echo.HandlerFunc) error {
+	if config.Tokens == nil {
+		return c.JSON(http.StatusForbidden, utils.NewError(ErrTokenInvalid))
+	}
+	t, err := config.Tokens(auth)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+	}
+	if t == nil {
+		return c.JSON(http.StatusForbidden, utils.NewError(ErrTokenInvalid))
+	}
+
+	scope := ""
+	if config.Scope != nil {
+		scope = config.Scope(c)
+	}
+	if scope == "" {
+		return c.JSON(http.StatusForbidden, utils.NewError(ErrTokenScope))
+	}
+	if !user.HasScope(t.Scopes, scope) {
+		return c.JSON(http.StatusForbidden, utils.NewError(fmt.Errorf("the access token lacks the %s scope", scope)))
+	}
+
+	c.Set("user", t.UserID)
+	c.Set("roles", t.Roles)
+	c.Set("scopes", t.Scopes)
+	c.Set("accessToken", t.ID)
+	return next(c)
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xenking/kitsu-media-server/pkg/utils"
+)
+
+var ErrEmailUnverified = errors.New("verify your email address first")
+
+// Verified only lets through users whose email address is verified. It
+// must run after the JWT middleware.
+func Verified(isVerified func(userID uint) (bool, error)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, _ := c.Get("user").(uint)
+			ok, err := isVerified(userID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, utils.NewError(err))
+			}
+			if !ok {
+				return c.JSON(http.StatusForbidden, utils.NewError(ErrEmailUnverified))
+			}
+			return next(c)
+		}
+	}
+}
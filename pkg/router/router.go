@@ -1,14 +1,18 @@
 package router
 
 import (
+	"net"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
+	"github.com/xenking/kitsu-media-server/pkg/config"
 )
 
 func New() *echo.Echo {
 	e := echo.New()
 	e.Logger.SetLevel(log.DEBUG)
+	e.IPExtractor = IPExtractor(config.Global.TrustedProxies)
 	e.Pre(middleware.RemoveTrailingSlash())
 	e.Use(middleware.Logger())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
@@ -19,3 +23,17 @@ func New() *echo.Echo {
 	e.Validator = NewValidator()
 	return e
 }
+
+// IPExtractor finds the client address that rate limits and login lockouts
+// count for. Clients can send any X-Forwarded-For header, so it is only read
+// from the proxies, and the address of the connection is used otherwise.
+func IPExtractor(proxies []*net.IPNet) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, p := range proxies {
+		opts = append(opts, echo.TrustIPRange(p))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
@@ -0,0 +1,93 @@
+package scrobble
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// jellyfinPayload is the JSON of the Jellyfin webhook plugin with its
+// default template. Numbers may be rendered as strings by custom templates.
+type jellyfinPayload struct {
+	NotificationType      string
+	ItemType              string
+	Name                  string
+	SeriesName            string
+	SeriesID              string `json:"SeriesId"`
+	SeasonNumber          flexInt
+	EpisodeNumber         flexInt
+	PlaybackPositionTicks flexInt
+	RunTimeTicks          flexInt
+	PlayedToCompletion    bool
+}
+
+// ticksPerSecond is the resolution of .NET time spans used by Jellyfin.
+const ticksPerSecond = 10000000
+
+func parseJellyfin(body io.Reader) (*Event, error) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var p jellyfinPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	if p.NotificationType != "PlaybackStop" && p.NotificationType != "PlaybackProgress" {
+		return nil, nil
+	}
+	ev := &Event{
+		Completed:   p.PlayedToCompletion,
+		Position:    float64(p.PlaybackPositionTicks) / ticksPerSecond,
+		Duration:    float64(p.RunTimeTicks) / ticksPerSecond,
+		ExternalIDs: make(map[string]string),
+	}
+	switch p.ItemType {
+	case "Episode":
+		ev.Title = p.SeriesName
+		ev.Season = int(p.SeasonNumber)
+		ev.Episode = int(p.EpisodeNumber)
+		if p.SeriesID != "" {
+			ev.ExternalIDs["jellyfin"] = p.SeriesID
+		}
+	case "Movie":
+		ev.Title = p.Name
+		// Provider IDs belong to the played item, which for movies is the media itself.
+		for key, v := range raw {
+			if !strings.HasPrefix(key, "Provider_") {
+				continue
+			}
+			var id string
+			if json.Unmarshal(v, &id) == nil && id != "" {
+				ev.ExternalIDs[strings.ToLower(strings.TrimPrefix(key, "Provider_"))] = id
+			}
+		}
+	default:
+		return nil, nil
+	}
+	return ev, nil
+}
+
+// flexInt accepts both JSON numbers and numeric strings.
+type flexInt int64
+
+func (n *flexInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*n = flexInt(v)
+	return nil
+}
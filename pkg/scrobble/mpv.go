@@ -0,0 +1,45 @@
+package scrobble
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"github.com/xenking/kitsu-media-server/pkg/release"
+)
+
+// mpvPayload is sent by the mpv user script: "progress" periodically while
+// playing and "end" when the file is closed.
+type mpvPayload struct {
+	Event     string  `json:"event"`
+	Path      string  `json:"path"`
+	Title     string  `json:"title"`
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+	Completed bool    `json:"completed"`
+}
+
+func parseMPV(body io.Reader) (*Event, error) {
+	var p mpvPayload
+	if err := json.NewDecoder(body).Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.Event != "progress" && p.Event != "end" {
+		return nil, nil
+	}
+	ev := &Event{
+		Completed: p.Completed,
+		Path:      p.Path,
+		Position:  p.Position,
+		Duration:  p.Duration,
+	}
+	// media-title is the file name unless the container has a title, which
+	// is usually named like a release as well.
+	if p.Title != "" && p.Title != filepath.Base(p.Path) {
+		r := release.Parse(p.Title)
+		ev.Title = r.Title
+		ev.Season = r.Season
+		ev.Episode = r.Episode
+	}
+	return ev, nil
+}
@@ -0,0 +1,92 @@
+package scrobble
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// plexPayload is the JSON sent by Plex Media Server in the payload field of
+// a multipart form.
+type plexPayload struct {
+	Event    string `json:"event"`
+	Metadata struct {
+		Type             string `json:"type"`
+		Title            string `json:"title"`
+		GrandparentTitle string `json:"grandparentTitle"`
+		GrandparentGUID  string `json:"grandparentGuid"`
+		GUID             string `json:"guid"`
+		ParentIndex      int    `json:"parentIndex"`
+		Index            int    `json:"index"`
+		ViewOffset       int64  `json:"viewOffset"`
+		Duration         int64  `json:"duration"`
+	} `json:"Metadata"`
+}
+
+func parsePlex(r *http.Request) (*Event, error) {
+	// Plex sends thumbnails along, keep at most a few of them in memory.
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return nil, err
+	}
+	var p plexPayload
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &p); err != nil {
+		return nil, err
+	}
+
+	ev := &Event{
+		Position:    float64(p.Metadata.ViewOffset) / 1000,
+		Duration:    float64(p.Metadata.Duration) / 1000,
+		ExternalIDs: make(map[string]string),
+	}
+	switch p.Event {
+	case "media.scrobble":
+		ev.Completed = true
+	case "media.stop", "media.pause":
+	default:
+		return nil, nil
+	}
+
+	guid := p.Metadata.GUID
+	switch p.Metadata.Type {
+	case "episode":
+		ev.Title = p.Metadata.GrandparentTitle
+		ev.Season = p.Metadata.ParentIndex
+		ev.Episode = p.Metadata.Index
+		guid = p.Metadata.GrandparentGUID
+	case "movie":
+		ev.Title = p.Metadata.Title
+	default:
+		return nil, nil
+	}
+	if provider, id := plexGUID(guid); provider != "" {
+		ev.ExternalIDs[provider] = id
+	}
+	return ev, nil
+}
+
+// plexGUID splits an agent GUID such as "com.plexapp.agents.hama://anidb-1234/1/3?lang=en"
+// or "plex://show/5d9c086c7d5c3e001f6d1d53" into a provider and an ID.
+func plexGUID(guid string) (string, string) {
+	u, err := url.Parse(guid)
+	if err != nil || u.Host == "" {
+		return "", ""
+	}
+	if u.Scheme == "plex" {
+		return "plex", strings.TrimPrefix(u.Host+u.Path, "show/")
+	}
+	agent := u.Scheme[strings.LastIndexByte(u.Scheme, '.')+1:]
+	id := u.Host
+	switch agent {
+	case "hama":
+		if i := strings.IndexByte(id, '-'); i > 0 {
+			return id[:i], id[i+1:]
+		}
+		return "", ""
+	case "thetvdb":
+		return "tvdb", id
+	case "themoviedb":
+		return "tmdb", id
+	}
+	return agent, id
+}
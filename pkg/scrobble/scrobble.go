@@ -0,0 +1,137 @@
+// Package scrobble understands the playback webhooks of external players
+// and matches the played files to the library.
+package scrobble
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/release"
+)
+
+var ErrUnknownProvider = errors.New("unknown scrobble provider")
+
+// Event is a playback report of an external player. Parsers return a nil
+// Event for reports that carry nothing worth recording, like a pause.
+type Event struct {
+	Completed bool
+	Title     string
+	Season    int
+	Episode   int
+	// ExternalIDs maps a provider to the ID of the played show or movie.
+	ExternalIDs map[string]string
+	Path        string
+	// Position and Duration are in seconds, zero when unknown.
+	Position float64
+	Duration float64
+}
+
+// Parse reads the webhook of provider from r.
+func Parse(provider string, r *http.Request) (*Event, error) {
+	switch provider {
+	case model.SourcePlex:
+		return parsePlex(r)
+	case model.SourceJellyfin:
+		return parseJellyfin(r.Body)
+	case model.SourceMPV:
+		return parseMPV(r.Body)
+	}
+	return nil, ErrUnknownProvider
+}
+
+// idPriority orders the providers of external IDs from the most to the least
+// specific. Providers not listed come after them by name.
+var idPriority = []string{"anidb", "anilist", "mal", "kitsu", "tvdb", "tmdb", "imdb", "plex", "jellyfin"}
+
+// providers returns the providers of ids in the order of idPriority, so that
+// an event with several IDs always resolves the same way.
+func providers(ids map[string]string) []string {
+	rank := func(p string) int {
+		for i, q := range idPriority {
+			if p == q {
+				return i
+			}
+		}
+		return len(idPriority)
+	}
+	list := make([]string, 0, len(ids))
+	for p := range ids {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ri, rj := rank(list[i]), rank(list[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return list[i] < list[j]
+	})
+	return list
+}
+
+// Resolver finds the media and episode of an event.
+type Resolver struct {
+	files   library.Store
+	matcher *library.Matcher
+}
+
+func NewResolver(ls library.Store, m *library.Matcher) *Resolver {
+	return &Resolver{
+		files:   ls,
+		matcher: m,
+	}
+}
+
+// Resolve tries the external IDs first, then the file path if it is part of
+// the library, then the title and finally the file name. It returns a zero
+// media ID when nothing matched.
+func (r *Resolver) Resolve(ev *Event) (uint, int, error) {
+	for _, provider := range providers(ev.ExternalIDs) {
+		mediaID, err := r.files.GetMediaIDByExternalID(provider, ev.ExternalIDs[provider])
+		if err != nil {
+			return 0, 0, err
+		}
+		if mediaID != 0 {
+			return mediaID, episodeOrFirst(ev.Episode), nil
+		}
+	}
+
+	if ev.Path != "" {
+		f, err := r.files.GetFileByPath(ev.Path)
+		if err != nil {
+			return 0, 0, err
+		}
+		if f != nil {
+			return f.MediaID, f.Episode, nil
+		}
+	}
+
+	candidates := make([]release.Release, 0, 2)
+	if ev.Title != "" {
+		candidates = append(candidates, release.Release{Title: ev.Title, Season: ev.Season, Episode: episodeOrFirst(ev.Episode)})
+	}
+	if ev.Path != "" {
+		candidates = append(candidates, release.Parse(filepath.Base(ev.Path)))
+	}
+	for _, c := range candidates {
+		m, err := r.matcher.Match(c)
+		if err != nil {
+			return 0, 0, err
+		}
+		if m != nil {
+			return m.ID, c.Episode, nil
+		}
+	}
+	return 0, 0, nil
+}
+
+// episodeOrFirst treats movies, which have no episode number, as episode 1.
+func episodeOrFirst(episode int) int {
+	if episode <= 0 {
+		return 1
+	}
+	return episode
+}
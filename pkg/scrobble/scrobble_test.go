@@ -0,0 +1,117 @@
+package scrobble
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlex(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("payload", `{
+		"event": "media.scrobble",
+		"Metadata": {
+			"type": "episode",
+			"grandparentTitle": "Made in Abyss",
+			"grandparentGuid": "com.plexapp.agents.hama://anidb-13273?lang=en",
+			"parentIndex": 2,
+			"index": 5,
+			"viewOffset": 1300000,
+			"duration": 1440000
+		}
+	}`)
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/scrobble/plex", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	ev, err := Parse("plex", req)
+	assert.NoError(t, err)
+	if assert.NotNil(t, ev) {
+		assert.True(t, ev.Completed)
+		assert.Equal(t, "Made in Abyss", ev.Title)
+		assert.Equal(t, 2, ev.Season)
+		assert.Equal(t, 5, ev.Episode)
+		assert.Equal(t, map[string]string{"anidb": "13273"}, ev.ExternalIDs)
+		assert.Equal(t, 1300.0, ev.Position)
+		assert.Equal(t, 1440.0, ev.Duration)
+	}
+}
+
+func TestParseJellyfin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/scrobble/jellyfin", strings.NewReader(`{
+		"NotificationType": "PlaybackStop",
+		"ItemType": "Episode",
+		"SeriesName": "Frieren",
+		"SeriesId": "5f0c3ab1",
+		"SeasonNumber": "01",
+		"EpisodeNumber": 3,
+		"PlaybackPositionTicks": 6000000000,
+		"RunTimeTicks": 14400000000,
+		"PlayedToCompletion": false
+	}`))
+
+	ev, err := Parse("jellyfin", req)
+	assert.NoError(t, err)
+	if assert.NotNil(t, ev) {
+		assert.False(t, ev.Completed)
+		assert.Equal(t, "Frieren", ev.Title)
+		assert.Equal(t, 1, ev.Season)
+		assert.Equal(t, 3, ev.Episode)
+		assert.Equal(t, map[string]string{"jellyfin": "5f0c3ab1"}, ev.ExternalIDs)
+		assert.Equal(t, 600.0, ev.Position)
+		assert.Equal(t, 1440.0, ev.Duration)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/scrobble/jellyfin", strings.NewReader(`{"NotificationType": "ItemAdded", "ItemType": "Episode"}`))
+	ev, err = Parse("jellyfin", req)
+	assert.NoError(t, err)
+	assert.Nil(t, ev)
+}
+
+func TestParseMPV(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/scrobble/mpv", strings.NewReader(`{
+		"event": "end",
+		"path": "/anime/[Group] Show - 04 [ABCD1234].mkv",
+		"title": "[Group] Show - 04 [ABCD1234].mkv",
+		"position": 1400,
+		"duration": 1420,
+		"completed": true
+	}`))
+
+	ev, err := Parse("mpv", req)
+	assert.NoError(t, err)
+	if assert.NotNil(t, ev) {
+		assert.True(t, ev.Completed)
+		assert.Empty(t, ev.Title, "a title equal to the file name adds nothing")
+		assert.Equal(t, "/anime/[Group] Show - 04 [ABCD1234].mkv", ev.Path)
+	}
+
+	_, err = Parse("vlc", req)
+	assert.Equal(t, ErrUnknownProvider, err)
+}
+
+func TestPlexGUID(t *testing.T) {
+	for guid, want := range map[string][2]string{
+		"com.plexapp.agents.thetvdb://81797/1/3?lang=en": {"tvdb", "81797"},
+		"com.plexapp.agents.hama://anidb-1234/1/3":       {"anidb", "1234"},
+		"plex://show/5d9c086c7d5c3e001f6d1d53":           {"plex", "5d9c086c7d5c3e001f6d1d53"},
+		"local://123":                                    {"local", "123"},
+		"":                                               {"", ""},
+	} {
+		provider, id := plexGUID(guid)
+		assert.Equal(t, want, [2]string{provider, id}, guid)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	ids := map[string]string{"jellyfin": "a", "zzz": "b", "tmdb": "c", "anidb": "d", "aaa": "e"}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []string{"anidb", "tmdb", "jellyfin", "aaa", "zzz"}, providers(ids))
+	}
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"github.com/jinzhu/gorm"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 )
 
@@ -27,7 +28,13 @@ func (as *ArticleStore) GetBySlug(s string) (*model.Article, error) {
 		return nil, err
 	}
 
-	return &m, err
+	counts, err := countComments(as.db, model.CommentableArticle, []uint{m.ID})
+	if err != nil {
+		return nil, err
+	}
+	m.CommentsCount = counts[m.ID]
+
+	return &m, nil
 }
 
 func (as *ArticleStore) GetUserArticleBySlug(userID uint, slug string) (*model.Article, error) {
@@ -129,6 +136,9 @@ func (as *ArticleStore) List(offset, limit int) ([]model.Article, int, error) {
 		Limit(limit).
 		Order("created_at desc").Find(&articles)
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -156,6 +166,9 @@ func (as *ArticleStore) ListByTag(tag string, offset, limit int) ([]model.Articl
 
 	count = as.db.Model(&t).Association("Articles").Count()
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -181,6 +194,9 @@ func (as *ArticleStore) ListByAuthor(username string, offset, limit int) ([]mode
 		Find(&articles)
 	as.db.Where(&model.Article{Content: model.Content{AuthorID: u.ID}}).Model(&model.Article{}).Count(&count)
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -208,6 +224,9 @@ func (as *ArticleStore) ListByWhoFavorited(username string, offset, limit int) (
 
 	count = as.db.Model(&u).Association("ArticleFavorites").Count()
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -246,21 +265,21 @@ func (as *ArticleStore) ListFeed(userID uint, offset, limit int) ([]model.Articl
 		Find(&articles)
 	as.db.Where(&model.Article{Content: model.Content{AuthorID: u.ID}}).Model(&model.Article{}).Count(&count)
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
 func (as *ArticleStore) AddComment(a *model.Article, c *model.Comment) error {
-	err := as.db.Model(a).Association("Comments").Append(c).Error
-	if err != nil {
-		return err
-	}
-
-	return as.db.Where(c.ID).Preload("User").First(c).Error
+	return addComment(as.db, model.CommentableArticle, a.ID, c)
 }
 
-func (as *ArticleStore) GetCommentsBySlug(slug string) ([]model.Comment, error) {
+// GetCommentsBySlug returns a page of the comment threads of the article,
+// nil when there is no such article.
+func (as *ArticleStore) GetCommentsBySlug(slug string, q comment.Query) (*comment.Page, error) {
 	var m model.Article
-	err := as.db.Where(&model.Article{Content: model.Content{Slug: slug}}).Preload("Comments").Preload("Comments.User").First(&m).Error
+	err := as.db.Where(&model.Article{Content: model.Content{Slug: slug}}).First(&m).Error
 
 	if err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -270,24 +289,17 @@ func (as *ArticleStore) GetCommentsBySlug(slug string) ([]model.Comment, error)
 		return nil, err
 	}
 
-	return m.Comments, nil
+	return listComments(as.db, model.CommentableArticle, m.ID, q)
 }
 
-func (as *ArticleStore) GetCommentByID(id uint) (*model.Comment, error) {
-	var m model.Comment
-	if err := as.db.Where(id).First(&m).Error; err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			return nil, nil
-		}
-
-		return nil, err
-	}
-
-	return &m, nil
+// GetComment returns the comment id, nil when it is not on the article.
+func (as *ArticleStore) GetComment(a *model.Article, id uint) (*model.Comment, error) {
+	return getComment(as.db, model.CommentableArticle, a.ID, id)
 }
 
-func (as *ArticleStore) DeleteComment(c *model.Comment) error {
-	return as.db.Delete(c).Error
+// DeleteComment deletes c, which must be on the article.
+func (as *ArticleStore) DeleteComment(a *model.Article, c *model.Comment) error {
+	return deleteComment(as.db, model.CommentableArticle, a.ID, c)
 }
 
 func (as *ArticleStore) AddFavorite(a *model.Article, userID uint) error {
@@ -312,3 +324,19 @@ func (as *ArticleStore) ListTags() ([]model.Tag, error) {
 
 	return tags, nil
 }
+
+// withCommentsCount sets the comments count of each of articles.
+func (as *ArticleStore) withCommentsCount(articles []model.Article) error {
+	ids := make([]uint, len(articles))
+	for i := range articles {
+		ids[i] = articles[i].ID
+	}
+	counts, err := countComments(as.db, model.CommentableArticle, ids)
+	if err != nil {
+		return err
+	}
+	for i := range articles {
+		articles[i].CommentsCount = counts[articles[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,497 @@
+package store
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type CommentStore struct {
+	db *gorm.DB
+}
+
+func NewCommentStore(db *gorm.DB) *CommentStore {
+	return &CommentStore{
+		db: db,
+	}
+}
+
+func (cs *CommentStore) GetByID(id uint) (*model.Comment, error) {
+	var m model.Comment
+	if err := cs.db.Preload("User").First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Update replaces the body only while it is still the one c was loaded
+// with, so that concurrent edits do not lose a revision.
+func (cs *CommentStore) Update(c *model.Comment, body string) (bool, error) {
+	now := time.Now()
+	tx := cs.db.Begin()
+	res := tx.Model(&model.Comment{}).
+		Where("id = ? AND body = ? AND removed_at IS NULL", c.ID, c.Body).
+		Updates(map[string]interface{}{"body": body, "edited_at": now})
+	if res.Error != nil {
+		tx.Rollback()
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	since := c.CreatedAt
+	if c.EditedAt != nil {
+		since = *c.EditedAt
+	}
+	if err := tx.Create(&model.CommentRevision{CommentID: c.ID, Body: c.Body, CreatedAt: since}).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+
+	c.Body = body
+	c.EditedAt = &now
+	return true, nil
+}
+
+// ListRevisions returns the former bodies of a comment, newest first.
+func (cs *CommentStore) ListRevisions(commentID uint) ([]model.CommentRevision, error) {
+	var revisions []model.CommentRevision
+	err := cs.db.Where(&model.CommentRevision{CommentID: commentID}).
+		Order("created_at desc, id desc").
+		Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// addComment creates c on the commentable typ and id.
+func addComment(db *gorm.DB, typ string, id uint, c *model.Comment) error {
+	c.CommentableType = typ
+	c.CommentableID = id
+	if err := db.Create(c).Error; err != nil {
+		return err
+	}
+
+	return db.Where(c.ID).Preload("User").First(c).Error
+}
+
+// getComment returns the comment commentID, nil when there is none on the
+// commentable typ and id.
+func getComment(db *gorm.DB, typ string, id uint, commentID uint) (*model.Comment, error) {
+	var m model.Comment
+	err := db.Where("commentable_type = ? AND commentable_id = ?", typ, id).
+		Preload("User").
+		First(&m, commentID).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// deleteComment deletes c, or only clears it when it has replies. A
+// removed parent left without replies is deleted as well. The revisions and
+// likes of deleted and removed comments go with them. c must be on the
+// commentable typ and id.
+func deleteComment(db *gorm.DB, typ string, id uint, c *model.Comment) error {
+	if c.CommentableType != typ || c.CommentableID != id {
+		return comment.ErrNotFound
+	}
+
+	tx := db.Begin()
+	for {
+		var replies int
+		if err := tx.Model(&model.Comment{}).Where("parent_id = ?", c.ID).Count(&replies).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if replies > 0 {
+			if !c.Removed() {
+				now := time.Now()
+				err := tx.Model(&model.Comment{}).
+					Where("id = ?", c.ID).
+					UpdateColumns(map[string]interface{}{"body": "", "removed_at": now, "likes_count": 0}).Error
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+				c.Body = ""
+				c.RemovedAt = &now
+			}
+		} else if err := tx.Delete(c).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Where(&model.CommentRevision{CommentID: c.ID}).Delete(&model.CommentRevision{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Where(&model.CommentLike{CommentID: c.ID}).Delete(&model.CommentLike{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if replies > 0 || c.ParentID == nil {
+			break
+		}
+		var parent model.Comment
+		if err := tx.First(&parent, *c.ParentID).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				break
+			}
+			tx.Rollback()
+			return err
+		}
+		if !parent.Removed() {
+			break
+		}
+		c = &parent
+	}
+	return tx.Commit().Error
+}
+
+// Like counts the like in the same transaction as recording it, so that
+// the count stays right under concurrent likes.
+func (cs *CommentStore) Like(c *model.Comment, userID uint) (bool, error) {
+	tx := cs.db.Begin()
+	res := tx.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").
+		Create(&model.CommentLike{CommentID: c.ID, UserID: userID})
+	if res.Error != nil {
+		tx.Rollback()
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	err := tx.Model(&model.Comment{}).
+		Where("id = ?", c.ID).
+		UpdateColumn("likes_count", gorm.Expr("likes_count + 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	c.LikesCount++
+	return true, nil
+}
+
+func (cs *CommentStore) Unlike(c *model.Comment, userID uint) (bool, error) {
+	tx := cs.db.Begin()
+	res := tx.Where(&model.CommentLike{CommentID: c.ID, UserID: userID}).Delete(&model.CommentLike{})
+	if res.Error != nil {
+		tx.Rollback()
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	err := tx.Model(&model.Comment{}).
+		Where("id = ? AND likes_count > 0", c.ID).
+		UpdateColumn("likes_count", gorm.Expr("likes_count - 1")).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	if c.LikesCount > 0 {
+		c.LikesCount--
+	}
+	return true, nil
+}
+
+func (cs *CommentStore) Liked(userID uint, commentIDs []uint) (map[uint]bool, error) {
+	liked := make(map[uint]bool)
+	if userID == 0 || len(commentIDs) == 0 {
+		return liked, nil
+	}
+	var ids []uint
+	err := cs.db.Model(&model.CommentLike{}).
+		Where("user_id = ? AND comment_id IN (?)", userID, commentIDs).
+		Pluck("comment_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		liked[id] = true
+	}
+	return liked, nil
+}
+
+// listComments returns a page of the threads on the commentable typ and id.
+// Top level comments are paged by q, their replies come along up to
+// comment.MaxReplies per thread.
+func listComments(db *gorm.DB, typ string, id uint, q comment.Query) (*comment.Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = comment.DefaultLimit
+	}
+	if q.Limit > comment.MaxLimit {
+		q.Limit = comment.MaxLimit
+	}
+	if !comment.ValidSort(q.Sort) {
+		q.Sort = comment.SortOldest
+	}
+
+	p := &comment.Page{Cut: make(map[uint]bool)}
+	onContent := db.Model(&model.Comment{}).Where("commentable_type = ? AND commentable_id = ?", typ, id)
+	if err := onContent.Where("removed_at IS NULL").Count(&p.Count).Error; err != nil {
+		return nil, err
+	}
+	if err := onContent.Where("parent_id IS NULL").Count(&p.Threads).Error; err != nil {
+		return nil, err
+	}
+
+	var (
+		roots []model.Comment
+		path  []model.Comment
+		more  bool
+		err   error
+	)
+	switch {
+	case q.Around != 0:
+		if path, err = threadPath(db, typ, id, q.Around); err != nil {
+			return nil, err
+		}
+		root := &path[0]
+		at := comment.NewCursor(root)
+		var before, after []model.Comment
+		var moreBefore, moreAfter bool
+		if before, moreBefore, err = pageRoots(db, typ, id, q.Sort, at, false, (q.Limit-1)/2); err != nil {
+			return nil, err
+		}
+		if after, moreAfter, err = pageRoots(db, typ, id, q.Sort, at, true, q.Limit-1-len(before)); err != nil {
+			return nil, err
+		}
+		roots = append(append(before, *root), after...)
+		if moreBefore {
+			p.Prev = comment.NewCursor(&roots[0])
+		}
+		if moreAfter {
+			p.Next = comment.NewCursor(&roots[len(roots)-1])
+		}
+	case q.Before != nil:
+		if roots, more, err = pageRoots(db, typ, id, q.Sort, q.Before, false, q.Limit); err != nil {
+			return nil, err
+		}
+		if len(roots) > 0 {
+			if more {
+				p.Prev = comment.NewCursor(&roots[0])
+			}
+			p.Next = comment.NewCursor(&roots[len(roots)-1])
+		}
+	default:
+		if roots, more, err = pageRoots(db, typ, id, q.Sort, q.After, true, q.Limit); err != nil {
+			return nil, err
+		}
+		if len(roots) > 0 {
+			if q.After != nil {
+				p.Prev = comment.NewCursor(&roots[0])
+			}
+			if more {
+				p.Next = comment.NewCursor(&roots[len(roots)-1])
+			}
+		}
+	}
+
+	all := roots
+	for _, r := range roots {
+		var keep []model.Comment
+		if len(path) > 0 && r.ID == path[0].ID {
+			keep = path[1:]
+		}
+		replies, cut, err := threadReplies(db, r.ID, keep)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, replies...)
+		if cut {
+			p.Cut[r.ID] = true
+		}
+	}
+	p.Comments = comment.Thread(all)
+	return p, nil
+}
+
+// threadReplies returns up to comment.MaxReplies replies of the thread of
+// the top level comment rootID, level by level and oldest first in a level,
+// so that each comes with its parent. The comments of keep are added when
+// they did not fit. It reports whether replies were left out. One query per
+// level.
+func threadReplies(db *gorm.DB, rootID uint, keep []model.Comment) ([]model.Comment, bool, error) {
+	var (
+		all     []model.Comment
+		cut     bool
+		parents = []uint{rootID}
+		left    = comment.MaxReplies
+	)
+	for len(parents) > 0 {
+		var replies []model.Comment
+		err := db.Where("parent_id IN (?)", parents).
+			Preload("User").
+			Order("id asc").
+			Limit(left + 1).
+			Find(&replies).Error
+		if err != nil {
+			return nil, false, err
+		}
+		if len(replies) > left {
+			replies, cut = replies[:left], true
+		}
+		all = append(all, replies...)
+		left -= len(replies)
+		parents = parents[:0]
+		for _, r := range replies {
+			parents = append(parents, r.ID)
+		}
+		if cut {
+			break
+		}
+	}
+
+	have := make(map[uint]bool, len(all))
+	for _, c := range all {
+		have[c.ID] = true
+	}
+	for _, c := range keep {
+		if !have[c.ID] {
+			all = append(all, c)
+		}
+	}
+	return all, cut, nil
+}
+
+// pageRoots returns up to limit top level comments after the cursor in the
+// sort order, or before it when not forward, in the sort order either way.
+// It reports whether there are more beyond them.
+func pageRoots(db *gorm.DB, typ string, id uint, sort string, from *comment.Cursor, forward bool, limit int) ([]model.Comment, bool, error) {
+	if limit <= 0 {
+		var n int
+		if from != nil {
+			if err := rootsFrom(db, typ, id, sort, from, forward).Limit(1).Count(&n).Error; err != nil {
+				return nil, false, err
+			}
+		}
+		return nil, n > 0, nil
+	}
+
+	order := "id asc"
+	switch {
+	case sort == comment.SortNewest && forward, sort == comment.SortOldest && !forward:
+		order = "id desc"
+	case sort == comment.SortLiked && forward:
+		order = "likes_count desc, id desc"
+	case sort == comment.SortLiked:
+		order = "likes_count asc, id asc"
+	}
+
+	var roots []model.Comment
+	err := rootsFrom(db, typ, id, sort, from, forward).
+		Preload("User").
+		Order(order).
+		Limit(limit + 1).
+		Find(&roots).Error
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(roots) > limit
+	if more {
+		roots = roots[:limit]
+	}
+	if !forward {
+		for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+			roots[i], roots[j] = roots[j], roots[i]
+		}
+	}
+	return roots, more, nil
+}
+
+// rootsFrom selects the top level comments after from in the sort order,
+// or before it when not forward. A nil from selects all.
+func rootsFrom(db *gorm.DB, typ string, id uint, sort string, from *comment.Cursor, forward bool) *gorm.DB {
+	q := db.Model(&model.Comment{}).Where("commentable_type = ? AND commentable_id = ? AND parent_id IS NULL", typ, id)
+	if from == nil {
+		return q
+	}
+	// Newest and most liked run from high to low.
+	up := forward == (sort == comment.SortOldest)
+	if sort == comment.SortLiked {
+		if up {
+			return q.Where("likes_count > ? OR (likes_count = ? AND id > ?)", from.Likes, from.Likes, from.ID)
+		}
+		return q.Where("likes_count < ? OR (likes_count = ? AND id < ?)", from.Likes, from.Likes, from.ID)
+	}
+	if up {
+		return q.Where("id > ?", from.ID)
+	}
+	return q.Where("id < ?", from.ID)
+}
+
+// threadPath returns the comment commentID, which must be on the
+// commentable typ and id, and its ancestors, the top level comment first.
+func threadPath(db *gorm.DB, typ string, id uint, commentID uint) ([]model.Comment, error) {
+	var path []model.Comment
+	for {
+		var c model.Comment
+		if err := db.Preload("User").First(&c, commentID).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return nil, comment.ErrNotFound
+			}
+			return nil, err
+		}
+		if c.CommentableType != typ || c.CommentableID != id {
+			return nil, comment.ErrNotFound
+		}
+		path = append([]model.Comment{c}, path...)
+		if c.ParentID == nil {
+			return path, nil
+		}
+		commentID = *c.ParentID
+	}
+}
+
+// countComments returns how many comments that were not deleted each of the
+// commentables of typ and ids has.
+func countComments(db *gorm.DB, typ string, ids []uint) (map[uint]int, error) {
+	counts := make(map[uint]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	rows, err := db.Model(&model.Comment{}).
+		Select("commentable_id, count(*)").
+		Where("commentable_type = ? AND commentable_id IN (?) AND removed_at IS NULL", typ, ids).
+		Group("commentable_id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
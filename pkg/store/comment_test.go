@@ -0,0 +1,132 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
+	"github.com/xenking/kitsu-media-server/pkg/db"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+// testDB opens an empty database of its own, the handler tests share
+// db.TestDB.
+func testDB(t *testing.T) *gorm.DB {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+		os.RemoveAll(dir)
+	})
+	db.AutoMigrate(d)
+	return d
+}
+
+// newComment stores a comment on article 1 replying to parent, 0 for a
+// top level one.
+func newComment(t *testing.T, d *gorm.DB, parent uint) *model.Comment {
+	c := &model.Comment{CommentableType: model.CommentableArticle, CommentableID: 1, Body: "body"}
+	if parent != 0 {
+		c.ParentID = &parent
+	}
+	if err := d.Create(c).Error; err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func ids(comments []model.Comment) []uint {
+	ids := make([]uint, 0, len(comments))
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestListCommentsCasePages(t *testing.T) {
+	d := testDB(t)
+	for i := 0; i < 5; i++ {
+		newComment(t, d, 0)
+	}
+	list := func(q comment.Query) *comment.Page {
+		p, err := listComments(d, model.CommentableArticle, 1, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	p := list(comment.Query{Limit: 2})
+	assert.Equal(t, []uint{1, 2}, ids(p.Comments))
+	assert.Equal(t, 5, p.Threads)
+	assert.Nil(t, p.Prev)
+	p = list(comment.Query{Limit: 2, After: p.Next})
+	assert.Equal(t, []uint{3, 4}, ids(p.Comments))
+	assert.NotNil(t, p.Prev)
+	p = list(comment.Query{Limit: 2, After: p.Next})
+	assert.Equal(t, []uint{5}, ids(p.Comments))
+	assert.Nil(t, p.Next)
+	p = list(comment.Query{Limit: 2, Before: p.Prev})
+	assert.Equal(t, []uint{3, 4}, ids(p.Comments))
+
+	p = list(comment.Query{Limit: 2, Sort: comment.SortNewest})
+	assert.Equal(t, []uint{5, 4}, ids(p.Comments))
+	p = list(comment.Query{Limit: 2, Sort: comment.SortNewest, After: p.Next})
+	assert.Equal(t, []uint{3, 2}, ids(p.Comments))
+}
+
+func TestListCommentsCaseAround(t *testing.T) {
+	d := testDB(t)
+	var roots []*model.Comment
+	for i := 0; i < 5; i++ {
+		roots = append(roots, newComment(t, d, 0))
+	}
+	reply := newComment(t, d, roots[2].ID)
+	nested := newComment(t, d, reply.ID)
+
+	p, err := listComments(d, model.CommentableArticle, 1, comment.Query{Limit: 3, Around: nested.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{roots[1].ID, roots[2].ID, reply.ID, nested.ID, roots[3].ID}, ids(p.Comments))
+	assert.NotNil(t, p.Prev)
+	assert.NotNil(t, p.Next)
+
+	_, err = listComments(d, model.CommentableArticle, 2, comment.Query{Around: nested.ID})
+	assert.Equal(t, comment.ErrNotFound, err)
+}
+
+func TestListCommentsCaseMaxReplies(t *testing.T) {
+	d := testDB(t)
+	root := newComment(t, d, 0)
+	other := newComment(t, d, 0)
+	first := newComment(t, d, root.ID)
+	for i := 1; i < comment.MaxReplies; i++ {
+		newComment(t, d, root.ID)
+	}
+	// Beyond the cap, a level deeper.
+	late := newComment(t, d, first.ID)
+	newComment(t, d, other.ID)
+
+	p, err := listComments(d, model.CommentableArticle, 1, comment.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, p.Comments, 2+comment.MaxReplies+1)
+	assert.True(t, p.Cut[root.ID])
+	assert.False(t, p.Cut[other.ID])
+	assert.NotContains(t, ids(p.Comments), late.ID)
+
+	// A link to the reply that was left out still shows it.
+	p, err = listComments(d, model.CommentableArticle, 1, comment.Query{Around: late.ID})
+	assert.NoError(t, err)
+	assert.Contains(t, ids(p.Comments), late.ID)
+	assert.True(t, p.Cut[root.ID])
+}
@@ -0,0 +1,393 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type LibraryStore struct {
+	db *gorm.DB
+}
+
+func NewLibraryStore(db *gorm.DB) *LibraryStore {
+	return &LibraryStore{
+		db: db,
+	}
+}
+
+func (ls *LibraryStore) GetFileByID(id uint) (*model.MediaFile, error) {
+	var m model.MediaFile
+	if err := ls.db.Preload("Tracks").First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (ls *LibraryStore) GetFileByPath(path string) (*model.MediaFile, error) {
+	var m model.MediaFile
+	if err := ls.db.Where(&model.MediaFile{Path: path}).Preload("Tracks").First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (ls *LibraryStore) CreateFile(f *model.MediaFile) error {
+	return ls.db.Create(f).Error
+}
+
+// UpdateFile saves f and replaces its stored tracks with f.Tracks.
+func (ls *LibraryStore) UpdateFile(f *model.MediaFile) error {
+	tracks := f.Tracks
+	f.Tracks = nil
+
+	tx := ls.db.Begin()
+	if err := tx.Save(f).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Unscoped().Where(&model.MediaTrack{MediaFileID: f.ID}).Delete(&model.MediaTrack{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range tracks {
+		tracks[i].ID = 0
+		tracks[i].MediaFileID = f.ID
+		if err := tx.Create(&tracks[i]).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	f.Tracks = tracks
+
+	return tx.Commit().Error
+}
+
+func (ls *LibraryStore) DeleteFile(f *model.MediaFile) error {
+	tx := ls.db.Begin()
+	if err := tx.Unscoped().Where(&model.MediaTrack{MediaFileID: f.ID}).Delete(&model.MediaTrack{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Paths are unique, so the row is removed for good.
+	if err := tx.Unscoped().Delete(f).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (ls *LibraryStore) ListFiles(mediaID uint) ([]model.MediaFile, error) {
+	var files []model.MediaFile
+	err := ls.db.Where(&model.MediaFile{MediaID: mediaID}).
+		Where("orphaned_at IS NULL").
+		Preload("Tracks").
+		Order("episode asc, id asc").
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (ls *LibraryStore) ListEpisodeFiles(mediaID uint, episode int) ([]model.MediaFile, error) {
+	var files []model.MediaFile
+	err := ls.db.Where("media_id = ? AND episode = ? AND orphaned_at IS NULL", mediaID, episode).
+		Preload("Tracks").
+		Order("id asc").
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ListFilesUnder returns the files stored anywhere below dir.
+func (ls *LibraryStore) ListFilesUnder(dir string) ([]model.MediaFile, error) {
+	var files []model.MediaFile
+	prefix := likeEscaper.Replace(strings.TrimSuffix(dir, "/")) + "/%"
+	err := ls.db.Where(`path LIKE ? ESCAPE '\'`, prefix).
+		Preload("Tracks").
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListPendingFiles returns files awaiting verification, partially hashed
+// first. Files that failed are left out until they are due for a retry.
+func (ls *LibraryStore) ListPendingFiles(limit int, now time.Time) ([]model.MediaFile, error) {
+	var files []model.MediaFile
+	err := ls.db.Where(&model.MediaFile{CRCState: model.CRCPending}).
+		Where("orphaned_at IS NULL").
+		Where("crc_retry_at IS NULL OR crc_retry_at <= ?", now).
+		Order("crc_offset desc, id asc").
+		Limit(limit).
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (ls *LibraryStore) ListCorruptedFiles(offset, limit int) ([]model.MediaFile, int, error) {
+	var (
+		files []model.MediaFile
+		count int
+	)
+
+	q := ls.db.Model(&model.MediaFile{}).
+		Where(&model.MediaFile{CRCState: model.CRCMismatch}).
+		Where("orphaned_at IS NULL")
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := q.Preload("Media").
+		Offset(offset).
+		Limit(limit).
+		Order("crc_checked_at desc").
+		Find(&files).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return files, count, nil
+}
+
+// SaveChecksum stores the verification state of f without touching its tracks.
+func (ls *LibraryStore) SaveChecksum(f *model.MediaFile) error {
+	return ls.db.Model(f).Updates(map[string]interface{}{
+		"size":           f.Size,
+		"crc_state":      f.CRCState,
+		"crc_expected":   f.CRCExpected,
+		"crc_actual":     f.CRCActual,
+		"crc_offset":     f.CRCOffset,
+		"crc_partial":    f.CRCPartial,
+		"crc_checked_at": f.CRCCheckedAt,
+		"crc_failures":   f.CRCFailures,
+		"crc_retry_at":   f.CRCRetryAt,
+	}).Error
+}
+
+// SaveChecksumRetry stores when verification of f is retried, leaving its
+// progress as it was saved last.
+func (ls *LibraryStore) SaveChecksumRetry(f *model.MediaFile) error {
+	return ls.db.Model(f).Updates(map[string]interface{}{
+		"crc_failures": f.CRCFailures,
+		"crc_retry_at": f.CRCRetryAt,
+	}).Error
+}
+
+func (ls *LibraryStore) GetProgress(userID, mediaID uint) (*model.MediaProgress, error) {
+	var m model.MediaProgress
+	if err := ls.db.Where(&model.MediaProgress{UserID: userID, MediaID: mediaID}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (ls *LibraryStore) SaveProgress(p *model.MediaProgress) error {
+	return ls.db.Save(p).Error
+}
+
+func (ls *LibraryStore) GetPosition(userID, mediaID uint, episode int) (*model.PlaybackPosition, error) {
+	var m model.PlaybackPosition
+	if err := ls.db.Where("user_id = ? AND media_id = ? AND episode = ?", userID, mediaID, episode).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (ls *LibraryStore) SavePosition(p *model.PlaybackPosition) error {
+	return ls.db.Save(p).Error
+}
+
+// ListInProgress returns the episodes the user started but did not finish,
+// most recently played first.
+func (ls *LibraryStore) ListInProgress(userID uint, offset, limit int) ([]model.PlaybackPosition, int, error) {
+	var (
+		positions []model.PlaybackPosition
+		count     int
+	)
+
+	q := ls.db.Model(&model.PlaybackPosition{}).
+		Where("user_id = ? AND watched = ? AND position > 0", userID, false)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := q.Preload("Media").
+		Offset(offset).
+		Limit(limit).
+		Order("reported_at desc").
+		Find(&positions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return positions, count, nil
+}
+
+func (ls *LibraryStore) AddHistory(h *model.WatchHistory) error {
+	return ls.db.Create(h).Error
+}
+
+func (ls *LibraryStore) ListHistory(userID uint, offset, limit int) ([]model.WatchHistory, int, error) {
+	var (
+		history []model.WatchHistory
+		count   int
+	)
+
+	q := ls.db.Model(&model.WatchHistory{}).Where(&model.WatchHistory{UserID: userID})
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := q.Preload("Media").
+		Offset(offset).
+		Limit(limit).
+		Order("watched_at desc").
+		Find(&history).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return history, count, nil
+}
+
+// GetMediaIDByExternalID returns 0 when no media is linked to the ID.
+func (ls *LibraryStore) GetMediaIDByExternalID(provider, id string) (uint, error) {
+	var m model.MediaExternalID
+	if err := ls.db.Where(&model.MediaExternalID{Provider: provider, ExternalID: id}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return m.MediaID, nil
+}
+
+func (ls *LibraryStore) AddExternalID(e *model.MediaExternalID) error {
+	return ls.db.Create(e).Error
+}
+
+func (ls *LibraryStore) GetSegment(id uint) (*model.SkipSegment, error) {
+	var m model.SkipSegment
+	if err := ls.db.Preload("User").Preload("Votes").First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (ls *LibraryStore) GetUserSegment(userID, mediaID uint, episode int, kind string) (*model.SkipSegment, error) {
+	var m model.SkipSegment
+	err := ls.db.Where("user_id = ? AND media_id = ? AND episode = ? AND kind = ?", userID, mediaID, episode, kind).
+		First(&m).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (ls *LibraryStore) SaveSegment(s *model.SkipSegment) error {
+	return ls.db.Save(s).Error
+}
+
+// ReplaceSegment saves s over the submission of its ID and drops the votes
+// cast on that one.
+func (ls *LibraryStore) ReplaceSegment(s *model.SkipSegment) error {
+	tx := ls.db.Begin()
+	if err := tx.Where("skip_segment_id = ?", s.ID).Delete(&model.SkipVote{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Save(s).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (ls *LibraryStore) ListSegments(mediaID uint, episode int) ([]model.SkipSegment, error) {
+	var segments []model.SkipSegment
+	err := ls.db.Where("media_id = ? AND episode = ?", mediaID, episode).
+		Preload("User").
+		Preload("Votes").
+		Order("kind asc, start asc").
+		Find(&segments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// SaveVote creates the vote of a user or replaces their previous one.
+func (ls *LibraryStore) SaveVote(v *model.SkipVote) error {
+	return ls.db.Save(v).Error
+}
+
+// ListReputations returns the sum of the votes other users gave to the
+// segments of each user.
+func (ls *LibraryStore) ListReputations(userIDs []uint) (map[uint]int, error) {
+	reputations := make(map[uint]int, len(userIDs))
+	if len(userIDs) == 0 {
+		return reputations, nil
+	}
+
+	rows, err := ls.db.Table("skip_votes").
+		Select("skip_segments.user_id, SUM(skip_votes.value)").
+		Joins("JOIN skip_segments ON skip_segments.id = skip_votes.skip_segment_id").
+		Where("skip_segments.user_id IN (?) AND skip_segments.deleted_at IS NULL", userIDs).
+		Group("skip_segments.user_id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			userID uint
+			sum    int
+		)
+		if err := rows.Scan(&userID, &sum); err != nil {
+			return nil, err
+		}
+		reputations[userID] = sum
+	}
+
+	return reputations, rows.Err()
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"github.com/jinzhu/gorm"
+	"github.com/xenking/kitsu-media-server/pkg/comment"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 )
 
@@ -27,7 +28,13 @@ func (as *MediaStore) GetBySlug(s string) (*model.Media, error) {
 		return nil, err
 	}
 
-	return &m, err
+	counts, err := countComments(as.db, model.CommentableMedia, []uint{m.ID})
+	if err != nil {
+		return nil, err
+	}
+	m.CommentsCount = counts[m.ID]
+
+	return &m, nil
 }
 
 func (as *MediaStore) GetUserMediaBySlug(userID uint, slug string) (*model.Media, error) {
@@ -129,6 +136,9 @@ func (as *MediaStore) List(offset, limit int) ([]model.Media, int, error) {
 		Limit(limit).
 		Order("created_at desc").Find(&articles)
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -156,6 +166,9 @@ func (as *MediaStore) ListByTag(tag string, offset, limit int) ([]model.Media, i
 
 	count = as.db.Model(&t).Association("Medias").Count()
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -181,6 +194,9 @@ func (as *MediaStore) ListByAuthor(username string, offset, limit int) ([]model.
 		Find(&articles)
 	as.db.Where(&model.Media{Content: model.Content{AuthorID: u.ID}}).Model(&model.Media{}).Count(&count)
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -208,6 +224,9 @@ func (as *MediaStore) ListByWhoFavorited(username string, offset, limit int) ([]
 
 	count = as.db.Model(&u).Association("MediaFavorites").Count()
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
@@ -246,21 +265,21 @@ func (as *MediaStore) ListFeed(userID uint, offset, limit int) ([]model.Media, i
 		Find(&articles)
 	as.db.Where(&model.Media{Content: model.Content{AuthorID: u.ID}}).Model(&model.Media{}).Count(&count)
 
+	if err := as.withCommentsCount(articles); err != nil {
+		return nil, 0, err
+	}
 	return articles, count, nil
 }
 
 func (as *MediaStore) AddComment(a *model.Media, c *model.Comment) error {
-	err := as.db.Model(a).Association("Comments").Append(c).Error
-	if err != nil {
-		return err
-	}
-
-	return as.db.Where(c.ID).Preload("User").First(c).Error
+	return addComment(as.db, model.CommentableMedia, a.ID, c)
 }
 
-func (as *MediaStore) GetCommentsBySlug(slug string) ([]model.Comment, error) {
+// GetCommentsBySlug returns a page of the comment threads of the media,
+// nil when there is no such media.
+func (as *MediaStore) GetCommentsBySlug(slug string, q comment.Query) (*comment.Page, error) {
 	var m model.Media
-	err := as.db.Where(&model.Media{Content: model.Content{Slug: slug}}).Preload("Comments").Preload("Comments.User").First(&m).Error
+	err := as.db.Where(&model.Media{Content: model.Content{Slug: slug}}).First(&m).Error
 
 	if err != nil {
 		if gorm.IsRecordNotFoundError(err) {
@@ -270,24 +289,17 @@ func (as *MediaStore) GetCommentsBySlug(slug string) ([]model.Comment, error) {
 		return nil, err
 	}
 
-	return m.Comments, nil
+	return listComments(as.db, model.CommentableMedia, m.ID, q)
 }
 
-func (as *MediaStore) GetCommentByID(id uint) (*model.Comment, error) {
-	var m model.Comment
-	if err := as.db.Where(id).First(&m).Error; err != nil {
-		if gorm.IsRecordNotFoundError(err) {
-			return nil, nil
-		}
-
-		return nil, err
-	}
-
-	return &m, nil
+// GetComment returns the comment id, nil when it is not on the media.
+func (as *MediaStore) GetComment(a *model.Media, id uint) (*model.Comment, error) {
+	return getComment(as.db, model.CommentableMedia, a.ID, id)
 }
 
-func (as *MediaStore) DeleteComment(c *model.Comment) error {
-	return as.db.Delete(c).Error
+// DeleteComment deletes c, which must be on the media.
+func (as *MediaStore) DeleteComment(a *model.Media, c *model.Comment) error {
+	return deleteComment(as.db, model.CommentableMedia, a.ID, c)
 }
 
 func (as *MediaStore) AddFavorite(a *model.Media, userID uint) error {
@@ -312,3 +324,19 @@ func (as *MediaStore) ListTags() ([]model.Tag, error) {
 
 	return tags, nil
 }
+
+// withCommentsCount sets the comments count of each of medias.
+func (as *MediaStore) withCommentsCount(medias []model.Media) error {
+	ids := make([]uint, len(medias))
+	for i := range medias {
+		ids[i] = medias[i].ID
+	}
+	counts, err := countComments(as.db, model.CommentableMedia, ids)
+	if err != nil {
+		return err
+	}
+	for i := range medias {
+		medias[i].CommentsCount = counts[medias[i].ID]
+	}
+	return nil
+}
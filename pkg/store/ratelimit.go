@@ -0,0 +1,76 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/ratelimit"
+)
+
+// takeAttempts bounds the retries of a take racing with other instances.
+const takeAttempts = 5
+
+var errRateLimitContention = errors.New("ratelimit: too much contention on a bucket")
+
+// RateLimitStore keeps the buckets in the database, so that several
+// instances count together.
+type RateLimitStore struct {
+	db *gorm.DB
+}
+
+func NewRateLimitStore(db *gorm.DB) *RateLimitStore {
+	return &RateLimitStore{
+		db: db,
+	}
+}
+
+// Take updates the bucket optimistically: the write only goes through if
+// nobody took from the bucket since it was read, else it starts over.
+func (rs *RateLimitStore) Take(key string, rule ratelimit.Rule, now time.Time) (ratelimit.Result, error) {
+	for i := 0; i < takeAttempts; i++ {
+		var m model.RateLimitBucket
+		err := rs.db.Where(&model.RateLimitBucket{Key: key}).First(&m).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return ratelimit.Result{}, err
+		}
+		found := err == nil
+
+		b := ratelimit.Bucket{}
+		if found {
+			b.Tokens = m.Tokens
+			b.Stamp = time.Unix(0, m.Stamp)
+		}
+		res := rule.Take(&b, now)
+		next := model.RateLimitBucket{
+			Key:    key,
+			Tokens: b.Tokens,
+			Stamp:  b.Stamp.UnixNano(),
+			FullAt: rule.FullAt(&b).UnixNano(),
+		}
+
+		if !found {
+			// Another instance creating the bucket first fails the insert.
+			if err := rs.db.Create(&next).Error; err != nil {
+				continue
+			}
+			return res, nil
+		}
+
+		upd := rs.db.Model(&model.RateLimitBucket{}).
+			Where(&model.RateLimitBucket{Key: key, Stamp: m.Stamp}).
+			UpdateColumns(map[string]interface{}{"tokens": next.Tokens, "stamp": next.Stamp, "full_at": next.FullAt})
+		if upd.Error != nil {
+			return ratelimit.Result{}, upd.Error
+		}
+		if upd.RowsAffected == 1 {
+			return res, nil
+		}
+	}
+	return ratelimit.Result{}, errRateLimitContention
+}
+
+func (rs *RateLimitStore) Sweep(now time.Time) error {
+	return rs.db.Where("full_at <= ?", now.UnixNano()).Delete(&model.RateLimitBucket{}).Error
+}
@@ -1,10 +1,16 @@
 package store
 
 import (
+	"errors"
+	"time"
+
 	"github.com/jinzhu/gorm"
+	"github.com/xenking/kitsu-media-server/pkg/lockout"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 )
 
+var errLoginContention = errors.New("lockout: too much contention on a key")
+
 type UserStore struct {
 	db *gorm.DB
 }
@@ -17,7 +23,7 @@ func NewUserStore(db *gorm.DB) *UserStore {
 
 func (us *UserStore) GetByID(id uint) (*model.User, error) {
 	var m model.User
-	if err := us.db.First(&m, id).Error; err != nil {
+	if err := us.db.Preload("Roles").First(&m, id).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return nil, nil
 		}
@@ -28,7 +34,7 @@ func (us *UserStore) GetByID(id uint) (*model.User, error) {
 
 func (us *UserStore) GetByEmail(e string) (*model.User, error) {
 	var m model.User
-	if err := us.db.Where(&model.User{Email: e}).First(&m).Error; err != nil {
+	if err := us.db.Where(&model.User{Email: e}).Preload("Roles").First(&m).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return nil, nil
 		}
@@ -48,6 +54,18 @@ func (us *UserStore) GetByUsername(username string) (*model.User, error) {
 	return &m, nil
 }
 
+// GetByScrobbleToken finds a user by the hash of their scrobble token.
+func (us *UserStore) GetByScrobbleToken(hash string) (*model.User, error) {
+	var m model.User
+	if err := us.db.Where("scrobble_token = ?", hash).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
 func (us *UserStore) List(offset, limit int) ([]model.User, int, error) {
 	var (
 		users []model.User
@@ -70,6 +88,14 @@ func (us *UserStore) Update(u *model.User) error {
 	return us.db.Model(u).Update(u).Error
 }
 
+// SetEmailVerified sets or, with a nil at, clears when the email address of
+// the user was verified.
+func (us *UserStore) SetEmailVerified(userID uint, at *time.Time) error {
+	return us.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("email_verified_at", at).Error
+}
+
 func (us *UserStore) Delete(u *model.User) error {
 	return us.db.Model(u).Delete(u).Error
 }
@@ -102,3 +128,547 @@ func (us *UserStore) IsFollower(userID, followerID uint) (bool, error) {
 	}
 	return true, nil
 }
+
+func (us *UserStore) ListRoles(userID uint) ([]string, error) {
+	var roles []string
+	err := us.db.Model(&model.UserRole{}).
+		Where(&model.UserRole{UserID: userID}).
+		Order("role asc").
+		Pluck("role", &roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (us *UserStore) AddRole(userID uint, role string) error {
+	return us.db.Save(&model.UserRole{UserID: userID, Role: role}).Error
+}
+
+func (us *UserStore) RemoveRole(userID uint, role string) error {
+	return us.db.Where(&model.UserRole{UserID: userID, Role: role}).Delete(&model.UserRole{}).Error
+}
+
+func (us *UserStore) ListRoleSettings() ([]model.RoleSetting, error) {
+	var settings []model.RoleSetting
+	if err := us.db.Order("role asc").Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (us *UserStore) SaveRoleSetting(s *model.RoleSetting) error {
+	return us.db.Save(s).Error
+}
+
+// SetTOTP stores the TOTP secret of a user, nil to remove it, and resets
+// the last used step.
+func (us *UserStore) SetTOTP(userID uint, secret *string, enabledAt *time.Time) error {
+	return us.db.Model(&model.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{
+			"totp_secret":     secret,
+			"totp_enabled_at": enabledAt,
+			"totp_last_step":  0,
+		}).Error
+}
+
+// UseTOTPStep records a code of step as used. It returns false when a code
+// of that or a later step was used already, also by a concurrent request.
+func (us *UserStore) UseTOTPStep(userID uint, step int64) (bool, error) {
+	res := us.db.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		UpdateColumn("totp_last_step", step)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// ReplaceRecoveryCodes drops the recovery codes of a user for new ones.
+func (us *UserStore) ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	tx := us.db.Begin()
+	if err := tx.Unscoped().Where(&model.RecoveryCode{UserID: userID}).Delete(&model.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, h := range hashes {
+		if err := tx.Create(&model.RecoveryCode{UserID: userID, Hash: h}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used, and
+// returns false when there is none with that hash.
+func (us *UserStore) UseRecoveryCode(userID uint, hash string) (bool, error) {
+	res := us.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userID, hash).
+		UpdateColumn("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (us *UserStore) CreateWebAuthnCredential(c *model.WebAuthnCredential) error {
+	return us.db.Create(c).Error
+}
+
+func (us *UserStore) GetWebAuthnCredential(id uint) (*model.WebAuthnCredential, error) {
+	var m model.WebAuthnCredential
+	if err := us.db.First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (us *UserStore) GetWebAuthnCredentialByCredentialID(credentialID string) (*model.WebAuthnCredential, error) {
+	var m model.WebAuthnCredential
+	if err := us.db.Where(&model.WebAuthnCredential{CredentialID: credentialID}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (us *UserStore) ListWebAuthnCredentials(userID uint) ([]model.WebAuthnCredential, error) {
+	var credentials []model.WebAuthnCredential
+	err := us.db.Where(&model.WebAuthnCredential{UserID: userID}).
+		Order("created_at asc").
+		Find(&credentials).Error
+	if err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (us *UserStore) UpdateWebAuthnCredential(c *model.WebAuthnCredential) error {
+	return us.db.Model(c).Update(c).Error
+}
+
+// UseWebAuthnCredential stores the sign count of a login. It returns false
+// when another login changed the count meanwhile.
+func (us *UserStore) UseWebAuthnCredential(c *model.WebAuthnCredential, signCount uint32) (bool, error) {
+	now := time.Now()
+	res := us.db.Model(&model.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", c.ID, c.SignCount).
+		UpdateColumns(map[string]interface{}{"sign_count": signCount, "last_used_at": now})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	c.SignCount = signCount
+	c.LastUsedAt = &now
+	return true, nil
+}
+
+func (us *UserStore) DeleteWebAuthnCredential(c *model.WebAuthnCredential) error {
+	return us.db.Unscoped().Delete(c).Error
+}
+
+// SaveWebAuthnChallenge stores a challenge and forgets the expired ones.
+func (us *UserStore) SaveWebAuthnChallenge(c *model.WebAuthnChallenge) error {
+	if err := us.db.Where("expires_at < ?", time.Now()).Delete(&model.WebAuthnChallenge{}).Error; err != nil {
+		return err
+	}
+	return us.db.Create(c).Error
+}
+
+// TakeWebAuthnChallenge returns the challenge and deletes it, so that it
+// serves one ceremony only. Unknown and expired challenges return nil.
+func (us *UserStore) TakeWebAuthnChallenge(hash string) (*model.WebAuthnChallenge, error) {
+	var m model.WebAuthnChallenge
+	if err := us.db.Where(&model.WebAuthnChallenge{Hash: hash}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := us.db.Where(&model.WebAuthnChallenge{Hash: hash}).Delete(&model.WebAuthnChallenge{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 || time.Now().After(m.ExpiresAt) {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+func (us *UserStore) CreateSession(s *model.Session) error {
+	return us.db.Create(s).Error
+}
+
+func (us *UserStore) GetSession(id uint) (*model.Session, error) {
+	var m model.Session
+	if err := us.db.First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListSessions returns the sessions of a user that were not revoked, the
+// most recently used first.
+func (us *UserStore) ListSessions(userID uint) ([]model.Session, error) {
+	var sessions []model.Session
+	err := us.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// TouchSessions sets the last seen time of each session in one transaction.
+func (us *UserStore) TouchSessions(seen map[uint]time.Time) error {
+	tx := us.db.Begin()
+	for id, at := range seen {
+		err := tx.Model(&model.Session{}).
+			Where("id = ? AND last_seen_at < ?", id, at).
+			UpdateColumn("last_seen_at", at).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+func (us *UserStore) RevokeSession(id uint) error {
+	return us.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (us *UserStore) RevokeUserSessions(userID uint) error {
+	return us.db.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (us *UserStore) CreateRefreshToken(t *model.RefreshToken) error {
+	return us.db.Create(t).Error
+}
+
+func (us *UserStore) GetRefreshToken(hash string) (*model.RefreshToken, error) {
+	var m model.RefreshToken
+	if err := us.db.Where(&model.RefreshToken{Hash: hash}).Preload("Session").First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UseRefreshToken marks t as used. It returns false when the token was used
+// already, also by a concurrent request.
+func (us *UserStore) UseRefreshToken(t *model.RefreshToken) (bool, error) {
+	now := time.Now()
+	res := us.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", t.ID).
+		Update("used_at", now)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	t.UsedAt = &now
+	return true, nil
+}
+
+// RevokeToken records a revoked access token until it would expire anyway,
+// and forgets the ones past that.
+func (us *UserStore) RevokeToken(jti string, expires time.Time) error {
+	if err := us.db.Where("expires_at < ?", time.Now()).Delete(&model.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return us.db.Save(&model.RevokedToken{JTI: jti, ExpiresAt: expires}).Error
+}
+
+// IsTokenRevoked reports whether the access token jti or its session was
+// revoked. Tokens of unknown sessions count as revoked. It runs on every
+// authenticated request, so both are checked in one query.
+func (us *UserStore) IsTokenRevoked(sessionID uint, jti string) (bool, error) {
+	var count int
+	err := us.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Where("NOT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+func (us *UserStore) CreateAccessToken(t *model.AccessToken) error {
+	return us.db.Create(t).Error
+}
+
+func (us *UserStore) GetAccessToken(id uint) (*model.AccessToken, error) {
+	var m model.AccessToken
+	if err := us.db.First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (us *UserStore) GetAccessTokenByHash(hash string) (*model.AccessToken, error) {
+	var m model.AccessToken
+	if err := us.db.Where(&model.AccessToken{Hash: hash}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (us *UserStore) ListAccessTokens(userID uint) ([]model.AccessToken, error) {
+	var tokens []model.AccessToken
+	err := us.db.Where(&model.AccessToken{UserID: userID}).
+		Order("created_at desc").
+		Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// TouchAccessTokens sets the last used time of each token in one
+// transaction.
+func (us *UserStore) TouchAccessTokens(used map[uint]time.Time) error {
+	tx := us.db.Begin()
+	for id, at := range used {
+		err := tx.Model(&model.AccessToken{}).
+			Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at).
+			UpdateColumn("last_used_at", at).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+func (us *UserStore) DeleteAccessToken(t *model.AccessToken) error {
+	return us.db.Unscoped().Delete(t).Error
+}
+
+func (us *UserStore) GetLoginThrottle(key string) (*model.LoginThrottle, error) {
+	var m model.LoginThrottle
+	if err := us.db.Where(&model.LoginThrottle{Key: key}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// FailLogin counts a failed login for key under p and reports whether it
+// locked the key. Like RateLimitStore.Take it writes only if nobody counted
+// a failure since the read, else it starts over, so that concurrent logins
+// cannot overwrite each other's failures.
+func (us *UserStore) FailLogin(key string, userID uint, p lockout.Policy, now time.Time) (*model.LoginThrottle, bool, error) {
+	for i := 0; i < takeAttempts; i++ {
+		t, err := us.GetLoginThrottle(key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if t == nil {
+			t = &model.LoginThrottle{Key: key, UserID: userID}
+			locked := p.Fail(&t.State, now)
+			// A concurrent first failure fails the insert.
+			if err := us.db.Create(t).Error; err != nil {
+				continue
+			}
+			return t, locked, nil
+		}
+
+		failures := t.Failures
+		locked := p.Fail(&t.State, now)
+		upd := us.db.Model(&model.LoginThrottle{}).
+			Where(map[string]interface{}{"key": key, "failures": failures}).
+			UpdateColumns(map[string]interface{}{
+				"failures":        t.Failures,
+				"last_failure_at": t.LastFailureAt,
+				"locked_until":    t.LockedUntil,
+			})
+		if upd.Error != nil {
+			return nil, false, upd.Error
+		}
+		if upd.RowsAffected == 1 {
+			return t, locked, nil
+		}
+	}
+	return nil, false, errLoginContention
+}
+
+// DeleteLoginThrottle forgets the failures of key. It returns false when
+// there were none.
+func (us *UserStore) DeleteLoginThrottle(key string) (bool, error) {
+	res := us.db.Where(&model.LoginThrottle{Key: key}).Delete(&model.LoginThrottle{})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// ListLoginLocks returns the keys locked at now, those locked longest
+// first.
+func (us *UserStore) ListLoginLocks(now time.Time) ([]model.LoginThrottle, error) {
+	var locks []model.LoginThrottle
+	err := us.db.Where("locked_until > ?", now).
+		Order("locked_until desc").
+		Find(&locks).Error
+	if err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+func (us *UserStore) CreateInvite(i *model.Invite) error {
+	return us.db.Create(i).Error
+}
+
+func (us *UserStore) GetInvite(id uint) (*model.Invite, error) {
+	var m model.Invite
+	if err := us.db.First(&m, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListInvites returns the invites of the creator, or all of them for 0,
+// newest first with their creator and invitees.
+func (us *UserStore) ListInvites(creatorID uint) ([]model.Invite, error) {
+	var invites []model.Invite
+	err := us.db.Where(&model.Invite{CreatorID: creatorID}).
+		Preload("Creator").
+		Preload("Invitees").
+		Order("created_at desc").
+		Find(&invites).Error
+	if err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// UseInvite counts a registration with the invite of hash. It returns nil
+// when there is no such invite or it cannot be used anymore.
+func (us *UserStore) UseInvite(hash string, now time.Time) (*model.Invite, error) {
+	res := us.db.Model(&model.Invite{}).
+		Where("hash = ? AND revoked_at IS NULL AND uses < max_uses AND (expires_at IS NULL OR expires_at > ?)", hash, now).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+	var m model.Invite
+	if err := us.db.Where(&model.Invite{Hash: hash}).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ReleaseInvite gives back a use of the invite when the registration failed.
+func (us *UserStore) ReleaseInvite(id uint) error {
+	return us.db.Model(&model.Invite{}).
+		Where("id = ? AND uses > 0", id).
+		UpdateColumn("uses", gorm.Expr("uses - 1")).Error
+}
+
+func (us *UserStore) RevokeInvite(id uint) error {
+	return us.db.Model(&model.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (us *UserStore) GetOIDCIdentity(provider, subject string) (*model.OIDCIdentity, error) {
+	var m model.OIDCIdentity
+	if err := us.db.Where(&model.OIDCIdentity{Provider: provider, Subject: subject}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (us *UserStore) CreateOIDCIdentity(i *model.OIDCIdentity) error {
+	return us.db.Create(i).Error
+}
+
+func (us *UserStore) ListOIDCIdentities(userID uint) ([]model.OIDCIdentity, error) {
+	var identities []model.OIDCIdentity
+	err := us.db.Where(&model.OIDCIdentity{UserID: userID}).
+		Order("provider asc").
+		Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (us *UserStore) TouchOIDCIdentity(id uint, at time.Time) error {
+	return us.db.Model(&model.OIDCIdentity{}).
+		Where("id = ?", id).
+		UpdateColumn("last_used_at", at).Error
+}
+
+func (us *UserStore) DeleteOIDCIdentity(i *model.OIDCIdentity) error {
+	return us.db.Unscoped().Delete(i).Error
+}
+
+// SaveOIDCState stores a pending login and forgets the expired ones.
+func (us *UserStore) SaveOIDCState(s *model.OIDCState) error {
+	if err := us.db.Where("expires_at < ?", time.Now()).Delete(&model.OIDCState{}).Error; err != nil {
+		return err
+	}
+	return us.db.Create(s).Error
+}
+
+// TakeOIDCState returns the pending login and deletes it, so that its code
+// is exchanged once only. Unknown and expired states return nil.
+func (us *UserStore) TakeOIDCState(hash string) (*model.OIDCState, error) {
+	var m model.OIDCState
+	if err := us.db.Where(&model.OIDCState{Hash: hash}).First(&m).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := us.db.Where(&model.OIDCState{Hash: hash}).Delete(&model.OIDCState{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 || time.Now().After(m.ExpiresAt) {
+		return nil, nil
+	}
+	return &m, nil
+}
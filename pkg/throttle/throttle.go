@@ -0,0 +1,236 @@
+// Package throttle limits the bandwidth and the number of concurrent streams
+// of the file serving routes.
+package throttle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var ErrTooManyStreams = errors.New("too many concurrent streams")
+
+// chunkSize is the most written at once, so that waiting for the buckets
+// stays smooth.
+const chunkSize = 32 << 10
+
+// Limits are in bytes per second, 0 meaning unlimited.
+type Limits struct {
+	Rate     int64
+	UserRate int64
+	// RoleRates override UserRate for users with the role. When a user has
+	// several of them the most generous applies.
+	RoleRates  map[string]int64
+	MaxStreams int
+}
+
+type Limiter struct {
+	limits Limits
+	roles  func(userID uint) []string
+	global *rate.Limiter
+
+	mu    sync.Mutex
+	users map[uint]*user
+}
+
+// user is kept while the user has open streams, so that parallel range
+// requests share one bucket.
+type user struct {
+	limiter *rate.Limiter
+	rate    int64
+	// files counts the open requests per file. Players open a new range
+	// request when seeking before the old one is closed, so requests for the
+	// same file count as one stream.
+	files map[uint]int
+	sent  int64
+	since time.Time
+}
+
+// Usage is the current streaming of a user.
+type Usage struct {
+	UserID uint
+	Files  []uint
+	Sent   int64
+	Since  time.Time
+	Rate   int64
+}
+
+func New(l Limits) *Limiter {
+	return &Limiter{
+		limits: l,
+		global: newLimiter(l.Rate),
+		users:  make(map[uint]*user),
+	}
+}
+
+// SetRoles sets the function that looks up the roles of a user for the role
+// rates. Without it only the user rate applies.
+func (l *Limiter) SetRoles(fn func(userID uint) []string) {
+	l.roles = fn
+}
+
+// Stream is an open request for a file.
+type Stream struct {
+	l      *Limiter
+	u      *user
+	userID uint
+	fileID uint
+}
+
+// Acquire opens a stream of the file for the user, or returns
+// ErrTooManyStreams when they already play as many other files as allowed.
+func (l *Limiter) Acquire(userID, fileID uint) (*Stream, error) {
+	// Looking up the roles may query the database, which must not hold up
+	// the lock every stream shares.
+	return l.acquire(userID, fileID, l.userRate(userID))
+}
+
+// acquire is Acquire with the rate of the user worked out. It only applies
+// when the user has no open streams yet.
+func (l *Limiter) acquire(userID, fileID uint, r int64) (*Stream, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u, ok := l.users[userID]
+	if !ok {
+		u = &user{
+			limiter: newLimiter(r),
+			rate:    r,
+			files:   make(map[uint]int),
+			since:   time.Now(),
+		}
+		l.users[userID] = u
+	}
+	if _, playing := u.files[fileID]; !playing && l.limits.MaxStreams > 0 && len(u.files) >= l.limits.MaxStreams {
+		return nil, ErrTooManyStreams
+	}
+	u.files[fileID]++
+	return &Stream{l: l, u: u, userID: userID, fileID: fileID}, nil
+}
+
+func (l *Limiter) userRate(userID uint) int64 {
+	if l.roles == nil {
+		return l.limits.UserRate
+	}
+	matched := false
+	var best int64
+	for _, role := range l.roles(userID) {
+		r, ok := l.limits.RoleRates[role]
+		if !ok {
+			continue
+		}
+		if !matched || r == 0 || (best != 0 && r > best) {
+			best = r
+		}
+		matched = true
+	}
+	if !matched {
+		return l.limits.UserRate
+	}
+	return best
+}
+
+// Release closes the stream.
+func (s *Stream) Release() {
+	s.l.mu.Lock()
+	defer s.l.mu.Unlock()
+
+	s.u.files[s.fileID]--
+	if s.u.files[s.fileID] == 0 {
+		delete(s.u.files, s.fileID)
+	}
+	if len(s.u.files) == 0 {
+		delete(s.l.users, s.userID)
+	}
+}
+
+// ResponseWriter returns w with writes limited by the buckets of the stream.
+// It only limits the bytes actually sent, so partial content responses to
+// range requests are served normally.
+func (s *Stream) ResponseWriter(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	return &responseWriter{ResponseWriter: w, ctx: ctx, s: s}
+}
+
+func (s *Stream) wait(ctx context.Context, n int) error {
+	if s.u.limiter != nil {
+		if err := s.u.limiter.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	if s.l.global != nil {
+		if err := s.l.global.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+	s   *Stream
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		if err := w.s.wait(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		atomic.AddInt64(&w.s.u.sent, int64(n))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Usage lists the users with open streams.
+func (l *Limiter) Usage() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	usage := make([]Usage, 0, len(l.users))
+	for id, u := range l.users {
+		files := make([]uint, 0, len(u.files))
+		for f := range u.files {
+			files = append(files, f)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i] < files[j] })
+		usage = append(usage, Usage{
+			UserID: id,
+			Files:  files,
+			Sent:   atomic.LoadInt64(&u.sent),
+			Since:  u.since,
+			Rate:   u.rate,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].UserID < usage[j].UserID })
+	return usage
+}
+
+// newLimiter returns a bucket holding a second worth of bytes, or nil for
+// an unlimited rate.
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := int(bytesPerSecond)
+	if burst < chunkSize {
+		burst = chunkSize
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
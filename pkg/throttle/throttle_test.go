@@ -0,0 +1,104 @@
+package throttle
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentStreams(t *testing.T) {
+	l := New(Limits{MaxStreams: 1})
+
+	a, err := l.Acquire(1, 10)
+	assert.NoError(t, err)
+	// Seeking opens another range request for the same file.
+	b, err := l.Acquire(1, 10)
+	assert.NoError(t, err)
+	_, err = l.Acquire(1, 11)
+	assert.Equal(t, ErrTooManyStreams, err)
+	_, err = l.Acquire(2, 11)
+	assert.NoError(t, err, "other users have their own streams")
+
+	a.Release()
+	_, err = l.Acquire(1, 11)
+	assert.Equal(t, ErrTooManyStreams, err)
+	b.Release()
+	_, err = l.Acquire(1, 11)
+	assert.NoError(t, err)
+}
+
+func TestRoleRates(t *testing.T) {
+	l := New(Limits{UserRate: 100, RoleRates: map[string]int64{"editor": 500, "admin": 0, "guest": 50}})
+	assert.Equal(t, int64(100), l.userRate(1))
+
+	roles := map[uint][]string{2: {"editor"}, 3: {"editor", "admin"}, 4: {"member"}, 5: {"guest", "member"}}
+	l.SetRoles(func(id uint) []string { return roles[id] })
+	assert.Equal(t, int64(500), l.userRate(2))
+	assert.Equal(t, int64(0), l.userRate(3), "admins are unlimited")
+	assert.Equal(t, int64(100), l.userRate(4))
+	assert.Equal(t, int64(50), l.userRate(5), "roles may also be slower than the default")
+}
+
+func TestResponseWriterThrottles(t *testing.T) {
+	l := New(Limits{UserRate: chunkSize * 4})
+	s, err := l.Acquire(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Release()
+
+	rec := httptest.NewRecorder()
+	w := s.ResponseWriter(context.Background(), rec)
+	start := time.Now()
+	// The first second worth of bytes is the burst, the rest is paced.
+	n, err := w.Write(make([]byte, chunkSize*6))
+	assert.NoError(t, err)
+	assert.Equal(t, chunkSize*6, n)
+	assert.True(t, time.Since(start) >= 400*time.Millisecond, time.Since(start).String())
+
+	usage := l.Usage()
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, int64(chunkSize*6), usage[0].Sent)
+		assert.Equal(t, []uint{10}, usage[0].Files)
+	}
+}
+
+func TestSlowRolesDoNotBlock(t *testing.T) {
+	l := New(Limits{RoleRates: map[string]int64{"editor": 500}})
+	looking, slow := make(chan struct{}), make(chan struct{})
+	l.SetRoles(func(id uint) []string {
+		if id == 2 {
+			close(looking)
+			<-slow
+		}
+		return nil
+	})
+
+	acquired := make(chan struct{})
+	go func() {
+		s, err := l.Acquire(2, 20)
+		assert.NoError(t, err)
+		s.Release()
+		close(acquired)
+	}()
+	<-looking
+
+	done := make(chan struct{})
+	go func() {
+		s, err := l.Acquire(1, 10)
+		assert.NoError(t, err)
+		l.Usage()
+		s.Release()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a slow role lookup blocked other streams")
+	}
+	close(slow)
+	<-acquired
+}
@@ -0,0 +1,58 @@
+package twofactor
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	secret, err := NewSecret()
+	assert.NoError(t, err)
+
+	now := time.Unix(1600000000, 0)
+	code, err := totp.GenerateCodeCustom(secret, now, opts)
+	assert.NoError(t, err)
+
+	step, ok := Check(secret, code, 0, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/period, step)
+
+	_, ok = Check(secret, code, step, now)
+	assert.False(t, ok, "a code works once")
+
+	_, ok = Check(secret, code, 0, now.Add(period*time.Second))
+	assert.True(t, ok, "clocks may be a period off")
+	_, ok = Check(secret, code, 0, now.Add(3*period*time.Second))
+	assert.False(t, ok)
+
+	_, ok = Check(secret, "000000", 0, now)
+	assert.False(t, ok)
+}
+
+func TestURIAndQR(t *testing.T) {
+	uri := URI("JBSWY3DPEHPK3PXP", "ann@example.com")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/kitsu.media:ann@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+
+	b, err := QR(uri, 200)
+	assert.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, img.Bounds().Dx())
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(RecoveryCodeCount)
+	assert.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Len(t, codes[0], 11)
+	assert.NotEqual(t, codes[0], codes[1])
+
+	assert.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(" "+strings.ToUpper(strings.Replace(codes[0], "-", "", 1))))
+}
@@ -0,0 +1,123 @@
+package user
+
+import "sort"
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleEditor    = "editor"
+	// RoleMember is held by every user and never stored.
+	RoleMember = "member"
+)
+
+const (
+	PermUsersRead      = "users:read"
+	PermUsersDelete    = "users:delete"
+	PermRolesManage    = "roles:manage"
+	PermMediaEdit      = "media:edit"
+	PermMediaDelete    = "media:delete"
+	PermCommentsDelete = "comments:delete"
+	PermLibraryManage  = "library:manage"
+	PermUsersUnlock    = "users:unlock"
+	PermInvitesManage  = "invites:manage"
+)
+
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermUsersRead, PermUsersDelete, PermUsersUnlock, PermRolesManage,
+		PermMediaEdit, PermMediaDelete, PermCommentsDelete, PermLibraryManage,
+		PermInvitesManage,
+	},
+	RoleModerator: {PermUsersRead, PermUsersUnlock, PermCommentsDelete},
+	RoleEditor:    {PermMediaEdit},
+	RoleMember:    {},
+}
+
+// ValidRole reports whether role can be granted.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok && role != RoleMember
+}
+
+// Roles returns the roles that can be granted, sorted.
+func Roles() []string {
+	roles := make([]string, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		if role != RoleMember {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Can reports whether any of roles grants perm.
+func Can(roles []string, perm string) bool {
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if p == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanInvite reports whether a user with roles may create invites, when
+// inviters lists the roles allowed to. RoleMember in inviters allows every
+// user.
+func CanInvite(roles []string, inviters []string) bool {
+	for _, r := range inviters {
+		if r == RoleMember {
+			return true
+		}
+		for _, role := range roles {
+			if role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithoutTwoFactor drops the roles that require a second factor from roles,
+// for sessions that logged in without one.
+func WithoutTwoFactor(roles []string, required map[string]bool) []string {
+	kept := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !required[role] {
+			kept = append(kept, role)
+		}
+	}
+	return kept
+}
+
+// GroupRoles compares the roles a user holds with those mapped from their
+// groups at a provider. Only roles in groupRoles are managed: those of the
+// groups are added, the others removed. Unknown roles are skipped.
+func GroupRoles(roles, groups []string, groupRoles map[string]string) (add, remove []string) {
+	held := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		held[role] = true
+	}
+	want := make(map[string]bool)
+	for _, g := range groups {
+		if role, ok := groupRoles[g]; ok && ValidRole(role) {
+			want[role] = true
+		}
+	}
+	for role := range want {
+		if !held[role] {
+			add = append(add, role)
+		}
+	}
+	for _, role := range groupRoles {
+		if held[role] && !want[role] {
+			held[role] = false
+			remove = append(remove, role)
+		}
+	}
+	sort.Strings(add)
+	sort.Strings(remove)
+	return add, remove
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	assert.False(t, Can(nil, PermMediaEdit))
+	assert.True(t, Can([]string{RoleEditor}, PermMediaEdit))
+	assert.False(t, Can([]string{RoleEditor}, PermUsersDelete))
+	assert.True(t, Can([]string{RoleEditor, RoleModerator}, PermCommentsDelete))
+	assert.True(t, Can([]string{RoleAdmin}, PermRolesManage))
+	assert.True(t, Can([]string{RoleModerator}, PermUsersUnlock))
+	assert.False(t, Can([]string{"root"}, PermRolesManage))
+}
+
+func TestValidRole(t *testing.T) {
+	assert.True(t, ValidRole(RoleModerator))
+	assert.False(t, ValidRole(RoleMember), "everybody is a member already")
+	assert.False(t, ValidRole("root"))
+}
+
+func TestWithoutTwoFactor(t *testing.T) {
+	required := map[string]bool{RoleAdmin: true}
+	assert.Equal(t, []string{RoleEditor}, WithoutTwoFactor([]string{RoleAdmin, RoleEditor}, required))
+	assert.Empty(t, WithoutTwoFactor(nil, required))
+}
+
+func TestCanInvite(t *testing.T) {
+	assert.True(t, CanInvite([]string{RoleModerator}, []string{RoleAdmin, RoleModerator}))
+	assert.False(t, CanInvite([]string{RoleEditor}, []string{RoleAdmin, RoleModerator}))
+	assert.True(t, CanInvite(nil, []string{RoleMember}), "everybody is a member")
+	assert.False(t, CanInvite([]string{RoleAdmin}, nil))
+}
+
+func TestGroupRoles(t *testing.T) {
+	mapped := map[string]string{"staff": RoleModerator, "editors": RoleEditor, "ops": "root"}
+
+	add, remove := GroupRoles([]string{RoleEditor}, []string{"staff", "ops"}, mapped)
+	assert.Equal(t, []string{RoleModerator}, add)
+	assert.Equal(t, []string{RoleEditor}, remove)
+
+	add, remove = GroupRoles([]string{RoleAdmin}, nil, mapped)
+	assert.Empty(t, add)
+	assert.Empty(t, remove, "roles not mapped from groups are kept")
+}
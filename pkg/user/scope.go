@@ -0,0 +1,53 @@
+package user
+
+import "sort"
+
+// AccessTokenPrefix starts every personal access token, so that they can be
+// told apart from JWTs in the Authorization header.
+const AccessTokenPrefix = "kms_"
+
+// Scopes limit what a personal access token can do on top of the roles of
+// its user.
+const (
+	// ScopeRead allows GET and HEAD requests, except to the account security
+	// and admin routes, which are closed to tokens.
+	ScopeRead = "read"
+	// ScopeLibraryWrite allows tracking playback, progress and favorites.
+	ScopeLibraryWrite = "library:write"
+	// ScopeMediaEdit allows changing medias, their episodes and segments.
+	ScopeMediaEdit = "media:edit"
+	// ScopeCommentsWrite allows posting and deleting comments.
+	ScopeCommentsWrite = "comments:write"
+)
+
+var scopes = map[string]bool{
+	ScopeRead:          true,
+	ScopeLibraryWrite:  true,
+	ScopeMediaEdit:     true,
+	ScopeCommentsWrite: true,
+}
+
+// ValidScope reports whether scope can be given to a token.
+func ValidScope(scope string) bool {
+	return scopes[scope]
+}
+
+// Scopes returns the scopes tokens can have, sorted.
+func Scopes() []string {
+	list := make([]string, 0, len(scopes))
+	for s := range scopes {
+		list = append(list, s)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// HasScope reports whether granted contains scope.
+func HasScope(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidScope(t *testing.T) {
+	assert.True(t, ValidScope(ScopeLibraryWrite))
+	assert.False(t, ValidScope(PermUsersDelete), "permissions are not scopes")
+	assert.Equal(t, []string{ScopeCommentsWrite, ScopeLibraryWrite, ScopeMediaEdit, ScopeRead}, Scopes())
+}
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, HasScope([]string{ScopeRead, ScopeMediaEdit}, ScopeMediaEdit))
+	assert.False(t, HasScope([]string{ScopeRead}, ScopeMediaEdit))
+	assert.False(t, HasScope(nil, ScopeRead))
+}
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Seen collects the last seen time of sessions, or the last use of access
+// tokens, in memory and writes them in batches, so that authenticated
+// requests don't each cost a database write.
+type Seen struct {
+	flush    func(map[uint]time.Time) error
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[uint]time.Time
+}
+
+// NewSeen returns a Seen writing with flush every interval once it runs.
+func NewSeen(flush func(map[uint]time.Time) error, interval time.Duration) *Seen {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &Seen{
+		flush:    flush,
+		interval: interval,
+		pending:  make(map[uint]time.Time),
+	}
+}
+
+// Touch marks the session as seen now.
+func (s *Seen) Touch(sessionID uint) {
+	if sessionID == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.pending[sessionID] = time.Now()
+	s.mu.Unlock()
+}
+
+// Get returns the unwritten last seen time of the session, if any.
+func (s *Seen) Get(sessionID uint) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.pending[sessionID]
+	return t, ok
+}
+
+// Flush writes the pending times. They are kept for the next try when the
+// write fails, unless the session was seen again meanwhile.
+func (s *Seen) Flush() error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = make(map[uint]time.Time)
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := s.flush(batch); err != nil {
+		s.mu.Lock()
+		for id, t := range batch {
+			if _, ok := s.pending[id]; !ok {
+				s.pending[id] = t
+			}
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is done, then once more.
+func (s *Seen) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				log.Println("seen:", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Println("seen:", err)
+			}
+		}
+	}
+}
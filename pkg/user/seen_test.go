@@ -0,0 +1,51 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeenBatches(t *testing.T) {
+	var writes []map[uint]time.Time
+	s := NewSeen(func(batch map[uint]time.Time) error {
+		writes = append(writes, batch)
+		return nil
+	}, time.Minute)
+
+	s.Touch(1)
+	s.Touch(1)
+	s.Touch(2)
+	s.Touch(0)
+	_, ok := s.Get(1)
+	assert.True(t, ok)
+
+	assert.NoError(t, s.Flush())
+	assert.NoError(t, s.Flush())
+	if assert.Len(t, writes, 1, "nothing to write the second time") {
+		assert.Len(t, writes[0], 2)
+	}
+	_, ok = s.Get(1)
+	assert.False(t, ok)
+}
+
+func TestSeenRetries(t *testing.T) {
+	fail := true
+	var written map[uint]time.Time
+	s := NewSeen(func(batch map[uint]time.Time) error {
+		if fail {
+			return errors.New("db down")
+		}
+		written = batch
+		return nil
+	}, time.Minute)
+
+	s.Touch(1)
+	assert.Error(t, s.Flush())
+
+	fail = false
+	assert.NoError(t, s.Flush())
+	assert.Contains(t, written, uint(1))
+}
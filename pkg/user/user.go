@@ -1,6 +1,9 @@
 package user
 
 import (
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/lockout"
 	"github.com/xenking/kitsu-media-server/pkg/model"
 )
 
@@ -8,12 +11,74 @@ type Store interface {
 	GetByID(uint) (*model.User, error)
 	GetByEmail(string) (*model.User, error)
 	GetByUsername(string) (*model.User, error)
+	GetByScrobbleToken(string) (*model.User, error)
 	Create(*model.User) error
 	Update(*model.User) error
+	SetEmailVerified(userID uint, at *time.Time) error
 	Delete(*model.User) error
 	List(offset, limit int) ([]model.User, int, error)
 
 	AddFollower(user *model.User, followerID uint) error
 	RemoveFollower(user *model.User, followerID uint) error
 	IsFollower(userID, followerID uint) (bool, error)
+
+	ListRoles(userID uint) ([]string, error)
+	AddRole(userID uint, role string) error
+	RemoveRole(userID uint, role string) error
+	ListRoleSettings() ([]model.RoleSetting, error)
+	SaveRoleSetting(*model.RoleSetting) error
+
+	SetTOTP(userID uint, secret *string, enabledAt *time.Time) error
+	UseTOTPStep(userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, hashes []string) error
+	UseRecoveryCode(userID uint, hash string) (bool, error)
+
+	CreateWebAuthnCredential(*model.WebAuthnCredential) error
+	GetWebAuthnCredential(id uint) (*model.WebAuthnCredential, error)
+	GetWebAuthnCredentialByCredentialID(credentialID string) (*model.WebAuthnCredential, error)
+	ListWebAuthnCredentials(userID uint) ([]model.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(*model.WebAuthnCredential) error
+	UseWebAuthnCredential(c *model.WebAuthnCredential, signCount uint32) (bool, error)
+	DeleteWebAuthnCredential(*model.WebAuthnCredential) error
+	SaveWebAuthnChallenge(*model.WebAuthnChallenge) error
+	TakeWebAuthnChallenge(hash string) (*model.WebAuthnChallenge, error)
+
+	CreateSession(*model.Session) error
+	GetSession(id uint) (*model.Session, error)
+	ListSessions(userID uint) ([]model.Session, error)
+	TouchSessions(seen map[uint]time.Time) error
+	RevokeSession(id uint) error
+	RevokeUserSessions(userID uint) error
+	CreateRefreshToken(*model.RefreshToken) error
+	GetRefreshToken(hash string) (*model.RefreshToken, error)
+	UseRefreshToken(*model.RefreshToken) (bool, error)
+	RevokeToken(jti string, expires time.Time) error
+	IsTokenRevoked(sessionID uint, jti string) (bool, error)
+
+	CreateAccessToken(*model.AccessToken) error
+	GetAccessToken(id uint) (*model.AccessToken, error)
+	GetAccessTokenByHash(hash string) (*model.AccessToken, error)
+	ListAccessTokens(userID uint) ([]model.AccessToken, error)
+	TouchAccessTokens(used map[uint]time.Time) error
+	DeleteAccessToken(*model.AccessToken) error
+
+	GetLoginThrottle(key string) (*model.LoginThrottle, error)
+	FailLogin(key string, userID uint, p lockout.Policy, now time.Time) (*model.LoginThrottle, bool, error)
+	DeleteLoginThrottle(key string) (bool, error)
+	ListLoginLocks(now time.Time) ([]model.LoginThrottle, error)
+
+	CreateInvite(*model.Invite) error
+	GetInvite(id uint) (*model.Invite, error)
+	ListInvites(creatorID uint) ([]model.Invite, error)
+	UseInvite(hash string, now time.Time) (*model.Invite, error)
+	ReleaseInvite(id uint) error
+	RevokeInvite(id uint) error
+
+	GetOIDCIdentity(provider, subject string) (*model.OIDCIdentity, error)
+	CreateOIDCIdentity(*model.OIDCIdentity) error
+	ListOIDCIdentities(userID uint) ([]model.OIDCIdentity, error)
+	TouchOIDCIdentity(id uint, at time.Time) error
+	DeleteOIDCIdentity(*model.OIDCIdentity) error
+	SaveOIDCState(*model.OIDCState) error
+	TakeOIDCState(hash string) (*model.OIDCState, error)
 }
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+const (
+	ActionVerifyEmail   = "verify-email"
+	ActionResetPassword = "reset-password"
+	ActionTwoFactor     = "two-factor"
+)
+
+var (
+	ErrActionInvalid = errors.New("invalid or already used token")
+	ErrActionExpired = errors.New("token has expired")
+)
+
+// ActionToken is a token mailed to a user to confirm an action. It is signed
+// over a state of the user the action changes, such as the password hash,
+// so it stops working once it has been used.
+type ActionToken struct {
+	Action  string
+	UserID  uint
+	Expires int64
+	payload string
+	sig     []byte
+}
+
+// NewActionToken signs action for userID in its current state.
+func NewActionToken(action string, userID uint, state string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(
+		action + ":" + strconv.FormatUint(uint64(userID), 10) + ":" + strconv.FormatInt(expires.Unix(), 10)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(actionSignature(payload, state))
+}
+
+// ParseActionToken reads a token for action without checking its signature
+// yet, since the user it names holds the state to check it against.
+func ParseActionToken(action, token string) (*ActionToken, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, ErrActionInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, ErrActionInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return nil, ErrActionInvalid
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != action {
+		return nil, ErrActionInvalid
+	}
+	userID, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, ErrActionInvalid
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrActionInvalid
+	}
+	return &ActionToken{
+		Action:  action,
+		UserID:  uint(userID),
+		Expires: expires,
+		payload: token[:i],
+		sig:     sig,
+	}, nil
+}
+
+// Verify checks the token against the current state of its user.
+func (t *ActionToken) Verify(state string) error {
+	if !hmac.Equal(t.sig, actionSignature(t.payload, state)) {
+		return ErrActionInvalid
+	}
+	if time.Now().Unix() > t.Expires {
+		return ErrActionExpired
+	}
+	return nil
+}
+
+func actionSignature(payload, state string) []byte {
+	mac := hmac.New(sha256.New, config.Global.JWTSecret)
+	mac.Write([]byte(payload + "\n" + state))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+func TestActionToken(t *testing.T) {
+	defer func(secret []byte) { config.Global.JWTSecret = secret }(config.Global.JWTSecret)
+	config.Global.JWTSecret = []byte("0123456789abcdef0123456789abcdef")
+
+	token := NewActionToken(ActionResetPassword, 7, "hash1", time.Now().Add(time.Hour))
+
+	at, err := ParseActionToken(ActionResetPassword, token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), at.UserID)
+	assert.NoError(t, at.Verify("hash1"))
+	assert.Equal(t, ErrActionInvalid, at.Verify("hash2"), "the password changed, the token was used")
+
+	_, err = ParseActionToken(ActionVerifyEmail, token)
+	assert.Equal(t, ErrActionInvalid, err, "tokens only work for their action")
+
+	at, err = ParseActionToken(ActionResetPassword, token[:len(token)-4]+"AAAA")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrActionInvalid, at.Verify("hash1"))
+
+	expired := NewActionToken(ActionResetPassword, 7, "hash1", time.Now().Add(-time.Minute))
+	at, _ = ParseActionToken(ActionResetPassword, expired)
+	assert.Equal(t, ErrActionExpired, at.Verify("hash1"))
+}
@@ -8,11 +8,25 @@ import (
 	"github.com/xenking/kitsu-media-server/pkg/config"
 )
 
-func GenerateJWT(id uint) string {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
+// GenerateJWT issues a short lived access token for a session of the user.
+// Clients renew it with the refresh token of the session.
+func GenerateJWT(id, sessionID uint, roles ...string) string {
+	jti, _ := NewToken(16)
+	claims := jwt.MapClaims{}
 	claims["id"] = id
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
-	t, _ := token.SignedString(config.Global.JWTSecret)
+	claims["sid"] = sessionID
+	claims["jti"] = jti
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	claims["exp"] = time.Now().Add(accessTTL()).Unix()
+	t, _ := config.Global.JWTKeys.Sign(claims)
 	return t
 }
+
+func accessTTL() time.Duration {
+	if config.Global.AccessTTL > 0 {
+		return config.Global.AccessTTL
+	}
+	return 15 * time.Minute
+}
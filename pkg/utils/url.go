@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+var (
+	ErrURLInvalid = errors.New("invalid link signature")
+	ErrURLExpired = errors.New("link has expired")
+)
+
+// SignURL returns path with a query string that authorizes requests to it as
+// userID until expires, for clients that cannot send an Authorization header.
+// Links are always bound to a user, VerifyURL rejects a zero userID.
+func SignURL(path string, userID uint, expires time.Time) string {
+	key := linkKeys()[0]
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("uid", strconv.FormatUint(uint64(userID), 10))
+	q.Set("kid", key.ID)
+	q.Set("sig", urlSignature(key.Secret, path, q))
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + q.Encode()
+}
+
+// VerifyURL checks the signature of a link to path made by SignURL and
+// returns the user it was signed for.
+func VerifyURL(path string, q url.Values) (uint, error) {
+	var secret []byte
+	for _, k := range linkKeys() {
+		if k.ID == q.Get("kid") {
+			secret = k.Secret
+			break
+		}
+	}
+	if secret == nil {
+		return 0, ErrURLInvalid
+	}
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(urlSignature(secret, path, q))) {
+		return 0, ErrURLInvalid
+	}
+
+	expires, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return 0, ErrURLInvalid
+	}
+	if time.Now().Unix() > expires {
+		return 0, ErrURLExpired
+	}
+	userID, err := strconv.ParseUint(q.Get("uid"), 10, 32)
+	if err != nil || userID == 0 {
+		return 0, ErrURLInvalid
+	}
+	return uint(userID), nil
+}
+
+func urlSignature(secret []byte, path string, q url.Values) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{q.Get("kid"), path, q.Get("uid"), q.Get("exp")}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// linkKeys falls back to the JWT secret when no link keys are configured.
+func linkKeys() []config.LinkKey {
+	if len(config.Global.LinkKeys) > 0 {
+		return config.Global.LinkKeys
+	}
+	return []config.LinkKey{{ID: "0", Secret: config.Global.JWTSecret}}
+}
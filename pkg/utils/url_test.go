@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/config"
+)
+
+func verifyLink(t *testing.T, link string) (uint, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return VerifyURL(u.Path, u.Query())
+}
+
+func TestSignedURLRotation(t *testing.T) {
+	defer func(keys []config.LinkKey) { config.Global.LinkKeys = keys }(config.Global.LinkKeys)
+
+	old := config.LinkKey{ID: "a", Secret: []byte("old secret")}
+	config.Global.LinkKeys = []config.LinkKey{old}
+	link := SignURL("/api/files/1/stream", 42, time.Now().Add(time.Hour))
+
+	userID, err := verifyLink(t, link)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), userID)
+
+	_, err = verifyLink(t, link+"0")
+	assert.Equal(t, ErrURLInvalid, err)
+
+	_, err = verifyLink(t, SignURL("/api/files/1/stream", 42, time.Now().Add(-time.Second)))
+	assert.Equal(t, ErrURLExpired, err)
+
+	// Links are never valid without a user.
+	_, err = verifyLink(t, SignURL("/api/files/1/stream", 0, time.Now().Add(time.Hour)))
+	assert.Equal(t, ErrURLInvalid, err)
+
+	// A new key signs new links while the old one still verifies.
+	config.Global.LinkKeys = []config.LinkKey{{ID: "b", Secret: []byte("new secret")}, old}
+	_, err = verifyLink(t, link)
+	assert.NoError(t, err)
+
+	// Dropping the old key retires only its links.
+	fresh := SignURL("/api/files/1/stream", 42, time.Now().Add(time.Hour))
+	config.Global.LinkKeys = config.Global.LinkKeys[:1]
+	_, err = verifyLink(t, link)
+	assert.Equal(t, ErrURLInvalid, err)
+	_, err = verifyLink(t, fresh)
+	assert.NoError(t, err)
+}
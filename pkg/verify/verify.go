@@ -0,0 +1,200 @@
+// Package verify checks linked episode files against the CRC32 that release
+// groups embed in their file names.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/release"
+)
+
+const (
+	batchSize  = 50
+	bufferSize = 1 << 20
+	// maxRetry is the longest a file that cannot be read waits to be tried
+	// again.
+	maxRetry = 24 * time.Hour
+)
+
+// Verifier hashes pending files in the background. Progress is saved while
+// hashing, so a restarted server continues where it stopped instead of
+// reading large files from the beginning again.
+type Verifier struct {
+	store      library.Store
+	rate       int64
+	idle       time.Duration
+	retry      time.Duration
+	checkpoint int64
+}
+
+// New returns a Verifier reading at most rate bytes per second.
+// A rate of zero disables throttling.
+func New(s library.Store, rate int64) *Verifier {
+	return &Verifier{
+		store:      s,
+		rate:       rate,
+		idle:       time.Minute,
+		retry:      time.Hour,
+		checkpoint: 256 << 20,
+	}
+}
+
+// Run verifies pending files until ctx is cancelled. Files that cannot be
+// read are tried again later, waiting twice as long after every failure.
+func (v *Verifier) Run(ctx context.Context) {
+	for {
+		files, err := v.store.ListPendingFiles(batchSize, time.Now())
+		if err != nil {
+			log.Println("verify:", err)
+		}
+		failed := false
+		for i := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := v.Verify(ctx, &files[i]); err != nil {
+				if err == context.Canceled {
+					return
+				}
+				log.Printf("verify: %s: %v", files[i].Path, err)
+				if err := v.postpone(&files[i]); err != nil {
+					log.Println("verify:", err)
+				}
+				failed = true
+			}
+		}
+		if err == nil && len(files) > 0 && !failed {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(v.idle):
+		}
+	}
+}
+
+// postpone records a failure to verify f and when to retry it.
+func (v *Verifier) postpone(f *model.MediaFile) error {
+	wait := v.retry
+	for i := 0; i < f.CRCFailures && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	if wait > maxRetry {
+		wait = maxRetry
+	}
+	retryAt := time.Now().Add(wait)
+	f.CRCFailures++
+	f.CRCRetryAt = &retryAt
+	return v.store.SaveChecksumRetry(f)
+}
+
+// Verify hashes f, resuming from its saved offset, and records the result.
+func (v *Verifier) Verify(ctx context.Context, f *model.MediaFile) error {
+	now := time.Now()
+	expected := release.Parse(f.Path).CRC32
+	if expected == "" {
+		f.CRCState = model.CRCUnknown
+		f.CRCExpected = ""
+		f.CRCActual = ""
+		f.CRCCheckedAt = &now
+		f.CRCFailures = 0
+		f.CRCRetryAt = nil
+		return v.store.SaveChecksum(f)
+	}
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	st, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() != f.Size || f.CRCExpected != expected || f.CRCOffset > st.Size() {
+		// The file or its name changed since the last run.
+		f.Size = st.Size()
+		f.CRCOffset = 0
+		f.CRCPartial = 0
+	}
+	f.CRCExpected = expected
+	if _, err := file.Seek(f.CRCOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		crc   = uint32(f.CRCPartial)
+		buf   = make([]byte, bufferSize)
+		start = time.Now()
+		read  int64
+		saved = f.CRCOffset
+	)
+	for {
+		n, err := file.Read(buf)
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		f.CRCOffset += int64(n)
+		read += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if f.CRCOffset-saved >= v.checkpoint {
+			f.CRCPartial = int64(crc)
+			if err := v.store.SaveChecksum(f); err != nil {
+				return err
+			}
+			saved = f.CRCOffset
+		}
+		if err := v.throttle(ctx, start, read); err != nil {
+			f.CRCPartial = int64(crc)
+			if err := v.store.SaveChecksum(f); err != nil {
+				log.Println("verify:", err)
+			}
+			return err
+		}
+	}
+
+	now = time.Now()
+	f.CRCPartial = int64(crc)
+	f.CRCActual = fmt.Sprintf("%08X", crc)
+	f.CRCCheckedAt = &now
+	f.CRCFailures = 0
+	f.CRCRetryAt = nil
+	f.CRCState = model.CRCVerified
+	if f.CRCActual != f.CRCExpected {
+		f.CRCState = model.CRCMismatch
+	}
+	return v.store.SaveChecksum(f)
+}
+
+// throttle sleeps until reading n bytes since start fits in the rate limit.
+func (v *Verifier) throttle(ctx context.Context, start time.Time, n int64) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if v.rate <= 0 {
+		return nil
+	}
+	wait := time.Duration(float64(n)/float64(v.rate)*float64(time.Second)) - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
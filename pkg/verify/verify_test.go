@@ -0,0 +1,194 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type fakeStore struct {
+	library.Store
+	saves int
+}
+
+func (s *fakeStore) SaveChecksum(*model.MediaFile) error {
+	s.saves++
+	return nil
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 3*bufferSize+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	sum := fmt.Sprintf("%08X", crc32.ChecksumIEEE(data))
+
+	s := &fakeStore{}
+	v := New(s, 0)
+	v.checkpoint = bufferSize
+
+	good := &model.MediaFile{Path: writeFile(t, dir, "[Group] Show - 01 ["+sum+"].mkv", data)}
+	assert.NoError(t, v.Verify(context.Background(), good))
+	assert.Equal(t, model.CRCVerified, good.CRCState)
+	assert.Equal(t, sum, good.CRCActual)
+	assert.True(t, s.saves > 1, "progress should be checkpointed")
+
+	bad := &model.MediaFile{Path: writeFile(t, dir, "[Group] Show - 02 [00000000].mkv", data)}
+	assert.NoError(t, v.Verify(context.Background(), bad))
+	assert.Equal(t, model.CRCMismatch, bad.CRCState)
+
+	unknown := &model.MediaFile{Path: writeFile(t, dir, "Show - 03.mkv", data)}
+	assert.NoError(t, v.Verify(context.Background(), unknown))
+	assert.Equal(t, model.CRCUnknown, unknown.CRCState)
+}
+
+func TestVerifyResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	sum := fmt.Sprintf("%08X", crc32.ChecksumIEEE(data))
+	f := &model.MediaFile{
+		Path:        writeFile(t, dir, "Show - 01 ["+sum+"].mkv", data),
+		Size:        int64(len(data)),
+		CRCExpected: sum,
+		CRCOffset:   10,
+		CRCPartial:  int64(crc32.ChecksumIEEE(data[:10])),
+	}
+	assert.NoError(t, New(&fakeStore{}, 0).Verify(context.Background(), f))
+	assert.Equal(t, model.CRCVerified, f.CRCState)
+	assert.Equal(t, int64(len(data)), f.CRCOffset)
+}
+
+// listStore keeps files in memory and lists pending ones like the database.
+type listStore struct {
+	library.Store
+	mu       sync.Mutex
+	files    map[uint]model.MediaFile
+	verified chan uint
+}
+
+func (s *listStore) ListPendingFiles(limit int, now time.Time) ([]model.MediaFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var files []model.MediaFile
+	for _, f := range s.files {
+		if f.CRCState == model.CRCPending && (f.CRCRetryAt == nil || !f.CRCRetryAt.After(now)) {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+func (s *listStore) SaveChecksum(f *model.MediaFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[f.ID] = *f
+	if f.CRCState == model.CRCVerified {
+		s.verified <- f.ID
+	}
+	return nil
+}
+
+func (s *listStore) SaveChecksumRetry(f *model.MediaFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := s.files[f.ID]
+	saved.CRCFailures = f.CRCFailures
+	saved.CRCRetryAt = f.CRCRetryAt
+	s.files[f.ID] = saved
+	return nil
+}
+
+func TestRunSkipsFailingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &listStore{files: map[uint]model.MediaFile{}, verified: make(chan uint, 1)}
+	// A whole batch of files that cannot be read comes first.
+	for i := 1; i <= batchSize; i++ {
+		f := model.MediaFile{Path: filepath.Join(dir, fmt.Sprintf("Show - %02d [00000000].mkv", i)), CRCState: model.CRCPending}
+		f.ID = uint(i)
+		s.files[f.ID] = f
+	}
+	data := []byte("episode")
+	good := model.MediaFile{
+		Path:     writeFile(t, dir, fmt.Sprintf("Show - 99 [%08X].mkv", crc32.ChecksumIEEE(data)), data),
+		CRCState: model.CRCPending,
+	}
+	good.ID = batchSize + 1
+	s.files[good.ID] = good
+
+	v := New(s, 0)
+	v.idle = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go v.Run(ctx)
+
+	select {
+	case id := <-s.verified:
+		assert.Equal(t, good.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the file after a failing batch was never verified")
+	}
+	cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := s.files[1]
+	assert.Equal(t, 1, failed.CRCFailures)
+	if assert.NotNil(t, failed.CRCRetryAt) {
+		assert.True(t, failed.CRCRetryAt.After(time.Now().Add(v.retry/2)))
+	}
+}
+
+func TestPostponeBacksOff(t *testing.T) {
+	v := New(&listStore{files: map[uint]model.MediaFile{}}, 0)
+	f := &model.MediaFile{}
+	var waits []time.Duration
+	for i := 0; i < 8; i++ {
+		start := time.Now()
+		assert.NoError(t, v.postpone(f))
+		waits = append(waits, f.CRCRetryAt.Sub(start).Round(time.Minute))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Hour, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour, 16 * time.Hour,
+		maxRetry, maxRetry, maxRetry,
+	}, waits)
+	assert.Equal(t, 8, f.CRCFailures)
+}
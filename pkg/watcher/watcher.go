@@ -0,0 +1,333 @@
+// Package watcher keeps the library in sync with the configured directories,
+// linking new episode files as they appear and following renames and deletions.
+package watcher
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+	"github.com/xenking/kitsu-media-server/pkg/release"
+)
+
+const (
+	EventEpisodeAdded = "episode_added"
+	EventFileMoved    = "file_moved"
+	EventFileOrphaned = "file_orphaned"
+)
+
+// Event is emitted after the watcher changed a file record.
+type Event struct {
+	Type    string
+	MediaID uint
+	Episode int
+	FileID  uint
+	Path    string
+}
+
+var videoExts = map[string]bool{
+	".mkv":  true,
+	".webm": true,
+	".mp4":  true,
+	".m4v":  true,
+	".mov":  true,
+}
+
+// candidate is a file that changed recently and is waiting to settle.
+type candidate struct {
+	size    int64
+	changed time.Time
+}
+
+// departure is a linked file that was removed or renamed away. It becomes an
+// orphan unless a new file claims it as the target of a move.
+type departure struct {
+	file *model.MediaFile
+	at   time.Time
+}
+
+type Watcher struct {
+	files    library.Store
+	matcher  *library.Matcher
+	roots    []string
+	debounce time.Duration
+	settle   time.Duration
+	handlers []func(Event)
+
+	fs      *fsnotify.Watcher
+	pending map[string]*candidate
+	gone    map[string]*departure
+}
+
+// New returns a Watcher over roots. Files are ingested once their size has
+// not changed for the settle duration.
+func New(ls library.Store, m *library.Matcher, roots []string, settle time.Duration) *Watcher {
+	return &Watcher{
+		files:    ls,
+		matcher:  m,
+		roots:    roots,
+		debounce: time.Second,
+		settle:   settle,
+		pending:  make(map[string]*candidate),
+		gone:     make(map[string]*departure),
+	}
+}
+
+// Subscribe registers fn to be called for every emitted event.
+// It must be called before Run.
+func (w *Watcher) Subscribe(fn func(Event)) {
+	w.handlers = append(w.handlers, fn)
+}
+
+// Run watches the library roots until ctx is cancelled. Files already present
+// on startup are ingested as well, which links anything added while the
+// server was down.
+func (w *Watcher) Run(ctx context.Context) error {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	w.fs = fs
+
+	for _, root := range w.roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		w.addTree(abs)
+	}
+
+	tick := time.NewTicker(w.debounce)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fs.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ev, time.Now())
+		case err, ok := <-fs.Errors:
+			if !ok {
+				return nil
+			}
+			log.Println("watcher:", err)
+		case now := <-tick.C:
+			w.flush(now)
+		}
+	}
+}
+
+// addTree watches dir and its subdirectories and queues the files found.
+func (w *Watcher) addTree(dir string) {
+	now := time.Now()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Println("watcher:", err)
+			return nil
+		}
+		if info.IsDir() {
+			if w.fs != nil {
+				if err := w.fs.Add(path); err != nil {
+					log.Println("watcher:", err)
+				}
+			}
+			return nil
+		}
+		w.touch(path, info.Size(), now)
+		return nil
+	})
+	if err != nil {
+		log.Println("watcher:", err)
+	}
+}
+
+func (w *Watcher) handle(ev fsnotify.Event, now time.Time) {
+	switch {
+	case ev.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		st, err := os.Stat(ev.Name)
+		if err != nil {
+			return
+		}
+		if st.IsDir() {
+			if ev.Op&fsnotify.Create != 0 {
+				w.addTree(ev.Name)
+			}
+			return
+		}
+		w.touch(ev.Name, st.Size(), now)
+	case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		delete(w.pending, ev.Name)
+		w.depart(ev.Name, now)
+	}
+}
+
+func (w *Watcher) touch(path string, size int64, now time.Time) {
+	if !videoExts[strings.ToLower(filepath.Ext(path))] {
+		return
+	}
+	c, ok := w.pending[path]
+	if !ok {
+		c = new(candidate)
+		w.pending[path] = c
+	}
+	c.size = size
+	c.changed = now
+}
+
+// depart records the linked files that were at path, or below it when a
+// whole directory went away.
+func (w *Watcher) depart(path string, now time.Time) {
+	f, err := w.files.GetFileByPath(path)
+	if err != nil {
+		log.Println("watcher:", err)
+		return
+	}
+	files := make([]model.MediaFile, 0)
+	if f != nil {
+		files = append(files, *f)
+	} else if files, err = w.files.ListFilesUnder(path); err != nil {
+		log.Println("watcher:", err)
+		return
+	}
+	for i := range files {
+		if files[i].OrphanedAt == nil {
+			w.gone[files[i].Path] = &departure{file: &files[i], at: now}
+		}
+	}
+}
+
+// flush ingests the files that stopped growing and orphans the departed
+// files nobody claimed.
+func (w *Watcher) flush(now time.Time) {
+	for path, c := range w.pending {
+		if now.Sub(c.changed) < w.settle {
+			continue
+		}
+		st, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		if st.Size() != c.size {
+			c.size = st.Size()
+			c.changed = now
+			continue
+		}
+		delete(w.pending, path)
+		if err := w.ingest(path, st.Size()); err != nil {
+			log.Printf("watcher: %s: %v", path, err)
+		}
+	}
+
+	for path, d := range w.gone {
+		// Give a moved file time to settle and claim its record first.
+		if now.Sub(d.at) < w.settle+w.debounce {
+			continue
+		}
+		delete(w.gone, path)
+		if err := w.orphan(d.file, now); err != nil {
+			log.Printf("watcher: %s: %v", path, err)
+		}
+	}
+}
+
+func (w *Watcher) ingest(path string, size int64) error {
+	f, err := w.files.GetFileByPath(path)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		if f.Size == size && f.OrphanedAt == nil {
+			return nil
+		}
+		// The file came back or was replaced in place.
+		f.OrphanedAt = nil
+		resetChecksum(f)
+		if err := library.Probe(f); err != nil {
+			return err
+		}
+		return w.files.UpdateFile(f)
+	}
+
+	if f := w.claim(path, size); f != nil {
+		if release.Parse(path).CRC32 != f.CRCExpected {
+			resetChecksum(f)
+		}
+		f.Path = path
+		f.OrphanedAt = nil
+		if err := w.files.UpdateFile(f); err != nil {
+			return err
+		}
+		w.emit(Event{Type: EventFileMoved, MediaID: f.MediaID, Episode: f.Episode, FileID: f.ID, Path: path})
+		return nil
+	}
+
+	r := release.Parse(path)
+	m, err := w.matcher.Match(r)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		log.Printf("watcher: %s: no matching media", path)
+		return nil
+	}
+	f = &model.MediaFile{MediaID: m.ID, Episode: r.Episode, Path: path}
+	if err := library.Probe(f); err != nil {
+		return err
+	}
+	if err := w.files.CreateFile(f); err != nil {
+		return err
+	}
+	w.emit(Event{Type: EventEpisodeAdded, MediaID: f.MediaID, Episode: f.Episode, FileID: f.ID, Path: path})
+	return nil
+}
+
+// claim returns the departed file that most likely moved to path: one with
+// the same size and either the same name or the same directory.
+func (w *Watcher) claim(path string, size int64) *model.MediaFile {
+	for old, d := range w.gone {
+		if d.file.Size != size {
+			continue
+		}
+		if filepath.Base(old) == filepath.Base(path) || filepath.Dir(old) == filepath.Dir(path) {
+			delete(w.gone, old)
+			return d.file
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) orphan(f *model.MediaFile, now time.Time) error {
+	if _, err := os.Stat(f.Path); err == nil {
+		// Replaced by a new file under the same name; ingest handles it.
+		return nil
+	}
+	f.OrphanedAt = &now
+	if err := w.files.UpdateFile(f); err != nil {
+		return err
+	}
+	w.emit(Event{Type: EventFileOrphaned, MediaID: f.MediaID, Episode: f.Episode, FileID: f.ID, Path: f.Path})
+	return nil
+}
+
+func (w *Watcher) emit(ev Event) {
+	for _, fn := range w.handlers {
+		fn(ev)
+	}
+}
+
+func resetChecksum(f *model.MediaFile) {
+	f.CRCState = model.CRCPending
+	f.CRCOffset = 0
+	f.CRCPartial = 0
+	f.CRCActual = ""
+}
@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/library"
+	"github.com/xenking/kitsu-media-server/pkg/model"
+)
+
+type fakeStore struct {
+	library.Store
+	files map[string]*model.MediaFile
+}
+
+func (s *fakeStore) GetFileByPath(path string) (*model.MediaFile, error) {
+	if f, ok := s.files[path]; ok {
+		c := *f
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) ListFilesUnder(string) ([]model.MediaFile, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) UpdateFile(f *model.MediaFile) error {
+	for path, old := range s.files {
+		if old.ID == f.ID {
+			delete(s.files, path)
+		}
+	}
+	c := *f
+	s.files[f.Path] = &c
+	return nil
+}
+
+func TestWatcherFollowsRenamesAndDeletions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldPath := filepath.Join(dir, "[Group] Show - 01 [ABCD1234].mkv")
+	newPath := filepath.Join(dir, "Show - 01.mkv")
+	gonePath := filepath.Join(dir, "Show - 02.mkv")
+	data := []byte("episode data")
+	if err := ioutil.WriteFile(newPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeStore{files: map[string]*model.MediaFile{
+		oldPath:  {Model: gorm.Model{ID: 1}, MediaID: 7, Episode: 1, Path: oldPath, Size: int64(len(data)), CRCState: model.CRCVerified, CRCExpected: "ABCD1234"},
+		gonePath: {Model: gorm.Model{ID: 2}, MediaID: 7, Episode: 2, Path: gonePath, Size: 99},
+	}}
+	var events []Event
+	w := New(s, nil, []string{dir}, 10*time.Second)
+	w.Subscribe(func(ev Event) { events = append(events, ev) })
+
+	start := time.Now()
+	w.handle(fsnotify.Event{Name: oldPath, Op: fsnotify.Rename}, start)
+	w.handle(fsnotify.Event{Name: newPath, Op: fsnotify.Create}, start)
+	w.handle(fsnotify.Event{Name: gonePath, Op: fsnotify.Remove}, start)
+
+	w.flush(start.Add(5 * time.Second))
+	assert.Empty(t, events, "nothing happens before the files settle")
+
+	w.flush(start.Add(10 * time.Second))
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, Event{Type: EventFileMoved, MediaID: 7, Episode: 1, FileID: 1, Path: newPath}, events[0])
+	}
+	if moved := s.files[newPath]; assert.NotNil(t, moved) {
+		assert.Equal(t, model.CRCPending, moved.CRCState, "the new name has no checksum to compare with")
+	}
+
+	w.flush(start.Add(11 * time.Second))
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, EventFileOrphaned, events[1].Type)
+		assert.Equal(t, uint(2), events[1].FileID)
+	}
+	assert.NotNil(t, s.files[gonePath].OrphanedAt)
+}
@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+// COSE key parameters, the negative ones depend on the key type.
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+func parsePublicKey(data []byte) (*publicKey, error) {
+	var m map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(data, &m); err != nil {
+		return nil, ErrUnsupportedKey
+	}
+	var kty, alg, crv int64
+	if cbor.Unmarshal(m[coseKty], &kty) != nil || cbor.Unmarshal(m[coseAlg], &alg) != nil {
+		return nil, ErrUnsupportedKey
+	}
+
+	var x, y, n, e []byte
+	switch {
+	case kty == ktyEC2 && alg == algES256:
+		if cbor.Unmarshal(m[coseCrv], &crv) != nil || crv != crvP256 ||
+			cbor.Unmarshal(m[coseX], &x) != nil || cbor.Unmarshal(m[coseY], &y) != nil {
+			return nil, ErrUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+	case kty == ktyOKP && alg == algEdDSA:
+		if cbor.Unmarshal(m[coseCrv], &crv) != nil || crv != crvEd25519 ||
+			cbor.Unmarshal(m[coseX], &x) != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == algRS256:
+		if cbor.Unmarshal(m[coseN], &n) != nil || cbor.Unmarshal(m[coseE], &e) != nil {
+			return nil, ErrUnsupportedKey
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+func (k *publicKey) verify(signed, sig []byte) error {
+	hash := sha256.Sum256(signed)
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		var rs struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) > 0 {
+			return ErrSignature
+		}
+		if !ecdsa.Verify(pub, hash[:], rs.R, rs.S) {
+			return ErrSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, signed, sig) {
+			return ErrSignature
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) != nil {
+			return ErrSignature
+		}
+	default:
+		return ErrUnsupportedKey
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+// Package webauthn verifies the registration and authentication ceremonies
+// of WebAuthn passkeys on the relying party side.
+//
+// Attestation is not verified: the server asks for none, and only needs
+// the public key, not proof of the authenticator model. Keys may be ES256,
+// EdDSA or RS256.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+var (
+	ErrClientData     = errors.New("webauthn: invalid client data")
+	ErrChallenge      = errors.New("webauthn: challenge mismatch")
+	ErrOrigin         = errors.New("webauthn: origin not allowed")
+	ErrAuthData       = errors.New("webauthn: invalid authenticator data")
+	ErrRPID           = errors.New("webauthn: credential is for another relying party")
+	ErrUserPresence   = errors.New("webauthn: user was not present")
+	ErrSignature      = errors.New("webauthn: invalid signature")
+	ErrSignCount      = errors.New("webauthn: sign count went backwards, the authenticator may be cloned")
+	ErrAttestation    = errors.New("webauthn: invalid attestation object")
+	ErrUnsupportedKey = errors.New("webauthn: unsupported public key")
+)
+
+// Config of the relying party. RPID is the domain credentials are scoped
+// to, Origins the web origins allowed to use them.
+type Config struct {
+	RPID    string
+	RPName  string
+	Origins []string
+	Timeout time.Duration
+}
+
+type RelyingParty struct {
+	cfg Config
+}
+
+func New(cfg Config) *RelyingParty {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+	return &RelyingParty{cfg: cfg}
+}
+
+// Timeout is how long a ceremony may take.
+func (rp *RelyingParty) Timeout() time.Duration {
+	return rp.cfg.Timeout
+}
+
+// Bytes is binary data, base64url encoded in JSON as the browser helpers
+// do. Padded and standard encodings are accepted too.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, enc := range []*base64.Encoding{
+		base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding,
+	} {
+		if d, err := enc.DecodeString(s); err == nil {
+			*b = d
+			return nil
+		}
+	}
+	return errors.New("webauthn: invalid base64")
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CreationOptions are passed to navigator.credentials.create.
+type CreationOptions struct {
+	Challenge Bytes `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Bytes  `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the credential navigator.credentials.create
+// resolves to.
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential navigator.credentials.get resolves
+// to.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a registered authenticator key.
+type Credential struct {
+	ID []byte
+	// PublicKey is COSE encoded.
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+func (rp *RelyingParty) descriptors(ids [][]byte) []CredentialDescriptor {
+	d := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		d = append(d, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return d
+}
+
+// CreationOptions starts a registration. exclude lists the credentials the
+// user has already, so that an authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge, userHandle []byte, name, displayName string, exclude [][]byte) *CreationOptions {
+	o := &CreationOptions{
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: algES256},
+			{Type: "public-key", Alg: algEdDSA},
+			{Type: "public-key", Alg: algRS256},
+		},
+		Timeout:            rp.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: rp.descriptors(exclude),
+		Attestation:        "none",
+	}
+	o.RP.ID = rp.cfg.RPID
+	o.RP.Name = rp.cfg.RPName
+	o.User.ID = userHandle
+	o.User.Name = name
+	o.User.DisplayName = displayName
+	o.AuthenticatorSelection.ResidentKey = "preferred"
+	o.AuthenticatorSelection.UserVerification = "preferred"
+	return o
+}
+
+// RequestOptions starts an authentication. Without allow the authenticator
+// offers its discoverable credentials.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte) *RequestOptions {
+	o := &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.cfg.Timeout.Milliseconds(),
+		RPID:             rp.cfg.RPID,
+		UserVerification: "preferred",
+	}
+	if len(allow) > 0 {
+		o.AllowCredentials = rp.descriptors(allow)
+	}
+	return o
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func parseClientData(data []byte) (*clientData, []byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(data, &cd); err != nil {
+		return nil, nil, ErrClientData
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return nil, nil, ErrClientData
+	}
+	return &cd, challenge, nil
+}
+
+// Challenge returns the challenge the client signed, to look up the
+// ceremony it belongs to.
+func Challenge(clientDataJSON []byte) ([]byte, error) {
+	_, challenge, err := parseClientData(clientDataJSON)
+	return challenge, err
+}
+
+func (rp *RelyingParty) checkClientData(data []byte, typ string, challenge []byte) error {
+	cd, got, err := parseClientData(data)
+	if err != nil {
+		return err
+	}
+	if cd.Type != typ {
+		return ErrClientData
+	}
+	if !bytes.Equal(got, challenge) {
+		return ErrChallenge
+	}
+	for _, o := range rp.cfg.Origins {
+		if cd.Origin == o {
+			return nil
+		}
+	}
+	return ErrOrigin
+}
+
+type authData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// credentialID and publicKey are only there on registration.
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthData(data []byte) (*authData, error) {
+	if len(data) < 37 {
+		return nil, ErrAuthData
+	}
+	ad := &authData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	// AAGUID, then the length of the credential ID.
+	if len(rest) < 18 {
+		return nil, ErrAuthData
+	}
+	n := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < n {
+		return nil, ErrAuthData
+	}
+	ad.credentialID = rest[:n]
+
+	var key cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest[n:], &key); err != nil {
+		return nil, ErrAuthData
+	}
+	ad.publicKey = key
+	return ad, nil
+}
+
+func (rp *RelyingParty) checkAuthData(ad *authData) error {
+	want := sha256.Sum256([]byte(rp.cfg.RPID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return ErrRPID
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserPresence
+	}
+	return nil
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+// VerifyRegistration checks a new credential against the challenge of its
+// ceremony.
+func (rp *RelyingParty) VerifyRegistration(r *AttestationResponse, challenge []byte) (*Credential, error) {
+	if err := rp.checkClientData(r.Response.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	var att attestationObject
+	if err := cbor.Unmarshal(r.Response.AttestationObject, &att); err != nil {
+		return nil, ErrAttestation
+	}
+	ad, err := parseAuthData(att.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil || !bytes.Equal(ad.credentialID, r.RawID) {
+		return nil, ErrAttestation
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:           ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks an authentication with the stored credential c
+// and returns it with the new sign count. Authenticators that count
+// signatures must count up, anything else means two copies of the key are
+// in use.
+func (rp *RelyingParty) VerifyAssertion(r *AssertionResponse, challenge []byte, c *Credential) (*Credential, error) {
+	if err := rp.checkClientData(r.Response.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return nil, err
+	}
+
+	ad, err := parseAuthData(r.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(c.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(r.Response.ClientDataJSON)
+	signed := append(append([]byte{}, r.Response.AuthenticatorData...), hash[:]...)
+	if err := key.verify(signed, r.Response.Signature); err != nil {
+		return nil, err
+	}
+
+	if (ad.signCount != 0 || c.SignCount != 0) && ad.signCount <= c.SignCount {
+		return nil, ErrSignCount
+	}
+
+	return &Credential{
+		ID:           c.ID,
+		PublicKey:    c.PublicKey,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
@@ -0,0 +1,106 @@
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn/webauthntest"
+)
+
+var rp = webauthn.New(webauthn.Config{
+	RPID:    "kitsu.test",
+	RPName:  "kitsu.media",
+	Origins: []string{"https://kitsu.test"},
+})
+
+func register(t *testing.T, a *webauthntest.Authenticator) *webauthn.Credential {
+	challenge := []byte("registration challenge")
+	att, err := a.Create(rp.CreationOptions(challenge, []byte{0, 0, 0, 1}, "ann", "Ann", nil))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	got, err := webauthn.Challenge(att.Response.ClientDataJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, challenge, got)
+
+	c, err := rp.VerifyRegistration(att, challenge)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, att.RawID, webauthn.Bytes(c.ID))
+	return c
+}
+
+func TestCeremonies(t *testing.T) {
+	a := webauthntest.New("https://kitsu.test")
+	c := register(t, a)
+	assert.True(t, c.UserVerified)
+
+	challenge := []byte("login challenge")
+	as, err := a.Get(rp.RequestOptions(challenge, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 1}, []byte(as.Response.UserHandle))
+
+	c2, err := rp.VerifyAssertion(as, challenge, c)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), c2.SignCount)
+
+	_, err = rp.VerifyAssertion(as, []byte("another challenge"), c)
+	assert.Equal(t, webauthn.ErrChallenge, err)
+
+	_, err = rp.VerifyAssertion(as, challenge, c2)
+	assert.Equal(t, webauthn.ErrSignCount, err, "replaying the same assertion")
+
+	other := register(t, webauthntest.New("https://kitsu.test"))
+	_, err = rp.VerifyAssertion(as, challenge, other)
+	assert.Equal(t, webauthn.ErrSignature, err, "signed by another key")
+}
+
+func TestClonedAuthenticator(t *testing.T) {
+	a := webauthntest.New("https://kitsu.test")
+	c := register(t, a)
+
+	for i := 0; i < 3; i++ {
+		as, _ := a.Get(rp.RequestOptions([]byte("c"), [][]byte{c.ID}))
+		next, err := rp.VerifyAssertion(as, []byte("c"), c)
+		assert.NoError(t, err)
+		c = next
+	}
+
+	a.SetCounter(1)
+	as, _ := a.Get(rp.RequestOptions([]byte("c"), nil))
+	_, err := rp.VerifyAssertion(as, []byte("c"), c)
+	assert.Equal(t, webauthn.ErrSignCount, err)
+}
+
+func TestOriginAndRPID(t *testing.T) {
+	evil := webauthntest.New("https://evil.test")
+	_, err := func() (*webauthn.Credential, error) {
+		att, err := evil.Create(rp.CreationOptions([]byte("c"), []byte{1}, "ann", "Ann", nil))
+		if err != nil {
+			return nil, err
+		}
+		return rp.VerifyRegistration(att, []byte("c"))
+	}()
+	assert.Equal(t, webauthn.ErrOrigin, err)
+
+	otherRP := webauthn.New(webauthn.Config{RPID: "evil.test", Origins: []string{"https://kitsu.test"}})
+	att, err := webauthntest.New("https://kitsu.test").Create(otherRP.CreationOptions([]byte("c"), []byte{1}, "ann", "Ann", nil))
+	assert.NoError(t, err)
+	_, err = rp.VerifyRegistration(att, []byte("c"))
+	assert.Equal(t, webauthn.ErrRPID, err)
+}
+
+func TestUnverifiedUser(t *testing.T) {
+	a := webauthntest.New("https://kitsu.test")
+	a.UserVerified = false
+	c := register(t, a)
+	assert.False(t, c.UserVerified)
+
+	as, _ := a.Get(rp.RequestOptions([]byte("c"), nil))
+	c2, err := rp.VerifyAssertion(as, []byte("c"), c)
+	assert.NoError(t, err)
+	assert.False(t, c2.UserVerified)
+}
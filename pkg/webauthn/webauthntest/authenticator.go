@@ -0,0 +1,179 @@
+// Package webauthntest provides a software authenticator, so that the
+// WebAuthn ceremonies can be tested without hardware.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/xenking/kitsu-media-server/pkg/webauthn"
+)
+
+// Authenticator plays both the browser and a platform authenticator with
+// ES256 keys. It counts signatures like hardware keys do.
+type Authenticator struct {
+	Origin string
+	// UserVerified sets the UV flag, as after a PIN or biometric check.
+	UserVerified bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	counter    uint32
+}
+
+var ErrNoCredential = errors.New("webauthntest: no matching credential")
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerified: true}
+}
+
+func (a *Authenticator) clientData(typ string, challenge []byte) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return b
+}
+
+func (a *Authenticator) authData(c *credential, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	flags := byte(0x01)
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], c.counter)
+	if !attested {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = append(data, byte(len(c.id)>>8), byte(len(c.id)))
+	data = append(data, c.id...)
+	key, _ := cbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: pad32(c.key.X.Bytes()),
+		-3: pad32(c.key.Y.Bytes()),
+	})
+	return append(data, key...)
+}
+
+func pad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// Create registers a new credential like navigator.credentials.create.
+func (a *Authenticator) Create(o *webauthn.CreationOptions) (*webauthn.AttestationResponse, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	c := &credential{id: id, rpID: o.RP.ID, userHandle: o.User.ID, key: key}
+	a.credentials = append(a.credentials, c)
+
+	att, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(c, true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &webauthn.AttestationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+	}
+	r.Response.ClientDataJSON = a.clientData("webauthn.create", o.Challenge)
+	r.Response.AttestationObject = att
+	return r, nil
+}
+
+// Get signs in like navigator.credentials.get, with the first credential
+// for the relying party that the options allow.
+func (a *Authenticator) Get(o *webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	c := a.find(o)
+	if c == nil {
+		return nil, ErrNoCredential
+	}
+	c.counter++
+
+	authData := a.authData(c, false)
+	clientData := a.clientData("webauthn.get", o.Challenge)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(c.id),
+		RawID: c.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = sig
+	resp.Response.UserHandle = c.userHandle
+	return resp, nil
+}
+
+func (a *Authenticator) find(o *webauthn.RequestOptions) *credential {
+	for _, c := range a.credentials {
+		if c.rpID != o.RPID {
+			continue
+		}
+		if len(o.AllowCredentials) == 0 {
+			return c
+		}
+		for _, d := range o.AllowCredentials {
+			if string(d.ID) == string(c.id) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// SetCounter sets the signature counter of all credentials, to act as a
+// clone that fell behind.
+func (a *Authenticator) SetCounter(n uint32) {
+	for _, c := range a.credentials {
+		c.counter = n
+	}
+}